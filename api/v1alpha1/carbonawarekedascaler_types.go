@@ -17,7 +17,9 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // Reasons why operator is in degraded status
@@ -32,6 +34,16 @@ const (
 	ReasonEcoModeDisabled       = "OperatorEcoModeDisabled"
 )
 
+// ConditionForecastDegraded is the type of the condition that reports problems found while validating the carbon intensity forecast
+const ConditionForecastDegraded = "ForecastDegraded"
+
+// Reasons why the carbon intensity forecast is in degraded status
+const (
+	ReasonForecastValid       = "ForecastValid"
+	ReasonForecastNormalized  = "ForecastNormalized"
+	ReasonForecastUnavailable = "ForecastUnavailable"
+)
+
 // KedaTargetRef represents the KEDA object to scale
 type KedaTargetRef struct {
 	// name of the keda target
@@ -91,18 +103,232 @@ type CarbonIntensityConfig struct {
 	CarbonIntensityThreshold int32 `json:"carbonIntensityThreshold"`
 
 	// maximum number of replicas to scale to when the carbon intensity threshold meets or exceeds carbonIntensityThreshold
+	// either maxReplicas or maxReplicasPercent must be set
+	// +kubebuilder:validation:Optional
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+
+	// maximum number of replicas as a percentage of the baseline set in percentOfBaseline, used instead of maxReplicas when set
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	MaxReplicasPercent *int32 `json:"maxReplicasPercent,omitempty"`
+}
+
+// PercentOfBaseline represents the configuration to compute max replicas from maxReplicasPercent
+type PercentOfBaseline struct {
+	// max replicas that maxReplicasPercent is relative to; with targetMaxReplicas, changing maxReplicaCount of the keda target changes the baseline
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=ecoModeOff
+	Baseline Baseline `json:"baseline,omitempty"`
+
+	// lowest max replicas computed from maxReplicasPercent
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// highest max replicas computed from maxReplicasPercent
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+
+	// how max replicas computed from maxReplicasPercent is rounded to a whole number of replicas
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=nearest
+	Rounding InterpolationRounding `json:"rounding,omitempty"`
+}
+
+// Baseline represents the max replicas that maxReplicasPercent is relative to
+// Only one of the following baselines is supported:
+// - ecoModeOff: ecoModeOff.maxReplicas
+// - targetMaxReplicas: maxReplicaCount of the keda target before the operator changed it, recorded in the carbonaware.kubernetes.azure.com/original-max-replicas annotation of the target;
+// the operator also records the maxReplicaCount it sets in the carbonaware.kubernetes.azure.com/applied-max-replicas annotation, and records the baseline again when maxReplicaCount is changed by anyone else
+// +kubebuilder:validation:Enum=ecoModeOff;targetMaxReplicas
+type Baseline string
+
+const (
+	BaselineEcoModeOff        Baseline = "ecoModeOff"
+	BaselineTargetMaxReplicas Baseline = "targetMaxReplicas"
+)
+
+// RelativeThresholds represents carbon intensity thresholds relative to the distribution of the forecast
+type RelativeThresholds struct {
+	// length of time in minutes from now of the forecast the percentiles are computed over
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=1440
+	WindowInMins int32 `json:"windowInMins,omitempty"`
+
+	// array of percentiles preferrably in ascending order; each percentile represents the upper limit and previous entry represents lower limit
 	// +kubebuilder:validation:Required
-	MaxReplicas *int32 `json:"maxReplicas"`
+	// +kubebuilder:validation:MinItems=1
+	Thresholds []RelativeThreshold `json:"thresholds"`
 }
 
+// RelativeThreshold represents the configuration to scale the number of replicas based on a percentile of the forecast
+type RelativeThreshold struct {
+	// percentile of the carbon intensity in the window used as the threshold, e.g. 25 for the cleanest 25% of the window
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Percentile int32 `json:"percentile"`
+
+	// maximum number of replicas to scale to when the carbon intensity is at or below the percentile
+	// either maxReplicas or maxReplicasPercent must be set
+	// +kubebuilder:validation:Optional
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+
+	// maximum number of replicas as a percentage of the baseline set in percentOfBaseline, used instead of maxReplicas when set
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	MaxReplicasPercent *int32 `json:"maxReplicasPercent,omitempty"`
+}
+
+// Interpolation represents how max replicas is derived from the carbon intensity thresholds
+// Only one of the following interpolations is supported:
+// - step: use the max replicas of the lowest threshold the carbon intensity meets or is below
+// - linear: interpolate between the max replicas of the thresholds below and above the carbon intensity
+// +kubebuilder:validation:Enum=step;linear
+type Interpolation string
+
+const (
+	InterpolationStep   Interpolation = "step"
+	InterpolationLinear Interpolation = "linear"
+)
+
+// InterpolationRounding represents how an interpolated max replicas is rounded
+// Only one of the following roundings is supported:
+// - nearest: round to the nearest number of replicas, halfway values are rounded up
+// - down: round down, favoring fewer replicas
+// - up: round up, favoring more replicas
+// +kubebuilder:validation:Enum=nearest;down;up
+type InterpolationRounding string
+
+const (
+	InterpolationRoundingNearest InterpolationRounding = "nearest"
+	InterpolationRoundingDown    InterpolationRounding = "down"
+	InterpolationRoundingUp      InterpolationRounding = "up"
+)
+
 // CarbonIntensityForecastDataSource represents the carbon intensity forecast data source
 type CarbonIntensityForecastDataSource struct {
+	// primary carbon intensity forecast source
+	CarbonIntensityForecastSource `json:",inline"`
+
+	// ordered list of sources to try when the primary source fails to return a forecast
+	// +kubebuilder:validation:Optional
+	Fallbacks []CarbonIntensityForecastSource `json:"fallbacks,omitempty"`
+
+	// combine the forecasts of several sources into one forecast, used instead of the primary source when set
+	// +kubebuilder:validation:Optional
+	Ensemble *Ensemble `json:"ensemble,omitempty"`
+
+	// length of time in minutes the last successfully fetched forecast of each source is kept for the lastKnownGood strategy
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=720
+	CacheMaxAgeInMins int32 `json:"cacheMaxAgeInMins,omitempty"`
+
+	// location of the carbon intensity forecast to use when a source returns forecasts for several locations
+	// set to auto to use the topology.kubernetes.io/region label of the nodes running the keda target workload
+	// +kubebuilder:validation:Optional
+	Location string `json:"location,omitempty"`
+
+	// maps node regions to forecast locations when location is auto, regions without an entry are used as the location
+	// +kubebuilder:validation:Optional
+	RegionLocations map[string]string `json:"regionLocations,omitempty"`
+}
+
+// LocationAuto is the location that is resolved from the region of the nodes running the keda target workload
+const LocationAuto = "auto"
+
+// Ensemble represents the configuration to combine the forecasts of several sources on a common time grid
+type Ensemble struct {
+	// method used to combine the values of the members in each slot
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=weightedMean
+	Method EnsembleMethod `json:"method,omitempty"`
+
+	// sources to combine, each member should set only one source
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	Members []EnsembleMember `json:"members"`
+
+	// length of time in minutes of each slot of the combined forecast, defaults to the shortest slot length of the members
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	SlotLengthInMins int32 `json:"slotLengthInMins,omitempty"`
+
+	// minimum number of members that must return a forecast; slots covered by fewer members are left out of the combined forecast
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=1
+	MinMembers int32 `json:"minMembers,omitempty"`
+}
+
+// EnsembleMember represents a source of an ensemble
+type EnsembleMember struct {
+	// name of the member used as the provider label of the carbon_aware_keda_scaler_provider_carbon_intensity metric, defaults to a description of the source
+	// +kubebuilder:validation:Optional
+	Name string `json:"name,omitempty"`
+
+	// weight of the member when the method is weightedMean
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=1
+	Weight int32 `json:"weight,omitempty"`
+
+	// carbon intensity forecast source of the member
+	CarbonIntensityForecastSource `json:",inline"`
+}
+
+// EnsembleMethod represents how the values of the members of an ensemble are combined
+// Only one of the following methods is supported:
+// - weightedMean: mean of the values weighted by the weight of each member
+// - median: median of the values
+// - max: highest value, the most pessimistic forecast
+// - min: lowest value, the most optimistic forecast
+// +kubebuilder:validation:Enum=weightedMean;median;max;min
+type EnsembleMethod string
+
+const (
+	EnsembleMethodWeightedMean EnsembleMethod = "weightedMean"
+	EnsembleMethodMedian       EnsembleMethod = "median"
+	EnsembleMethodMax          EnsembleMethod = "max"
+	EnsembleMethodMin          EnsembleMethod = "min"
+)
+
+// CarbonIntensityForecastSource represents a single source of carbon intensity forecasts
+// only one source should be set
+type CarbonIntensityForecastSource struct {
 	// local configmap details
 	// +kubebuilder:validation:Optional
 	LocalConfigMap LocalConfigMap `json:"localConfigMap,omitempty"`
 	// mock carbon forecast data
 	// +kubebuilder:validation:Optional
-	MockCarbonForecast bool `json:"mockCarbonForecast,omitempty"`
+	MockCarbonForecast *MockCarbonForecast `json:"mockCarbonForecast,omitempty"`
+	// carbon aware sdk webapi details
+	// +kubebuilder:validation:Optional
+	CarbonAwareSdk *CarbonAwareSdk `json:"carbonAwareSdk,omitempty"`
+	// watttime api details
+	// +kubebuilder:validation:Optional
+	WattTime *WattTime `json:"wattTime,omitempty"`
+	// electricity maps api details
+	// +kubebuilder:validation:Optional
+	ElectricityMaps *ElectricityMaps `json:"electricityMaps,omitempty"`
+	// uk national grid carbon intensity api details
+	// +kubebuilder:validation:Optional
+	UkCarbonIntensity *UkCarbonIntensity `json:"ukCarbonIntensity,omitempty"`
+	// prometheus query details
+	// +kubebuilder:validation:Optional
+	Prometheus *Prometheus `json:"prometheus,omitempty"`
+	// static daily carbon intensity profile
+	// +kubebuilder:validation:Optional
+	StaticProfile *StaticProfile `json:"staticProfile,omitempty"`
+	// forecast pushed to the forecast push endpoint of the operator
+	// +kubebuilder:validation:Optional
+	Pushed *Pushed `json:"pushed,omitempty"`
+	// carbonintensityforecast resource details
+	// +kubebuilder:validation:Optional
+	ForecastRef *ForecastRef `json:"forecastRef,omitempty"`
 }
 
 type LocalConfigMap struct {
@@ -117,8 +343,313 @@ type LocalConfigMap struct {
 	// key of the carbon intensity forecast data in the configmap
 	// +kubebuilder:validation:Required
 	Key string `json:"key"`
+
+	// maximum age in minutes of the forecast based on the forecastDateTime or lastHeartbeatTime written by the exporter; older data is rejected as stale
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	MaxDataAgeInMins int32 `json:"maxDataAgeInMins,omitempty"`
+
+	// format of the carbon intensity forecast data, read from binaryData or data
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=json
+	Format ConfigMapFormat `json:"format,omitempty"`
+}
+
+// ConfigMapFormat represents the encoding of the carbon intensity forecast data in a configmap
+// Only one of the following formats is supported:
+// - json: json array of carbon forecasts
+// - json+gzip: gzip compressed json array of carbon forecasts, base64 encoded when stored in data
+// - csv: one timestamp,value,duration row per forecast with an optional header row
+// +kubebuilder:validation:Enum=json;json+gzip;csv
+type ConfigMapFormat string
+
+const (
+	ConfigMapFormatJSON     ConfigMapFormat = "json"
+	ConfigMapFormatJSONGzip ConfigMapFormat = "json+gzip"
+	ConfigMapFormatCSV      ConfigMapFormat = "csv"
+)
+
+// CarbonAwareSdk represents the configuration to fetch carbon intensity forecasts from the Carbon Aware SDK WebAPI, see https://github.com/Green-Software-Foundation/carbon-aware-sdk
+type CarbonAwareSdk struct {
+	// base url of the carbon aware sdk webapi, e.g. http://carbon-aware-sdk.default.svc:8080
+	// +kubebuilder:validation:Required
+	URL string `json:"url"`
+
+	// location to fetch the carbon intensity forecast for, e.g. eastus
+	// +kubebuilder:validation:Required
+	Location string `json:"location"`
+
+	// secret holding a bearer token sent in the authorization header
+	// +kubebuilder:validation:Optional
+	AuthSecretRef *SecretKeyRef `json:"authSecretRef,omitempty"`
+
+	// tls settings used to connect to the webapi
+	// +kubebuilder:validation:Optional
+	TLS *TLSConfig `json:"tls,omitempty"`
+}
+
+// WattTimeSignal represents the signal used from the WattTime API
+// Only one of the following signals is supported:
+// - moer: absolute marginal operating emissions rate in lbs/MWh, not the gCO2/kWh of the other data sources (1 lbs/MWh is about 0.45 gCO2/kWh)
+// - percent: watttime signal index, the percentile of the current moer over the past month from 0 (cleanest) to 100 (dirtiest); it is only published for the current time so the forecast has a single slot
+// +kubebuilder:validation:Enum=moer;percent
+type WattTimeSignal string
+
+const (
+	WattTimeSignalMoer    WattTimeSignal = "moer"
+	WattTimeSignalPercent WattTimeSignal = "percent"
+)
+
+// WattTime represents the configuration to fetch marginal emissions from the WattTime API, see https://docs.watttime.org
+type WattTime struct {
+	// base url of the watttime api
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default="https://api.watttime.org"
+	URL string `json:"url,omitempty"`
+
+	// grid region to fetch the marginal emissions for, e.g. CAISO_NORTH
+	// +kubebuilder:validation:Required
+	Region string `json:"region"`
+
+	// secret holding the watttime account in the username and password keys
+	// +kubebuilder:validation:Required
+	CredentialsSecretRef SecretRef `json:"credentialsSecretRef"`
+
+	// signal to scale on; maxReplicasByCarbonIntensity thresholds are compared against the values of this signal, moer is in lbs/MWh rather than the gCO2/kWh of the other data sources
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=moer
+	Signal WattTimeSignal `json:"signal,omitempty"`
+}
+
+// ElectricityMaps represents the configuration to fetch carbon intensity forecasts from the Electricity Maps API, see https://static.electricitymaps.com/api/docs/index.html
+type ElectricityMaps struct {
+	// base url of the electricity maps api
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default="https://api.electricitymap.org"
+	URL string `json:"url,omitempty"`
+
+	// zone to fetch the carbon intensity forecast for, e.g. DE
+	// +kubebuilder:validation:Required
+	Zone string `json:"zone"`
+
+	// secret holding the api token sent in the auth-token header
+	// +kubebuilder:validation:Required
+	AuthTokenSecretRef SecretKeyRef `json:"authTokenSecretRef"`
+}
+
+// UkCarbonIntensity represents the configuration to fetch carbon intensity forecasts from the UK National Grid ESO Carbon Intensity API, see https://carbon-intensity.github.io/api-definitions
+// The national forecast is used when neither regionId nor postcode is set
+type UkCarbonIntensity struct {
+	// base url of the carbon intensity api
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default="https://api.carbonintensity.org.uk"
+	URL string `json:"url,omitempty"`
+
+	// id of the region to fetch the forecast for, see https://carbon-intensity.github.io/api-definitions/#region-list
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=17
+	RegionID int32 `json:"regionId,omitempty"`
+
+	// outward code of the postcode to fetch the forecast for, e.g. RG10
+	// +kubebuilder:validation:Optional
+	Postcode string `json:"postcode,omitempty"`
+}
+
+// Prometheus represents the configuration to read carbon intensity values already scraped into Prometheus
+type Prometheus struct {
+	// url of the prometheus server, e.g. http://prometheus-k8s.monitoring.svc:9090
+	// +kubebuilder:validation:Required
+	URL string `json:"url"`
+
+	// promql expression returning a single series of carbon intensity values
+	// +kubebuilder:validation:Required
+	Query string `json:"query"`
+
+	// length of time in minutes to query back from now
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=60
+	RangeInMins int32 `json:"rangeInMins,omitempty"`
+
+	// query resolution step in minutes; each sample becomes a forecast slot of this length
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=5
+	StepInMins int32 `json:"stepInMins,omitempty"`
+
+	// secret holding a bearer token sent in the authorization header
+	// +kubebuilder:validation:Optional
+	AuthSecretRef *SecretKeyRef `json:"authSecretRef,omitempty"`
+
+	// tls settings used to connect to prometheus
+	// +kubebuilder:validation:Optional
+	TLS *TLSConfig `json:"tls,omitempty"`
 }
 
+// StaticProfile represents a fixed daily carbon intensity profile, e.g. the typical hourly carbon intensity of a region
+type StaticProfile struct {
+	// carbon intensity values repeated every day starting at midnight utc; each value covers slotLengthInMins
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	Values []int32 `json:"values"`
+
+	// length of time in minutes each value covers
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=60
+	SlotLengthInMins int32 `json:"slotLengthInMins,omitempty"`
+}
+
+// Pushed represents a carbon intensity forecast pushed to the operator with POST /forecasts/{location}
+type Pushed struct {
+	// location the forecast was pushed for
+	// +kubebuilder:validation:Required
+	Location string `json:"location"`
+
+	// maximum age in minutes of the last pushed forecast; older data is rejected as stale
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	MaxDataAgeInMins int32 `json:"maxDataAgeInMins,omitempty"`
+}
+
+// ForecastRef represents a reference to a CarbonIntensityForecast resource
+type ForecastRef struct {
+	// name of the carbonintensityforecast
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// namespace of the carbonintensityforecast
+	// +kubebuilder:validation:Required
+	Namespace string `json:"namespace"`
+
+	// maximum age in minutes of the forecast based on its generatedAt time; older data is rejected as stale
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	MaxDataAgeInMins int32 `json:"maxDataAgeInMins,omitempty"`
+}
+
+// MockProfile represents the shape of a synthetic carbon intensity forecast
+// Only one of the following profiles is supported:
+// - sine: a sine wave between min and max with the given period
+// - step: min for the first half of each period and max for the second half
+// - random: a random value between min and max for each slot, the same seed always generates the same value for a slot
+// - constant: halfway between min and max
+// - replay: a recorded trace shifted to start at the current time
+// +kubebuilder:validation:Enum=sine;step;random;constant;replay
+type MockProfile string
+
+const (
+	MockProfileSine     MockProfile = "sine"
+	MockProfileStep     MockProfile = "step"
+	MockProfileRandom   MockProfile = "random"
+	MockProfileConstant MockProfile = "constant"
+	MockProfileReplay   MockProfile = "replay"
+)
+
+// MockCarbonForecast represents the configuration of a synthetic carbon intensity forecast written to a configmap for demos and tests
+type MockCarbonForecast struct {
+	// shape of the generated forecast
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=random
+	Profile MockProfile `json:"profile,omitempty"`
+
+	// lowest generated carbon intensity, 0 is kept when it is set explicitly
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=529
+	Min *int32 `json:"min,omitempty"`
+
+	// highest generated carbon intensity, 0 is kept when it is set explicitly
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=580
+	Max *int32 `json:"max,omitempty"`
+
+	// length of time in minutes of one cycle of the sine and step profiles, cycles are counted from the unix epoch so periods that divide a day start at midnight utc
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=1440
+	PeriodInMins int32 `json:"periodInMins,omitempty"`
+
+	// length of time in minutes each generated value covers
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=5
+	SlotLengthInMins int32 `json:"slotLengthInMins,omitempty"`
+
+	// seed of the random profile
+	// +kubebuilder:validation:Optional
+	Seed int64 `json:"seed,omitempty"`
+
+	// name of a trace embedded in the operator to replay with the replay profile, one of us-west-solar, gb-wind or in-coal
+	// +kubebuilder:validation:Optional
+	Trace string `json:"trace,omitempty"`
+
+	// configmap holding a recorded trace to replay with the replay profile, used instead of trace
+	// +kubebuilder:validation:Optional
+	TraceConfigMap *LocalConfigMap `json:"traceConfigMap,omitempty"`
+
+	// repeat the trace once it ends, otherwise the forecast ends with the trace
+	// +kubebuilder:validation:Optional
+	Loop bool `json:"loop,omitempty"`
+
+	// name of the configmap the generated forecast is written to
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=mock-carbon-intensity
+	ConfigMapName string `json:"configMapName,omitempty"`
+
+	// namespace of the configmap the generated forecast is written to
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=kube-system
+	ConfigMapNamespace string `json:"configMapNamespace,omitempty"`
+}
+
+// SecretRef represents a secret in the namespace of the carbonawarekedascaler
+type SecretRef struct {
+	// name of the secret in the namespace of the carbonawarekedascaler
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+}
+
+// SecretKeyRef represents a key in a secret in the namespace of the carbonawarekedascaler
+type SecretKeyRef struct {
+	// name of the secret in the namespace of the carbonawarekedascaler
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// key of the value in the secret
+	// +kubebuilder:validation:Required
+	Key string `json:"key"`
+}
+
+// TLSConfig represents the tls settings used to connect to a carbon intensity data provider
+type TLSConfig struct {
+	// skip verification of the server certificate; not recommended outside of dev/test environments
+	// +kubebuilder:validation:Optional
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+
+	// secret holding a pem encoded ca bundle used to verify the server certificate
+	// +kubebuilder:validation:Optional
+	CASecretRef *SecretKeyRef `json:"caSecretRef,omitempty"`
+}
+
+// ForecastUnavailableStrategy represents what the operator does when there is no carbon intensity forecast for the current time
+// Only one of the following strategies is supported:
+// - lastKnownGood: use the last forecast fetched from any configured source if it is not older than cacheMaxAgeInMins, otherwise ecoModeOff
+// - ecoModeOff: disable eco mode and use ecoModeOff.maxReplicas
+// - mostConservative: use the lowest maxReplicas configured in maxReplicasByCarbonIntensity
+// - holdCurrent: keep the current maxReplicaCount of the keda target
+// +kubebuilder:validation:Enum=lastKnownGood;ecoModeOff;mostConservative;holdCurrent
+type ForecastUnavailableStrategy string
+
+const (
+	ForecastUnavailableLastKnownGood    ForecastUnavailableStrategy = "lastKnownGood"
+	ForecastUnavailableEcoModeOff       ForecastUnavailableStrategy = "ecoModeOff"
+	ForecastUnavailableMostConservative ForecastUnavailableStrategy = "mostConservative"
+	ForecastUnavailableHoldCurrent      ForecastUnavailableStrategy = "holdCurrent"
+)
+
 // KedaTarget represents the type of the KEDA target
 // Only one of the following KEDA targets is supported:
 // - scaledobjects.keda.sh
@@ -142,18 +673,157 @@ type CarbonAwareKedaScalerSpec struct {
 	KedaTargetRef KedaTargetRef `json:"kedaTargetRef"`
 
 	// array of carbon intensity values preferrably in ascending order; each threshold value represents the upper limit and previous entry represents lower limit
-	// +kubebuilder:validation:Required
+	// either maxReplicasByCarbonIntensity or relativeThresholds must be set
+	// +kubebuilder:validation:Optional
 	// +kubebuilder:validation:MinItems=1
-	MaxReplicasByCarbonIntensity []CarbonIntensityConfig `json:"maxReplicasByCarbonIntensity"`
+	MaxReplicasByCarbonIntensity []CarbonIntensityConfig `json:"maxReplicasByCarbonIntensity,omitempty"`
+
+	// carbon intensity thresholds computed on every reconcile from percentiles of the forecast, used instead of maxReplicasByCarbonIntensity when set
+	// +kubebuilder:validation:Optional
+	RelativeThresholds *RelativeThresholds `json:"relativeThresholds,omitempty"`
+
+	// configuration to compute max replicas from the maxReplicasPercent of maxReplicasByCarbonIntensity or relativeThresholds
+	// +kubebuilder:validation:Optional
+	PercentOfBaseline *PercentOfBaseline `json:"percentOfBaseline,omitempty"`
+
+	// how max replicas is derived from maxReplicasByCarbonIntensity when the carbon intensity is between two thresholds
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=step
+	Interpolation Interpolation `json:"interpolation,omitempty"`
+
+	// how the interpolated max replicas is rounded to a whole number of replicas when interpolation is linear
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=nearest
+	InterpolationRounding InterpolationRounding `json:"interpolationRounding,omitempty"`
+
+	// margin in gCO2eq/kWh the carbon intensity must move past the thresholds of the current band before max replicas changes to another band
+	// only applies when interpolation is step
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	Hysteresis int32 `json:"hysteresis,omitempty"`
+
+	// shortest length of time in minutes to stay in a band before max replicas changes to another band
+	// only applies when interpolation is step
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	MinDwellInMins int32 `json:"minDwellInMins,omitempty"`
 
 	// configuration to disable carbon aware scaler
 	// +kubebuilder:validation:Required
 	EcoModeOff EcoModeOff `json:"ecoModeOff"`
 
 	// carbon intensity forecast data source
-	// must have at least localConfigMap or mockCarbonForecast set
+	// must have at least localConfigMap, carbonAwareSdk, wattTime, electricityMaps, ukCarbonIntensity, prometheus, staticProfile, pushed, forecastRef, ensemble or mockCarbonForecast set
 	// +kubebuilder:validation:Required
 	CarbonIntensityForecastDataSource CarbonIntensityForecastDataSource `json:"carbonIntensityForecastDataSource"`
+
+	// strategy to use when there is no carbon intensity forecast for the current time
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=ecoModeOff
+	OnForecastUnavailable ForecastUnavailableStrategy `json:"onForecastUnavailable,omitempty"`
+
+	// limits how fast the max replicas of the keda target moves toward the max replicas for the carbon intensity
+	// +kubebuilder:validation:Optional
+	RampPolicy *RampPolicy `json:"rampPolicy,omitempty"`
+
+	// changes max replicas ahead of upcoming slots of the forecast
+	// +kubebuilder:validation:Optional
+	LookAhead *LookAhead `json:"lookAhead,omitempty"`
+
+	// lowers max replicas as a budget of estimated emissions per day or week runs out
+	// +kubebuilder:validation:Optional
+	CarbonBudget *CarbonBudget `json:"carbonBudget,omitempty"`
+
+	// runs the jobs of a scaledjob in the greenest window of the forecast that still meets a deadline
+	// replaces maxReplicasByCarbonIntensity, relativeThresholds, lookAhead and carbonBudget when set
+	// +kubebuilder:validation:Optional
+	TimeShift *TimeShift `json:"timeShift,omitempty"`
+}
+
+// TimeShift represents holding the jobs of a scaledjob until the greenest window of the forecast they can complete in before a deadline
+type TimeShift struct {
+	// estimated length of time in minutes the jobs take to complete
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Minimum=1
+	JobDurationInMins int32 `json:"jobDurationInMins"`
+
+	// latest time the jobs must complete by, either an RFC 3339 time, e.g. 2023-05-01T06:00:00Z,
+	// or a time of day in UTC, e.g. 06:00, which is its next occurrence so that the jobs are shifted every day
+	// +kubebuilder:validation:Required
+	Deadline string `json:"deadline"`
+
+	// max replicas while waiting for the window to open
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=0
+	WaitMaxReplicas int32 `json:"waitMaxReplicas,omitempty"`
+}
+
+// CarbonBudget represents a budget of estimated emissions of the keda target per period
+type CarbonBudget struct {
+	// estimated emissions allowed per period in gCO2eq, e.g. 5000 or 5k
+	// +kubebuilder:validation:Required
+	Budget resource.Quantity `json:"budget"`
+
+	// period the budget is for, periods start at midnight UTC
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=day
+	Period CarbonBudgetPeriod `json:"period,omitempty"`
+
+	// average power draw of a replica in watts, e.g. 30 or 12.5
+	// +kubebuilder:validation:Required
+	WattsPerReplica resource.Quantity `json:"wattsPerReplica"`
+
+	// lowest max replicas the budget lowers max replicas to, even when the budget is used up
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+}
+
+// CarbonBudgetPeriod represents the period of a carbon budget
+// Only one of the following periods is supported:
+// - day: every day starting at midnight UTC
+// - week: every week starting on monday at midnight UTC
+// +kubebuilder:validation:Enum=day;week
+type CarbonBudgetPeriod string
+
+const (
+	CarbonBudgetPeriodDay  CarbonBudgetPeriod = "day"
+	CarbonBudgetPeriodWeek CarbonBudgetPeriod = "week"
+)
+
+// LookAhead represents how long before an upcoming slot of the forecast max replicas changes to the max replicas of that slot
+type LookAhead struct {
+	// length of time in minutes before a slot with higher max replicas starts to raise max replicas, so that new replicas are warmed up when the slot starts
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	ScaleUpLeadTimeInMins int32 `json:"scaleUpLeadTimeInMins,omitempty"`
+
+	// length of time in minutes before a slot with lower max replicas starts to lower max replicas, so that scaling down finishes when the slot starts
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	ScaleDownLeadTimeInMins int32 `json:"scaleDownLeadTimeInMins,omitempty"`
+}
+
+// RampPolicy represents the largest change of the max replicas of the keda target per interval
+type RampPolicy struct {
+	// largest increase of max replicas per interval as a number of replicas or a percentage of the current max replicas, e.g. 20 or 25%
+	// max replicas increases without a limit when not set
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:XIntOrString
+	MaxStepUp *intstr.IntOrString `json:"maxStepUp,omitempty"`
+
+	// largest decrease of max replicas per interval as a number of replicas or a percentage of the current max replicas, e.g. 20 or 25%
+	// max replicas decreases without a limit when not set
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:XIntOrString
+	MaxStepDown *intstr.IntOrString `json:"maxStepDown,omitempty"`
+
+	// shortest length of time in minutes between two steps
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=5
+	IntervalInMins int32 `json:"intervalInMins,omitempty"`
 }
 
 // CarbonAwareKedaScalerStatus defines the observed state of CarbonAwareKedaScaler
@@ -162,6 +832,129 @@ type CarbonAwareKedaScalerStatus struct {
 	// Important: Run "make" to regenerate code after modifying this file
 	// Conditions is a list of conditions and their status.
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// carbon intensity forecast source that supplied the data used in the last reconcile
+	ForecastSource string `json:"forecastSource,omitempty"`
+
+	// location of the carbon intensity forecast used in the last reconcile
+	ForecastLocation string `json:"forecastLocation,omitempty"`
+
+	// region detected from the nodes running the keda target when location is auto, reused until the pod template of the target changes
+	DetectedRegion *DetectedRegion `json:"detectedRegion,omitempty"`
+
+	// carbon intensity thresholds computed from relativeThresholds in the last reconcile
+	CarbonIntensityThresholds []CarbonIntensityConfig `json:"carbonIntensityThresholds,omitempty"`
+
+	// band of carbon intensity thresholds max replicas was taken from, kept across reconciles when hysteresis or minDwellInMins is set
+	CarbonIntensityBand *CarbonIntensityBand `json:"carbonIntensityBand,omitempty"`
+
+	// start of the upcoming slot of the forecast max replicas was taken from in the last reconcile because of lookAhead
+	LookAheadSlotTime *metav1.Time `json:"lookAheadSlotTime,omitempty"`
+
+	// estimated emissions of the keda target in the current period of carbonBudget
+	CarbonBudget *CarbonBudgetStatus `json:"carbonBudget,omitempty"`
+
+	// window of the forecast the jobs were shifted to in the last reconcile because of timeShift
+	TimeShiftWindow *TimeShiftWindow `json:"timeShiftWindow,omitempty"`
+
+	// max replicas for the carbon intensity or eco mode off configuration in the last reconcile
+	TargetMaxReplicas *int32 `json:"targetMaxReplicas,omitempty"`
+
+	// max replicas set on the keda target in the last reconcile, which lags behind targetMaxReplicas while rampPolicy limits the step
+	AppliedMaxReplicas *int32 `json:"appliedMaxReplicas,omitempty"`
+
+	// time the max replicas of the keda target last moved a step toward targetMaxReplicas under rampPolicy
+	LastRampStepTime *metav1.Time `json:"lastRampStepTime,omitempty"`
+
+	// max replicas that maxReplicasPercent was relative to in the last reconcile
+	BaselineMaxReplicas *int32 `json:"baselineMaxReplicas,omitempty"`
+
+	// strategy in effect because there was no carbon intensity forecast for the current time; empty when the forecast is available
+	ForecastUnavailableStrategy ForecastUnavailableStrategy `json:"forecastUnavailableStrategy,omitempty"`
+
+	// metadata written by the carbon intensity exporter alongside the forecast used in the last reconcile
+	ForecastMetadata *ForecastMetadata `json:"forecastMetadata,omitempty"`
+}
+
+// DetectedRegion represents the region detected from the nodes running the keda target
+type DetectedRegion struct {
+	// most common region of the nodes
+	Region string `json:"region"`
+
+	// hash of the pod template of the keda target workload the region was detected for; empty when every node was considered
+	PodTemplateHash string `json:"podTemplateHash,omitempty"`
+
+	// time the region was detected
+	DetectedTime metav1.Time `json:"detectedTime"`
+}
+
+// CarbonIntensityBand represents the carbon intensity threshold max replicas is taken from
+type CarbonIntensityBand struct {
+	// index of the threshold when the thresholds are sorted by carbon intensity in ascending order
+	Index int32 `json:"index"`
+
+	// carbon intensity threshold of the band
+	CarbonIntensityThreshold int32 `json:"carbonIntensityThreshold"`
+
+	// maximum number of replicas of the band
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+
+	// time max replicas changed to the band
+	EnteredAt metav1.Time `json:"enteredAt"`
+}
+
+// CarbonBudgetStatus represents the estimated emissions of the keda target in the current period of the carbon budget
+type CarbonBudgetStatus struct {
+	// start of the current period
+	PeriodStart metav1.Time `json:"periodStart"`
+
+	// estimated emissions in gCO2eq since the start of the period
+	Used resource.Quantity `json:"used"`
+
+	// estimated emissions in gCO2eq at the end of the period if the observed replicas keep running
+	Projected resource.Quantity `json:"projected"`
+
+	// max replicas the rest of the budget allows for the current slot of the forecast
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+
+	// time the replicas and carbon intensity were last observed
+	ObservedTime metav1.Time `json:"observedTime"`
+
+	// number of replicas of the keda target when last observed
+	ObservedReplicas int32 `json:"observedReplicas"`
+
+	// carbon intensity in gCO2eq/kWh when last observed
+	ObservedCarbonIntensity int32 `json:"observedCarbonIntensity"`
+}
+
+// TimeShiftWindow represents the window of the forecast jobs are shifted to
+type TimeShiftWindow struct {
+	// time the window opens
+	Start metav1.Time `json:"start"`
+
+	// time the window closes, which is the start plus the job duration
+	End metav1.Time `json:"end"`
+
+	// deadline the window was chosen for
+	Deadline metav1.Time `json:"deadline"`
+
+	// mean carbon intensity of the window in gCO2eq/kWh
+	CarbonIntensity int32 `json:"carbonIntensity"`
+}
+
+// ForecastMetadata represents the metadata written by the carbon intensity exporter to the forecast configmap
+type ForecastMetadata struct {
+	// latest time the exporter wrote the data
+	LastHeartbeatTime *metav1.Time `json:"lastHeartbeatTime,omitempty"`
+
+	// time the forecast was generated
+	ForecastDateTime *metav1.Time `json:"forecastDateTime,omitempty"`
+
+	// number of records in the forecast
+	NumOfRecords *int32 `json:"numOfRecords,omitempty"`
+
+	// additional information from the exporter
+	Message string `json:"message,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -0,0 +1,104 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CarbonIntensityForecastSpec defines the carbon intensity forecast of a location
+type CarbonIntensityForecastSpec struct {
+	// location of the carbon intensity forecast, e.g. eastus
+	// +kubebuilder:validation:Required
+	Location string `json:"location"`
+
+	// system or provider that produced the carbon intensity forecast, e.g. watttime
+	// +kubebuilder:validation:Optional
+	Source string `json:"source,omitempty"`
+
+	// time the carbon intensity forecast was generated
+	// +kubebuilder:validation:Optional
+	GeneratedAt *metav1.Time `json:"generatedAt,omitempty"`
+
+	// slots of the carbon intensity forecast
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	Slots []CarbonIntensitySlot `json:"slots"`
+}
+
+// CarbonIntensitySlot represents the forecasted carbon intensity of a period of time
+type CarbonIntensitySlot struct {
+	// start time of the slot
+	// +kubebuilder:validation:Required
+	Timestamp metav1.Time `json:"timestamp"`
+
+	// length of time in minutes the slot covers
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Minimum=1
+	DurationInMins int32 `json:"durationInMins"`
+
+	// forecasted carbon intensity in gCO2eq/kWh, e.g. 420 or 420.5
+	// +kubebuilder:validation:Required
+	Value resource.Quantity `json:"value"`
+}
+
+// CarbonIntensityForecastStatus defines the observed state of CarbonIntensityForecast
+type CarbonIntensityForecastStatus struct {
+	// carbon intensity of the slot covering the time of the last status update
+	CurrentIntensity *resource.Quantity `json:"currentIntensity,omitempty"`
+
+	// end time of the last slot
+	ForecastEnd *metav1.Time `json:"forecastEnd,omitempty"`
+
+	// length of time from the last status update until the end of the last slot, e.g. 23h
+	Horizon string `json:"horizon,omitempty"`
+
+	// generation of the spec the status was computed from
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:shortName=cif
+//+kubebuilder:printcolumn:name="Location",type=string,JSONPath=`.spec.location`
+//+kubebuilder:printcolumn:name="Current",type=string,JSONPath=`.status.currentIntensity`
+//+kubebuilder:printcolumn:name="Horizon",type=string,JSONPath=`.status.horizon`
+//+kubebuilder:printcolumn:name="Source",type=string,JSONPath=`.spec.source`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.spec.generatedAt`
+
+// CarbonIntensityForecast is the Schema for the carbonintensityforecasts API
+type CarbonIntensityForecast struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CarbonIntensityForecastSpec   `json:"spec,omitempty"`
+	Status CarbonIntensityForecastStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CarbonIntensityForecastList contains a list of CarbonIntensityForecast
+type CarbonIntensityForecastList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CarbonIntensityForecast `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CarbonIntensityForecast{}, &CarbonIntensityForecastList{})
+}
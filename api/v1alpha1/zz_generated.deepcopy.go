@@ -24,6 +24,7 @@ package v1alpha1
 import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
@@ -96,8 +97,38 @@ func (in *CarbonAwareKedaScalerSpec) DeepCopyInto(out *CarbonAwareKedaScalerSpec
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.RelativeThresholds != nil {
+		in, out := &in.RelativeThresholds, &out.RelativeThresholds
+		*out = new(RelativeThresholds)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PercentOfBaseline != nil {
+		in, out := &in.PercentOfBaseline, &out.PercentOfBaseline
+		*out = new(PercentOfBaseline)
+		(*in).DeepCopyInto(*out)
+	}
 	in.EcoModeOff.DeepCopyInto(&out.EcoModeOff)
-	out.CarbonIntensityForecastDataSource = in.CarbonIntensityForecastDataSource
+	in.CarbonIntensityForecastDataSource.DeepCopyInto(&out.CarbonIntensityForecastDataSource)
+	if in.RampPolicy != nil {
+		in, out := &in.RampPolicy, &out.RampPolicy
+		*out = new(RampPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LookAhead != nil {
+		in, out := &in.LookAhead, &out.LookAhead
+		*out = new(LookAhead)
+		**out = **in
+	}
+	if in.CarbonBudget != nil {
+		in, out := &in.CarbonBudget, &out.CarbonBudget
+		*out = new(CarbonBudget)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TimeShift != nil {
+		in, out := &in.TimeShift, &out.TimeShift
+		*out = new(TimeShift)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CarbonAwareKedaScalerSpec.
@@ -120,6 +151,61 @@ func (in *CarbonAwareKedaScalerStatus) DeepCopyInto(out *CarbonAwareKedaScalerSt
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.DetectedRegion != nil {
+		in, out := &in.DetectedRegion, &out.DetectedRegion
+		*out = new(DetectedRegion)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CarbonIntensityThresholds != nil {
+		in, out := &in.CarbonIntensityThresholds, &out.CarbonIntensityThresholds
+		*out = make([]CarbonIntensityConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CarbonIntensityBand != nil {
+		in, out := &in.CarbonIntensityBand, &out.CarbonIntensityBand
+		*out = new(CarbonIntensityBand)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LookAheadSlotTime != nil {
+		in, out := &in.LookAheadSlotTime, &out.LookAheadSlotTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CarbonBudget != nil {
+		in, out := &in.CarbonBudget, &out.CarbonBudget
+		*out = new(CarbonBudgetStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TimeShiftWindow != nil {
+		in, out := &in.TimeShiftWindow, &out.TimeShiftWindow
+		*out = new(TimeShiftWindow)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TargetMaxReplicas != nil {
+		in, out := &in.TargetMaxReplicas, &out.TargetMaxReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.AppliedMaxReplicas != nil {
+		in, out := &in.AppliedMaxReplicas, &out.AppliedMaxReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.LastRampStepTime != nil {
+		in, out := &in.LastRampStepTime, &out.LastRampStepTime
+		*out = (*in).DeepCopy()
+	}
+	if in.BaselineMaxReplicas != nil {
+		in, out := &in.BaselineMaxReplicas, &out.BaselineMaxReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ForecastMetadata != nil {
+		in, out := &in.ForecastMetadata, &out.ForecastMetadata
+		*out = new(ForecastMetadata)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CarbonAwareKedaScalerStatus.
@@ -132,6 +218,98 @@ func (in *CarbonAwareKedaScalerStatus) DeepCopy() *CarbonAwareKedaScalerStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CarbonAwareSdk) DeepCopyInto(out *CarbonAwareSdk) {
+	*out = *in
+	if in.AuthSecretRef != nil {
+		in, out := &in.AuthSecretRef, &out.AuthSecretRef
+		*out = new(SecretKeyRef)
+		**out = **in
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(TLSConfig)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CarbonAwareSdk.
+func (in *CarbonAwareSdk) DeepCopy() *CarbonAwareSdk {
+	if in == nil {
+		return nil
+	}
+	out := new(CarbonAwareSdk)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CarbonBudget) DeepCopyInto(out *CarbonBudget) {
+	*out = *in
+	out.Budget = in.Budget.DeepCopy()
+	out.WattsPerReplica = in.WattsPerReplica.DeepCopy()
+	if in.MinReplicas != nil {
+		in, out := &in.MinReplicas, &out.MinReplicas
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CarbonBudget.
+func (in *CarbonBudget) DeepCopy() *CarbonBudget {
+	if in == nil {
+		return nil
+	}
+	out := new(CarbonBudget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CarbonBudgetStatus) DeepCopyInto(out *CarbonBudgetStatus) {
+	*out = *in
+	in.PeriodStart.DeepCopyInto(&out.PeriodStart)
+	out.Used = in.Used.DeepCopy()
+	out.Projected = in.Projected.DeepCopy()
+	if in.MaxReplicas != nil {
+		in, out := &in.MaxReplicas, &out.MaxReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	in.ObservedTime.DeepCopyInto(&out.ObservedTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CarbonBudgetStatus.
+func (in *CarbonBudgetStatus) DeepCopy() *CarbonBudgetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CarbonBudgetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CarbonIntensityBand) DeepCopyInto(out *CarbonIntensityBand) {
+	*out = *in
+	if in.MaxReplicas != nil {
+		in, out := &in.MaxReplicas, &out.MaxReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	in.EnteredAt.DeepCopyInto(&out.EnteredAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CarbonIntensityBand.
+func (in *CarbonIntensityBand) DeepCopy() *CarbonIntensityBand {
+	if in == nil {
+		return nil
+	}
+	out := new(CarbonIntensityBand)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CarbonIntensityConfig) DeepCopyInto(out *CarbonIntensityConfig) {
 	*out = *in
@@ -140,6 +318,11 @@ func (in *CarbonIntensityConfig) DeepCopyInto(out *CarbonIntensityConfig) {
 		*out = new(int32)
 		**out = **in
 	}
+	if in.MaxReplicasPercent != nil {
+		in, out := &in.MaxReplicasPercent, &out.MaxReplicasPercent
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CarbonIntensityConfig.
@@ -167,10 +350,56 @@ func (in *CarbonIntensityDuration) DeepCopy() *CarbonIntensityDuration {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CarbonIntensityForecast) DeepCopyInto(out *CarbonIntensityForecast) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CarbonIntensityForecast.
+func (in *CarbonIntensityForecast) DeepCopy() *CarbonIntensityForecast {
+	if in == nil {
+		return nil
+	}
+	out := new(CarbonIntensityForecast)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CarbonIntensityForecast) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CarbonIntensityForecastDataSource) DeepCopyInto(out *CarbonIntensityForecastDataSource) {
 	*out = *in
-	out.LocalConfigMap = in.LocalConfigMap
+	in.CarbonIntensityForecastSource.DeepCopyInto(&out.CarbonIntensityForecastSource)
+	if in.Fallbacks != nil {
+		in, out := &in.Fallbacks, &out.Fallbacks
+		*out = make([]CarbonIntensityForecastSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Ensemble != nil {
+		in, out := &in.Ensemble, &out.Ensemble
+		*out = new(Ensemble)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RegionLocations != nil {
+		in, out := &in.RegionLocations, &out.RegionLocations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CarbonIntensityForecastDataSource.
@@ -183,6 +412,182 @@ func (in *CarbonIntensityForecastDataSource) DeepCopy() *CarbonIntensityForecast
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CarbonIntensityForecastList) DeepCopyInto(out *CarbonIntensityForecastList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CarbonIntensityForecast, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CarbonIntensityForecastList.
+func (in *CarbonIntensityForecastList) DeepCopy() *CarbonIntensityForecastList {
+	if in == nil {
+		return nil
+	}
+	out := new(CarbonIntensityForecastList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CarbonIntensityForecastList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CarbonIntensityForecastSource) DeepCopyInto(out *CarbonIntensityForecastSource) {
+	*out = *in
+	out.LocalConfigMap = in.LocalConfigMap
+	if in.MockCarbonForecast != nil {
+		in, out := &in.MockCarbonForecast, &out.MockCarbonForecast
+		*out = new(MockCarbonForecast)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CarbonAwareSdk != nil {
+		in, out := &in.CarbonAwareSdk, &out.CarbonAwareSdk
+		*out = new(CarbonAwareSdk)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.WattTime != nil {
+		in, out := &in.WattTime, &out.WattTime
+		*out = new(WattTime)
+		**out = **in
+	}
+	if in.ElectricityMaps != nil {
+		in, out := &in.ElectricityMaps, &out.ElectricityMaps
+		*out = new(ElectricityMaps)
+		**out = **in
+	}
+	if in.UkCarbonIntensity != nil {
+		in, out := &in.UkCarbonIntensity, &out.UkCarbonIntensity
+		*out = new(UkCarbonIntensity)
+		**out = **in
+	}
+	if in.Prometheus != nil {
+		in, out := &in.Prometheus, &out.Prometheus
+		*out = new(Prometheus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.StaticProfile != nil {
+		in, out := &in.StaticProfile, &out.StaticProfile
+		*out = new(StaticProfile)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Pushed != nil {
+		in, out := &in.Pushed, &out.Pushed
+		*out = new(Pushed)
+		**out = **in
+	}
+	if in.ForecastRef != nil {
+		in, out := &in.ForecastRef, &out.ForecastRef
+		*out = new(ForecastRef)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CarbonIntensityForecastSource.
+func (in *CarbonIntensityForecastSource) DeepCopy() *CarbonIntensityForecastSource {
+	if in == nil {
+		return nil
+	}
+	out := new(CarbonIntensityForecastSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CarbonIntensityForecastSpec) DeepCopyInto(out *CarbonIntensityForecastSpec) {
+	*out = *in
+	if in.GeneratedAt != nil {
+		in, out := &in.GeneratedAt, &out.GeneratedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.Slots != nil {
+		in, out := &in.Slots, &out.Slots
+		*out = make([]CarbonIntensitySlot, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CarbonIntensityForecastSpec.
+func (in *CarbonIntensityForecastSpec) DeepCopy() *CarbonIntensityForecastSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CarbonIntensityForecastSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CarbonIntensityForecastStatus) DeepCopyInto(out *CarbonIntensityForecastStatus) {
+	*out = *in
+	if in.CurrentIntensity != nil {
+		in, out := &in.CurrentIntensity, &out.CurrentIntensity
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.ForecastEnd != nil {
+		in, out := &in.ForecastEnd, &out.ForecastEnd
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CarbonIntensityForecastStatus.
+func (in *CarbonIntensityForecastStatus) DeepCopy() *CarbonIntensityForecastStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CarbonIntensityForecastStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CarbonIntensitySlot) DeepCopyInto(out *CarbonIntensitySlot) {
+	*out = *in
+	in.Timestamp.DeepCopyInto(&out.Timestamp)
+	out.Value = in.Value.DeepCopy()
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CarbonIntensitySlot.
+func (in *CarbonIntensitySlot) DeepCopy() *CarbonIntensitySlot {
+	if in == nil {
+		return nil
+	}
+	out := new(CarbonIntensitySlot)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DetectedRegion) DeepCopyInto(out *DetectedRegion) {
+	*out = *in
+	in.DetectedTime.DeepCopyInto(&out.DetectedTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DetectedRegion.
+func (in *DetectedRegion) DeepCopy() *DetectedRegion {
+	if in == nil {
+		return nil
+	}
+	out := new(DetectedRegion)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EcoModeOff) DeepCopyInto(out *EcoModeOff) {
 	*out = *in
@@ -209,6 +614,103 @@ func (in *EcoModeOff) DeepCopy() *EcoModeOff {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ElectricityMaps) DeepCopyInto(out *ElectricityMaps) {
+	*out = *in
+	out.AuthTokenSecretRef = in.AuthTokenSecretRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ElectricityMaps.
+func (in *ElectricityMaps) DeepCopy() *ElectricityMaps {
+	if in == nil {
+		return nil
+	}
+	out := new(ElectricityMaps)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Ensemble) DeepCopyInto(out *Ensemble) {
+	*out = *in
+	if in.Members != nil {
+		in, out := &in.Members, &out.Members
+		*out = make([]EnsembleMember, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Ensemble.
+func (in *Ensemble) DeepCopy() *Ensemble {
+	if in == nil {
+		return nil
+	}
+	out := new(Ensemble)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EnsembleMember) DeepCopyInto(out *EnsembleMember) {
+	*out = *in
+	in.CarbonIntensityForecastSource.DeepCopyInto(&out.CarbonIntensityForecastSource)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnsembleMember.
+func (in *EnsembleMember) DeepCopy() *EnsembleMember {
+	if in == nil {
+		return nil
+	}
+	out := new(EnsembleMember)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ForecastMetadata) DeepCopyInto(out *ForecastMetadata) {
+	*out = *in
+	if in.LastHeartbeatTime != nil {
+		in, out := &in.LastHeartbeatTime, &out.LastHeartbeatTime
+		*out = (*in).DeepCopy()
+	}
+	if in.ForecastDateTime != nil {
+		in, out := &in.ForecastDateTime, &out.ForecastDateTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NumOfRecords != nil {
+		in, out := &in.NumOfRecords, &out.NumOfRecords
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ForecastMetadata.
+func (in *ForecastMetadata) DeepCopy() *ForecastMetadata {
+	if in == nil {
+		return nil
+	}
+	out := new(ForecastMetadata)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ForecastRef) DeepCopyInto(out *ForecastRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ForecastRef.
+func (in *ForecastRef) DeepCopy() *ForecastRef {
+	if in == nil {
+		return nil
+	}
+	out := new(ForecastRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KedaTargetRef) DeepCopyInto(out *KedaTargetRef) {
 	*out = *in
@@ -239,6 +741,188 @@ func (in *LocalConfigMap) DeepCopy() *LocalConfigMap {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LookAhead) DeepCopyInto(out *LookAhead) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LookAhead.
+func (in *LookAhead) DeepCopy() *LookAhead {
+	if in == nil {
+		return nil
+	}
+	out := new(LookAhead)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MockCarbonForecast) DeepCopyInto(out *MockCarbonForecast) {
+	*out = *in
+	if in.Min != nil {
+		in, out := &in.Min, &out.Min
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Max != nil {
+		in, out := &in.Max, &out.Max
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TraceConfigMap != nil {
+		in, out := &in.TraceConfigMap, &out.TraceConfigMap
+		*out = new(LocalConfigMap)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MockCarbonForecast.
+func (in *MockCarbonForecast) DeepCopy() *MockCarbonForecast {
+	if in == nil {
+		return nil
+	}
+	out := new(MockCarbonForecast)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PercentOfBaseline) DeepCopyInto(out *PercentOfBaseline) {
+	*out = *in
+	if in.MinReplicas != nil {
+		in, out := &in.MinReplicas, &out.MinReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxReplicas != nil {
+		in, out := &in.MaxReplicas, &out.MaxReplicas
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PercentOfBaseline.
+func (in *PercentOfBaseline) DeepCopy() *PercentOfBaseline {
+	if in == nil {
+		return nil
+	}
+	out := new(PercentOfBaseline)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Prometheus) DeepCopyInto(out *Prometheus) {
+	*out = *in
+	if in.AuthSecretRef != nil {
+		in, out := &in.AuthSecretRef, &out.AuthSecretRef
+		*out = new(SecretKeyRef)
+		**out = **in
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(TLSConfig)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Prometheus.
+func (in *Prometheus) DeepCopy() *Prometheus {
+	if in == nil {
+		return nil
+	}
+	out := new(Prometheus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Pushed) DeepCopyInto(out *Pushed) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Pushed.
+func (in *Pushed) DeepCopy() *Pushed {
+	if in == nil {
+		return nil
+	}
+	out := new(Pushed)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RampPolicy) DeepCopyInto(out *RampPolicy) {
+	*out = *in
+	if in.MaxStepUp != nil {
+		in, out := &in.MaxStepUp, &out.MaxStepUp
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.MaxStepDown != nil {
+		in, out := &in.MaxStepDown, &out.MaxStepDown
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RampPolicy.
+func (in *RampPolicy) DeepCopy() *RampPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RampPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RelativeThreshold) DeepCopyInto(out *RelativeThreshold) {
+	*out = *in
+	if in.MaxReplicas != nil {
+		in, out := &in.MaxReplicas, &out.MaxReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxReplicasPercent != nil {
+		in, out := &in.MaxReplicasPercent, &out.MaxReplicasPercent
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RelativeThreshold.
+func (in *RelativeThreshold) DeepCopy() *RelativeThreshold {
+	if in == nil {
+		return nil
+	}
+	out := new(RelativeThreshold)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RelativeThresholds) DeepCopyInto(out *RelativeThresholds) {
+	*out = *in
+	if in.Thresholds != nil {
+		in, out := &in.Thresholds, &out.Thresholds
+		*out = make([]RelativeThreshold, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RelativeThresholds.
+func (in *RelativeThresholds) DeepCopy() *RelativeThresholds {
+	if in == nil {
+		return nil
+	}
+	out := new(RelativeThresholds)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Schedule) DeepCopyInto(out *Schedule) {
 	*out = *in
@@ -253,3 +937,137 @@ func (in *Schedule) DeepCopy() *Schedule {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretKeyRef) DeepCopyInto(out *SecretKeyRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretKeyRef.
+func (in *SecretKeyRef) DeepCopy() *SecretKeyRef {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretKeyRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretRef) DeepCopyInto(out *SecretRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretRef.
+func (in *SecretRef) DeepCopy() *SecretRef {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StaticProfile) DeepCopyInto(out *StaticProfile) {
+	*out = *in
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = make([]int32, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StaticProfile.
+func (in *StaticProfile) DeepCopy() *StaticProfile {
+	if in == nil {
+		return nil
+	}
+	out := new(StaticProfile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TLSConfig) DeepCopyInto(out *TLSConfig) {
+	*out = *in
+	if in.CASecretRef != nil {
+		in, out := &in.CASecretRef, &out.CASecretRef
+		*out = new(SecretKeyRef)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TLSConfig.
+func (in *TLSConfig) DeepCopy() *TLSConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(TLSConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TimeShift) DeepCopyInto(out *TimeShift) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TimeShift.
+func (in *TimeShift) DeepCopy() *TimeShift {
+	if in == nil {
+		return nil
+	}
+	out := new(TimeShift)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TimeShiftWindow) DeepCopyInto(out *TimeShiftWindow) {
+	*out = *in
+	in.Start.DeepCopyInto(&out.Start)
+	in.End.DeepCopyInto(&out.End)
+	in.Deadline.DeepCopyInto(&out.Deadline)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TimeShiftWindow.
+func (in *TimeShiftWindow) DeepCopy() *TimeShiftWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(TimeShiftWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UkCarbonIntensity) DeepCopyInto(out *UkCarbonIntensity) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UkCarbonIntensity.
+func (in *UkCarbonIntensity) DeepCopy() *UkCarbonIntensity {
+	if in == nil {
+		return nil
+	}
+	out := new(UkCarbonIntensity)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WattTime) DeepCopyInto(out *WattTime) {
+	*out = *in
+	out.CredentialsSecretRef = in.CredentialsSecretRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WattTime.
+func (in *WattTime) DeepCopy() *WattTime {
+	if in == nil {
+		return nil
+	}
+	out := new(WattTime)
+	in.DeepCopyInto(out)
+	return out
+}
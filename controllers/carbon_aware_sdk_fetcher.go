@@ -0,0 +1,90 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	carbonawarev1alpha1 "github.com/azure/carbon-aware-keda-operator/api/v1alpha1"
+)
+
+// carbonAwareSdkForecast is the subset of the EmissionsForecastDTO returned by the carbon aware sdk webapi
+type carbonAwareSdkForecast struct {
+	Location     string           `json:"location"`
+	ForecastData []CarbonForecast `json:"forecastData"`
+}
+
+// CarbonForecastCarbonAwareSdkFetcher is an implementation of CarbonForecastFetcher that fetches the carbon forecast from the carbon aware sdk webapi
+type CarbonForecastCarbonAwareSdkFetcher struct {
+	Client client.Reader
+	// Namespace is the namespace of the carbonawarekedascaler that secrets are read from
+	Namespace     string
+	HTTPClient    *http.Client
+	URL           string
+	Location      string
+	AuthSecretRef *carbonawarev1alpha1.SecretKeyRef
+	TLS           *carbonawarev1alpha1.TLSConfig
+}
+
+func (c *CarbonForecastCarbonAwareSdkFetcher) Fetch(ctx context.Context) ([]CarbonForecast, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid carbon aware sdk url: %w", err)
+	}
+	u.Path = path.Join(u.Path, "/emissions/forecasts/current")
+	q := u.Query()
+	q.Set("location", c.Location)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// pass the bearer token if the webapi sits behind an authenticating proxy
+	if c.AuthSecretRef != nil {
+		token, err := getSecretValue(ctx, c.Client, c.Namespace, c.AuthSecretRef)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient, err = newHTTPClient(ctx, c.Client, c.Namespace, c.TLS)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var forecasts []carbonAwareSdkForecast
+	if err = doJSONRequest(httpClient, req, &forecasts); err != nil {
+		return nil, err
+	}
+
+	// the webapi returns one forecast per location with the data points in the same shape as CarbonForecast
+	cf := make([]CarbonForecast, 0)
+	for _, forecast := range forecasts {
+		for _, data := range forecast.ForecastData {
+			data.Timestamp = data.Timestamp.UTC()
+			if data.Location == "" {
+				data.Location = forecast.Location
+			}
+			cf = append(cf, data)
+		}
+	}
+
+	if len(cf) == 0 {
+		return nil, fmt.Errorf("carbon aware sdk returned no forecast data for location %s", c.Location)
+	}
+
+	return cf, nil
+}
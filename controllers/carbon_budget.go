@@ -0,0 +1,207 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	carbonawarev1alpha1 "github.com/azure/carbon-aware-keda-operator/api/v1alpha1"
+)
+
+// label keda sets on the jobs of a scaledjob
+const scaledJobNameLabel = "scaledjob.keda.sh/name"
+
+// carbonBudgetPeriod returns the start and end of the period of the carbon budget the time falls in
+func carbonBudgetPeriod(period carbonawarev1alpha1.CarbonBudgetPeriod, now time.Time) (time.Time, time.Time) {
+	now = now.UTC()
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if period == carbonawarev1alpha1.CarbonBudgetPeriodWeek {
+		// weeks start on monday
+		start = start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+		return start, start.AddDate(0, 0, 7)
+	}
+	return start, start.AddDate(0, 0, 1)
+}
+
+/*
+accrueCarbonBudget returns the status of the carbon budget with the emissions since the last observation added:
+1. the replicas and carbon intensity of the last observation are assumed to have lasted until now
+2. emissions before the start of the current period are left out, a new period starts with nothing used
+3. the replicas and carbon intensity observed now are recorded for the next reconcile
+the emissions are projected to the end of the period with the replicas and carbon intensity observed now
+*/
+func accrueCarbonBudget(previous *carbonawarev1alpha1.CarbonBudgetStatus, budget carbonawarev1alpha1.CarbonBudget, now time.Time, replicas int32, intensity float64) *carbonawarev1alpha1.CarbonBudgetStatus {
+	periodStart, periodEnd := carbonBudgetPeriod(budget.Period, now)
+
+	used := 0.0
+	if previous != nil && previous.PeriodStart.Time.Equal(periodStart) {
+		used = previous.Used.AsApproximateFloat64()
+	}
+	if previous != nil && !previous.ObservedTime.IsZero() {
+		from := previous.ObservedTime.Time
+		if from.Before(periodStart) {
+			from = periodStart
+		}
+		if hours := now.Sub(from).Hours(); hours > 0 {
+			used += float64(previous.ObservedReplicas) * replicaKilowatts(budget) * hours * float64(previous.ObservedCarbonIntensity)
+		}
+	}
+
+	projected := used + float64(replicas)*replicaKilowatts(budget)*periodEnd.Sub(now).Hours()*intensity
+	return &carbonawarev1alpha1.CarbonBudgetStatus{
+		PeriodStart:             metav1.Time{Time: periodStart},
+		Used:                    *emissionsQuantity(used),
+		Projected:               *emissionsQuantity(projected),
+		ObservedTime:            metav1.Time{Time: now},
+		ObservedReplicas:        replicas,
+		ObservedCarbonIntensity: int32(math.Round(intensity)),
+	}
+}
+
+// carbonBudgetSlot is the part of a slot of the forecast left in the period of the carbon budget
+type carbonBudgetSlot struct {
+	forecast    *CarbonForecast
+	hours       float64
+	maxReplicas float64
+}
+
+/*
+planCarbonBudget returns the max replicas the rest of the carbon budget allows for the current slot of the sorted forecast:
+1. the rest of the budget is spread evenly over the rest of the period, the share for the time covered by the forecast is planned
+2. the slots of the forecast left in the period are given replicas greenest first, each up to its max replicas, until the share is spent
+3. the max replicas of the current slot is the number of replicas it was given, rounded down
+it also returns the emissions at the end of the period if the observed replicas keep running
+maxReplicasFor returns the max replicas of a slot without the budget
+*/
+func planCarbonBudget(forecast []CarbonForecast, now time.Time, status *carbonawarev1alpha1.CarbonBudgetStatus, budget carbonawarev1alpha1.CarbonBudget, maxReplicasFor func(*CarbonForecast) (*int32, error)) (int32, float64, error) {
+	_, periodEnd := carbonBudgetPeriod(budget.Period, now)
+	kilowatts := replicaKilowatts(budget)
+	used := status.Used.AsApproximateFloat64()
+
+	// the parts of the slots left in the period
+	var slots []carbonBudgetSlot
+	var currentForecast *CarbonForecast
+	var covered, coveredEmissions float64
+	for i := range forecast {
+		cf := &forecast[i]
+		start := cf.Timestamp
+		end := start.Add(time.Duration(cf.Duration) * time.Minute)
+		if start.Before(now) {
+			start = now
+		}
+		if end.After(periodEnd) {
+			end = periodEnd
+		}
+		if !end.After(start) {
+			continue
+		}
+
+		maxReplicas, err := maxReplicasFor(cf)
+		if err != nil {
+			return 0, 0, err
+		}
+		slot := carbonBudgetSlot{forecast: cf, hours: end.Sub(start).Hours()}
+		if maxReplicas != nil {
+			slot.maxReplicas = float64(*maxReplicas)
+		}
+		slots = append(slots, slot)
+		if !cf.Timestamp.After(now) {
+			currentForecast = cf
+		}
+		covered += slot.hours
+		coveredEmissions += slot.hours * cf.Value
+	}
+	if currentForecast == nil {
+		return 0, 0, fmt.Errorf("no carbon forecast for the current time in the budget period")
+	}
+
+	// project the observed replicas over the rest of the period, using the mean carbon intensity of the forecast beyond it
+	remainingHours := periodEnd.Sub(now).Hours()
+	projected := used + float64(status.ObservedReplicas)*kilowatts*coveredEmissions
+	if remainingHours > covered && covered > 0 {
+		projected += float64(status.ObservedReplicas) * kilowatts * (remainingHours - covered) * coveredEmissions / covered
+	}
+
+	share := budget.Budget.AsApproximateFloat64() - used
+	if share <= 0 {
+		return 0, projected, nil
+	}
+	if remainingHours > covered {
+		share *= covered / remainingHours
+	}
+
+	sort.SliceStable(slots, func(i, j int) bool {
+		return slots[i].forecast.Value < slots[j].forecast.Value
+	})
+	for _, slot := range slots {
+		perReplica := kilowatts * slot.hours * slot.forecast.Value
+		replicas := slot.maxReplicas
+		if perReplica > 0 && replicas*perReplica > share {
+			replicas = share / perReplica
+		}
+		share -= replicas * perReplica
+		if slot.forecast == currentForecast {
+			return int32(math.Floor(replicas)), projected, nil
+		}
+	}
+	return 0, projected, nil
+}
+
+// replicaKilowatts returns the power draw of a replica in kilowatts
+func replicaKilowatts(budget carbonawarev1alpha1.CarbonBudget) float64 {
+	return budget.WattsPerReplica.AsApproximateFloat64() / 1000
+}
+
+// emissionsQuantity returns the emissions in gCO2eq rounded to whole grams
+func emissionsQuantity(grams float64) *resource.Quantity {
+	return resource.NewQuantity(int64(math.Round(grams)), resource.DecimalSI)
+}
+
+// observedReplicas returns the number of running replicas of the keda target, the running pods of a scaledobject or the active jobs of a scaledjob
+func (r *CarbonAwareKedaScalerReconciler) observedReplicas(ctx context.Context, carbonAwareKedaScaler *carbonawarev1alpha1.CarbonAwareKedaScaler) (int32, error) {
+	namespace := carbonAwareKedaScaler.Spec.KedaTargetRef.Namespace
+	if strings.Contains(string(carbonAwareKedaScaler.Spec.KedaTarget), "scaledjob") {
+		jobs := &batchv1.JobList{}
+		err := r.apiReader().List(ctx, jobs, client.InNamespace(namespace), client.MatchingLabels{scaledJobNameLabel: carbonAwareKedaScaler.Spec.KedaTargetRef.Name})
+		if err != nil {
+			return 0, err
+		}
+		var active int32
+		for _, job := range jobs.Items {
+			active += job.Status.Active
+		}
+		return active, nil
+	}
+
+	selector, _, err := r.targetPodSelector(ctx, carbonAwareKedaScaler)
+	if err != nil {
+		return 0, err
+	}
+	if selector == nil {
+		return 0, fmt.Errorf("unable to find the pods of the scale target of the scaledobject")
+	}
+	pods := &corev1.PodList{}
+	err = r.apiReader().List(ctx, pods, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return 0, err
+	}
+	var running int32
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodRunning {
+			running++
+		}
+	}
+	return running, nil
+}
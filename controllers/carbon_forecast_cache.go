@@ -0,0 +1,47 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package controllers
+
+import (
+	"sync"
+	"time"
+)
+
+// cachedCarbonForecast is a forecast along with the time it was fetched
+type cachedCarbonForecast struct {
+	Forecast  []CarbonForecast
+	FetchedAt time.Time
+}
+
+// CarbonForecastCache keeps the last successfully fetched forecast of each source so it can be reused when the source is unavailable
+// it is shared by all carbonawarekedascalers and safe for concurrent use
+type CarbonForecastCache struct {
+	mu        sync.RWMutex
+	forecasts map[string]cachedCarbonForecast
+}
+
+// NewCarbonForecastCache returns an empty CarbonForecastCache
+func NewCarbonForecastCache() *CarbonForecastCache {
+	return &CarbonForecastCache{
+		forecasts: map[string]cachedCarbonForecast{},
+	}
+}
+
+// Set stores the forecast of a source
+func (c *CarbonForecastCache) Set(key string, cf []CarbonForecast, fetchedAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.forecasts[key] = cachedCarbonForecast{Forecast: cf, FetchedAt: fetchedAt}
+}
+
+// Get returns the forecast of a source if it was fetched no longer than maxAge ago
+func (c *CarbonForecastCache) Get(key string, maxAge time.Duration, now time.Time) ([]CarbonForecast, time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	cached, ok := c.forecasts[key]
+	if !ok || now.Sub(cached.FetchedAt) > maxAge {
+		return nil, time.Time{}, false
+	}
+	return cached.Forecast, cached.FetchedAt, true
+}
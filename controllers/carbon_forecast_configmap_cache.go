@@ -0,0 +1,156 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// how long a read waits for the informer of a configmap that is not cached yet to sync
+const configMapCacheSyncTimeout = 30 * time.Second
+
+// cachedConfigMap is the informer cache of a single configmap along with the function that stops it
+type cachedConfigMap struct {
+	cache  cache.Cache
+	cancel context.CancelFunc
+}
+
+/*
+CarbonForecastConfigMapCache serves the configmaps used as data sources from informers shared by every carbonawarekedascaler:
+1. the first read of a configmap starts an informer that only lists and watches that configmap
+2. later reads of the configmap, from any scaler, are served from the informer
+3. Prune stops the informers of configmaps that are no longer used
+so the data of other configmaps in the cluster is never cached and the api server is not read on every reconcile
+*/
+type CarbonForecastConfigMapCache struct {
+	// NewCache returns an unstarted cache of the configmap with the key
+	NewCache func(key types.NamespacedName) (cache.Cache, error)
+
+	mu     sync.Mutex
+	ctx    context.Context
+	caches map[types.NamespacedName]cachedConfigMap
+}
+
+// NewCarbonForecastConfigMapCache returns a CarbonForecastConfigMapCache that builds the cache of each configmap with a field selector on its name
+func NewCarbonForecastConfigMapCache(config *rest.Config, scheme *runtime.Scheme, mapper meta.RESTMapper) *CarbonForecastConfigMapCache {
+	return &CarbonForecastConfigMapCache{
+		NewCache: func(key types.NamespacedName) (cache.Cache, error) {
+			return cache.New(config, cache.Options{
+				Scheme:    scheme,
+				Mapper:    mapper,
+				Namespace: key.Namespace,
+				SelectorsByObject: cache.SelectorsByObject{
+					&corev1.ConfigMap{}: {Field: fields.OneTermEqualSelector("metadata.name", key.Name)},
+				},
+			})
+		},
+	}
+}
+
+// Start keeps the context the informers are started with and stops every informer when it is cancelled
+func (c *CarbonForecastConfigMapCache) Start(ctx context.Context) error {
+	c.mu.Lock()
+	c.ctx = ctx
+	c.mu.Unlock()
+
+	<-ctx.Done()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, cached := range c.caches {
+		cached.cancel()
+		delete(c.caches, key)
+	}
+	return nil
+}
+
+// NeedLeaderElection returns false so the cache is started before the controllers that read from it
+func (c *CarbonForecastConfigMapCache) NeedLeaderElection() bool {
+	return false
+}
+
+// Get reads a configmap from its informer, starting the informer on the first read
+func (c *CarbonForecastConfigMapCache) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	if _, ok := obj.(*corev1.ConfigMap); !ok {
+		return fmt.Errorf("the configmap cache cannot read %T", obj)
+	}
+
+	cached, err := c.cache(key)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, configMapCacheSyncTimeout)
+	defer cancel()
+	if !cached.WaitForCacheSync(ctx) {
+		return fmt.Errorf("timed out waiting for the cache of configmap %s to sync", key)
+	}
+	return cached.Get(ctx, key, obj, opts...)
+}
+
+// List is not supported since informers are only started for the configmaps that are read
+func (c *CarbonForecastConfigMapCache) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	return fmt.Errorf("the configmap cache cannot list %T", list)
+}
+
+// Prune stops the informers of the configmaps that are no longer used
+func (c *CarbonForecastConfigMapCache) Prune(inUse func(key types.NamespacedName) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, cached := range c.caches {
+		if !inUse(key) {
+			cached.cancel()
+			delete(c.caches, key)
+		}
+	}
+}
+
+// Len returns the number of configmaps with a running informer
+func (c *CarbonForecastConfigMapCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.caches)
+}
+
+// cache returns the running cache of the configmap, starting a new one when there is none
+func (c *CarbonForecastConfigMapCache) cache(key types.NamespacedName) (cache.Cache, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.caches[key]; ok {
+		return cached.cache, nil
+	}
+	if c.ctx == nil {
+		return nil, fmt.Errorf("the configmap cache has not been started")
+	}
+
+	newCache, err := c.NewCache(key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the cache of configmap %s: %w", key, err)
+	}
+	// the informer is registered before the cache starts so waiting for the cache to sync includes it
+	if _, err := newCache.GetInformer(c.ctx, &corev1.ConfigMap{}); err != nil {
+		return nil, fmt.Errorf("unable to create the informer of configmap %s: %w", key, err)
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	go func() {
+		_ = newCache.Start(ctx)
+	}()
+	if c.caches == nil {
+		c.caches = map[types.NamespacedName]cachedConfigMap{}
+	}
+	c.caches[key] = cachedConfigMap{cache: newCache, cancel: cancel}
+	return newCache, nil
+}
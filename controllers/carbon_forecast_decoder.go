@@ -0,0 +1,120 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package controllers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	carbonawarev1alpha1 "github.com/azure/carbon-aware-keda-operator/api/v1alpha1"
+)
+
+// maximum size of a decompressed forecast, well above a 7 day forecast in 5 minute slots
+const maxDecompressedForecastSize = 32 << 20
+
+// decodeCarbonForecast decodes the carbon forecast stored in a configmap in the given format
+// fromData is set when the payload was read from data rather than binaryData, in which case compressed payloads are base64 encoded
+func decodeCarbonForecast(payload []byte, format carbonawarev1alpha1.ConfigMapFormat, fromData bool) ([]CarbonForecast, error) {
+	switch format {
+	case "", carbonawarev1alpha1.ConfigMapFormatJSON:
+		return decodeJSONCarbonForecast(payload)
+	case carbonawarev1alpha1.ConfigMapFormatJSONGzip:
+		if fromData {
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(payload)))
+			if err != nil {
+				return nil, fmt.Errorf("json+gzip data must be base64 encoded when stored in data: %w", err)
+			}
+			payload = decoded
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip data: %w", err)
+		}
+		defer zr.Close()
+		decompressed, err := io.ReadAll(io.LimitReader(zr, maxDecompressedForecastSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip data: %w", err)
+		}
+		if len(decompressed) > maxDecompressedForecastSize {
+			return nil, fmt.Errorf("decompressed forecast is larger than %d bytes", maxDecompressedForecastSize)
+		}
+		return decodeJSONCarbonForecast(decompressed)
+	case carbonawarev1alpha1.ConfigMapFormatCSV:
+		return decodeCSVCarbonForecast(payload)
+	}
+	return nil, fmt.Errorf("unsupported forecast format %q", format)
+}
+
+func decodeJSONCarbonForecast(payload []byte) ([]CarbonForecast, error) {
+	var cf []CarbonForecast
+	if err := json.Unmarshal(payload, &cf); err != nil {
+		return nil, fmt.Errorf("invalid json forecast: %w", err)
+	}
+	return cf, nil
+}
+
+// decodeCSVCarbonForecast decodes timestamp,value,duration rows where the duration in minutes is optional
+// if any row has no duration, the duration of every row is derived from the timestamp of the next row
+func decodeCSVCarbonForecast(payload []byte) ([]CarbonForecast, error) {
+	r := csv.NewReader(bytes.NewReader(payload))
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv forecast: %w", err)
+	}
+
+	cf := make([]CarbonForecast, 0, len(records))
+	missingDuration := false
+	for i, record := range records {
+		// skip the header row
+		if i == 0 && strings.EqualFold(strings.TrimSpace(record[0]), "timestamp") {
+			continue
+		}
+		if len(record) < 2 || len(record) > 3 {
+			return nil, fmt.Errorf("invalid csv forecast: line %d must have timestamp,value,duration columns", i+1)
+		}
+
+		ts, err := time.Parse(time.RFC3339, strings.TrimSpace(record[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid csv forecast: line %d: invalid timestamp: %w", i+1, err)
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid csv forecast: line %d: invalid value: %w", i+1, err)
+		}
+
+		var duration int64
+		if len(record) == 3 && strings.TrimSpace(record[2]) != "" {
+			duration, err = strconv.ParseInt(strings.TrimSpace(record[2]), 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid csv forecast: line %d: invalid duration: %w", i+1, err)
+			}
+		} else {
+			missingDuration = true
+		}
+
+		cf = append(cf, CarbonForecast{
+			Timestamp: ts.UTC(),
+			Duration:  int32(duration),
+			Value:     value,
+		})
+	}
+
+	if missingDuration {
+		setDurationsFromTimestamps(cf, 60)
+	}
+
+	return cf, nil
+}
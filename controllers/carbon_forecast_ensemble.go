@@ -0,0 +1,299 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	carbonawarev1alpha1 "github.com/azure/carbon-aware-keda-operator/api/v1alpha1"
+)
+
+// CarbonForecastProvidersReporter is implemented by fetchers that combine the forecasts of several providers
+type CarbonForecastProvidersReporter interface {
+	// Providers returns the forecast of each provider that was used for the last forecast
+	Providers() map[string][]CarbonForecast
+}
+
+// EnsembleMemberFetcher is a member of an ensemble along with its weight and the unit of its values
+type EnsembleMemberFetcher struct {
+	NamedCarbonForecastFetcher
+	Weight int32
+	Unit   string
+}
+
+// ensembleForecast is the forecast returned by a member of an ensemble
+type ensembleForecast struct {
+	weight   float64
+	forecast []CarbonForecast
+}
+
+// CarbonForecastEnsembleFetcher is an implementation of CarbonForecastFetcher that combines the forecasts of several fetchers on a common time grid
+type CarbonForecastEnsembleFetcher struct {
+	Members    []EnsembleMemberFetcher
+	Method     carbonawarev1alpha1.EnsembleMethod
+	SlotLength int32
+	MinMembers int32
+	source     string
+	providers  map[string][]CarbonForecast
+}
+
+func (c *CarbonForecastEnsembleFetcher) Fetch(ctx context.Context) ([]CarbonForecast, error) {
+	c.source = ""
+	c.providers = nil
+
+	method := c.Method
+	if method == "" {
+		method = carbonawarev1alpha1.EnsembleMethodWeightedMean
+	}
+	minMembers := int(c.MinMembers)
+	if minMembers < 1 {
+		minMembers = 1
+	}
+
+	// values in different units cannot be combined, e.g. the lbs/MWh of watttime with the gCO2/kWh of other sources
+	for _, m := range c.Members {
+		if m.Unit != c.Members[0].Unit {
+			return nil, fmt.Errorf("ensemble members must use the same unit, %s is in %s and %s is in %s", c.Members[0].Name, c.Members[0].Unit, m.Name, m.Unit)
+		}
+	}
+
+	var forecasts []ensembleForecast
+	var names, failed []string
+	providers := map[string][]CarbonForecast{}
+	for _, m := range c.Members {
+		cf, err := m.Fetch(ctx)
+		if err == nil && len(cf) == 0 {
+			err = fmt.Errorf("no forecast data")
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", m.Name, err))
+			continue
+		}
+		weight := m.Weight
+		if weight < 1 {
+			weight = 1
+		}
+		forecasts = append(forecasts, ensembleForecast{weight: float64(weight), forecast: cf})
+		names = append(names, m.Name)
+		providers[m.Name] = cf
+	}
+
+	if len(forecasts) < minMembers {
+		return nil, fmt.Errorf("%d of %d ensemble members returned a forecast, %d required: %s", len(forecasts), len(c.Members), minMembers, strings.Join(failed, "; "))
+	}
+
+	cf := combineCarbonForecasts(forecasts, method, c.SlotLength, minMembers)
+	if len(cf) == 0 {
+		return nil, fmt.Errorf("no slot is covered by %d ensemble members", minMembers)
+	}
+
+	c.providers = providers
+	c.source = fmt.Sprintf("ensemble %s of %s", method, strings.Join(names, ", "))
+	if len(failed) > 0 {
+		c.source = fmt.Sprintf("%s (failed: %s)", c.source, strings.Join(failed, "; "))
+	}
+	return cf, nil
+}
+
+// Source returns a description of the members that were combined into the last forecast
+func (c *CarbonForecastEnsembleFetcher) Source() string {
+	return c.source
+}
+
+// Providers returns the forecast of each member that was combined into the last forecast
+func (c *CarbonForecastEnsembleFetcher) Providers() map[string][]CarbonForecast {
+	return c.providers
+}
+
+/*
+combineCarbonForecasts lines up the forecasts of the members on a common time grid and combines them with the method:
+1. the forecast of each member is split by location and normalized, so locations are combined separately
+2. the grid starts at the earliest slot of any member, aligned to the slot length, and ends with the last slot of any member
+3. each slot of the grid takes the mean of the slots of every member overlapping it, weighted by the overlap, so finer slots are averaged instead of sampled
+4. slots covered by fewer than minMembers members are left out
+slotLength defaults to the shortest median slot length of the members
+*/
+func combineCarbonForecasts(members []ensembleForecast, method carbonawarev1alpha1.EnsembleMethod, slotLength int32, minMembers int) []CarbonForecast {
+	// split each member by location
+	var shortest int32
+	locations := []string{}
+	byLocation := map[string][]ensembleForecast{}
+	for _, m := range members {
+		split := map[string][]CarbonForecast{}
+		for _, cf := range m.forecast {
+			if _, ok := byLocation[cf.Location]; !ok {
+				byLocation[cf.Location] = nil
+				locations = append(locations, cf.Location)
+			}
+			split[cf.Location] = append(split[cf.Location], cf)
+		}
+		for location, cfs := range split {
+			normalized, _ := normalizeCarbonForecast(cfs)
+			if len(normalized) == 0 {
+				continue
+			}
+			byLocation[location] = append(byLocation[location], ensembleForecast{weight: m.weight, forecast: normalized})
+			if length := medianSlotLength(normalized); shortest == 0 || length < shortest {
+				shortest = length
+			}
+		}
+	}
+	if slotLength <= 0 {
+		slotLength = shortest
+	}
+	if slotLength <= 0 {
+		slotLength = defaultSlotLength
+	}
+	sort.Strings(locations)
+
+	step := time.Duration(slotLength) * time.Minute
+	combined := []CarbonForecast{}
+	for _, location := range locations {
+		forecasts := byLocation[location]
+		if len(forecasts) < minMembers {
+			continue
+		}
+
+		var start, end time.Time
+		for _, m := range forecasts {
+			first, last := m.forecast[0], m.forecast[len(m.forecast)-1]
+			if start.IsZero() || first.Timestamp.Before(start) {
+				start = first.Timestamp
+			}
+			if lastEnd := last.Timestamp.Add(time.Duration(last.Duration) * time.Minute); lastEnd.After(end) {
+				end = lastEnd
+			}
+		}
+
+		// the index of the first slot of each member ending after the start of the current grid slot, both are sorted so it only moves forward
+		next := make([]int, len(forecasts))
+		for t := start.Truncate(step); t.Before(end); t = t.Add(step) {
+			var values, weights []float64
+			for i, m := range forecasts {
+				for next[i] < len(m.forecast) && !t.Before(m.forecast[next[i]].Timestamp.Add(time.Duration(m.forecast[next[i]].Duration)*time.Minute)) {
+					next[i]++
+				}
+				if value, ok := overlapMean(m.forecast[next[i]:], t, t.Add(step)); ok {
+					values = append(values, value)
+					weights = append(weights, m.weight)
+				}
+			}
+			if len(values) == 0 || len(values) < minMembers {
+				continue
+			}
+			combined = append(combined, CarbonForecast{
+				Location:  location,
+				Timestamp: t,
+				Duration:  slotLength,
+				Value:     combineValues(values, weights, method),
+			})
+		}
+	}
+	return combined
+}
+
+// overlapMean returns the mean of the sorted slots overlapping start to end weighted by the overlap and whether any slot overlaps
+func overlapMean(cfs []CarbonForecast, start time.Time, end time.Time) (float64, bool) {
+	var sum, covered float64
+	for _, cf := range cfs {
+		if !cf.Timestamp.Before(end) {
+			break
+		}
+		slotStart, slotEnd := cf.Timestamp, cf.Timestamp.Add(time.Duration(cf.Duration)*time.Minute)
+		if slotStart.Before(start) {
+			slotStart = start
+		}
+		if slotEnd.After(end) {
+			slotEnd = end
+		}
+		if overlap := slotEnd.Sub(slotStart).Seconds(); overlap > 0 {
+			sum += cf.Value * overlap
+			covered += overlap
+		}
+	}
+	if covered == 0 {
+		return 0, false
+	}
+	return sum / covered, true
+}
+
+// combineValues combines the values of the members covering a slot with the method
+func combineValues(values []float64, weights []float64, method carbonawarev1alpha1.EnsembleMethod) float64 {
+	switch method {
+	case carbonawarev1alpha1.EnsembleMethodMedian:
+		sorted := append([]float64{}, values...)
+		sort.Float64s(sorted)
+		if n := len(sorted); n%2 == 0 {
+			return (sorted[n/2-1] + sorted[n/2]) / 2
+		}
+		return sorted[len(sorted)/2]
+	case carbonawarev1alpha1.EnsembleMethodMax:
+		max := values[0]
+		for _, v := range values[1:] {
+			if v > max {
+				max = v
+			}
+		}
+		return max
+	case carbonawarev1alpha1.EnsembleMethodMin:
+		min := values[0]
+		for _, v := range values[1:] {
+			if v < min {
+				min = v
+			}
+		}
+		return min
+	}
+
+	var sum, totalWeight float64
+	for i, v := range values {
+		sum += v * weights[i]
+		totalWeight += weights[i]
+	}
+	return sum / totalWeight
+}
+
+// newEnsembleFetcher returns a description and the fetcher of an ensemble, members without a source are skipped
+func (r *CarbonAwareKedaScalerReconciler) newEnsembleFetcher(namespace string, ensemble carbonawarev1alpha1.Ensemble) (string, CarbonForecastFetcher) {
+	fetcher := &CarbonForecastEnsembleFetcher{
+		Method:     ensemble.Method,
+		SlotLength: ensemble.SlotLengthInMins,
+		MinMembers: ensemble.MinMembers,
+	}
+	if fetcher.Method == "" {
+		fetcher.Method = carbonawarev1alpha1.EnsembleMethodWeightedMean
+	}
+	for i, member := range ensemble.Members {
+		name, f := r.newCarbonForecastFetcher(namespace, member.CarbonIntensityForecastSource)
+		if f == nil {
+			continue
+		}
+		if member.Name != "" {
+			name = member.Name
+		} else {
+			name = fmt.Sprintf("members[%d] %s", i, name)
+		}
+		fetcher.Members = append(fetcher.Members, EnsembleMemberFetcher{
+			NamedCarbonForecastFetcher: NamedCarbonForecastFetcher{Name: name, CarbonForecastFetcher: f},
+			Weight:                     member.Weight,
+			Unit:                       carbonForecastUnit(member.CarbonIntensityForecastSource),
+		})
+	}
+	return fmt.Sprintf("ensemble %s", fetcher.Method), fetcher
+}
+
+// carbonForecastUnit returns the unit of the values of a source, which is gCO2/kWh for every source but watttime
+func carbonForecastUnit(src carbonawarev1alpha1.CarbonIntensityForecastSource) string {
+	if src.WattTime == nil {
+		return "gCO2/kWh"
+	}
+	if src.WattTime.Signal == carbonawarev1alpha1.WattTimeSignalPercent {
+		return "percent"
+	}
+	return "lbs/MWh"
+}
@@ -6,14 +6,21 @@ package controllers
 import (
 	"context"
 	"encoding/json"
-	"math/rand"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	carbonawarev1alpha1 "github.com/azure/carbon-aware-keda-operator/api/v1alpha1"
 )
 
 type CarbonForecast struct {
@@ -32,40 +39,206 @@ func findCarbonForecast(cfs []CarbonForecast, t time.Time) *CarbonForecast {
 	return nil
 }
 
+// setDurationsFromTimestamps sorts the forecast by timestamp and sets the duration of each slot to the minutes until the next slot
+// the last slot reuses the duration of the previous slot or defaultDuration if there is only one slot
+func setDurationsFromTimestamps(cfs []CarbonForecast, defaultDuration int32) {
+	sort.Slice(cfs, func(i, j int) bool {
+		return cfs[i].Timestamp.Before(cfs[j].Timestamp)
+	})
+
+	for i := range cfs {
+		switch {
+		case i < len(cfs)-1:
+			cfs[i].Duration = int32(cfs[i+1].Timestamp.Sub(cfs[i].Timestamp).Minutes())
+		case i > 0:
+			cfs[i].Duration = cfs[i-1].Duration
+		default:
+			cfs[i].Duration = defaultDuration
+		}
+	}
+}
+
 type CarbonForecastFetcher interface {
 	Fetch(ctx context.Context) ([]CarbonForecast, error)
 }
 
+// CarbonForecastMetadataReporter is implemented by fetchers that can report the exporter metadata of the last forecast
+type CarbonForecastMetadataReporter interface {
+	Metadata() *carbonawarev1alpha1.ForecastMetadata
+}
+
+// StaleForecastError is returned when the forecast data is older than the configured maximum age or has no records
+type StaleForecastError struct {
+	Source string
+	Reason string
+}
+
+func (e *StaleForecastError) Error() string {
+	return fmt.Sprintf("stale carbon forecast in %s: %s", e.Source, e.Reason)
+}
+
+// isStaleForecastError returns true if the error or any error it wraps is a StaleForecastError
+func isStaleForecastError(err error) bool {
+	var staleErr *StaleForecastError
+	return errors.As(err, &staleErr)
+}
+
+// forecastGeneratedAt returns when the forecast was generated, falling back to the heartbeat when the exporter does not set it
+func forecastGeneratedAt(md *carbonawarev1alpha1.ForecastMetadata) *metav1.Time {
+	if md == nil {
+		return nil
+	}
+	if md.ForecastDateTime != nil {
+		return md.ForecastDateTime
+	}
+	return md.LastHeartbeatTime
+}
+
 // CarbonForecastConfigMapFetcher is an implementation of CarbonForecastFetcher that fetches the carbon forecast from a configmap
+// the controller reads configmaps through CarbonForecastConfigMapCache so every scaler using a configmap shares one informer
 type CarbonForecastConfigMapFetcher struct {
-	Client             client.Client
+	Client             client.Reader
 	ConfigMapName      string
 	ConfigMapNamespace string
 	ConfigMapKey       string
+	// MaxDataAge rejects forecasts generated longer ago than this when set
+	MaxDataAge time.Duration
+	// Format of the forecast stored under the key, defaults to json
+	Format carbonawarev1alpha1.ConfigMapFormat
+
+	metadata *carbonawarev1alpha1.ForecastMetadata
 }
 
 func (c *CarbonForecastConfigMapFetcher) Fetch(ctx context.Context) ([]CarbonForecast, error) {
+	c.metadata = nil
+
 	// load the carbonForecastConfigMap
 	cm := &corev1.ConfigMap{}
 	err := c.Client.Get(ctx, types.NamespacedName{Name: c.ConfigMapName, Namespace: c.ConfigMapNamespace}, cm)
-	if err != nil && errors.IsNotFound(err) {
+	if err != nil {
 		return nil, err
 	}
 
-	// unmarshal the configmap data into a map
-	var cf []CarbonForecast
-	err = json.Unmarshal([]byte(cm.BinaryData[c.ConfigMapKey]), &cf)
+	// read the metadata written by the exporter and reject the data if it is stale
+	c.metadata, err = parseForecastMetadata(cm.Data)
 	if err != nil {
 		return nil, err
 	}
+	if err = c.checkStaleness(time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	// the forecast may be stored in binaryData or, when it is small enough or hand edited, in data
+	payload, fromBinaryData := cm.BinaryData[c.ConfigMapKey]
+	if !fromBinaryData {
+		data, ok := cm.Data[c.ConfigMapKey]
+		if !ok {
+			return nil, fmt.Errorf("key %s not found in data or binaryData of configmap %s/%s", c.ConfigMapKey, c.ConfigMapNamespace, c.ConfigMapName)
+		}
+		payload = []byte(data)
+	}
+
+	cf, err := decodeCarbonForecast(payload, c.Format, !fromBinaryData)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode key %s of configmap %s/%s: %w", c.ConfigMapKey, c.ConfigMapNamespace, c.ConfigMapName, err)
+	}
 
 	return cf, nil
 }
 
+// Metadata returns the exporter metadata read by the last fetch
+func (c *CarbonForecastConfigMapFetcher) Metadata() *carbonawarev1alpha1.ForecastMetadata {
+	return c.metadata
+}
+
+// checkStaleness returns a StaleForecastError if the exporter reported no records or the data is older than the maximum age
+func (c *CarbonForecastConfigMapFetcher) checkStaleness(now time.Time) error {
+	source := fmt.Sprintf("configmap %s/%s", c.ConfigMapNamespace, c.ConfigMapName)
+
+	if c.metadata.NumOfRecords != nil && *c.metadata.NumOfRecords == 0 {
+		reason := "exporter reported zero records"
+		if c.metadata.Message != "" {
+			reason = fmt.Sprintf("%s: %s", reason, c.metadata.Message)
+		}
+		return &StaleForecastError{Source: source, Reason: reason}
+	}
+
+	if c.MaxDataAge <= 0 {
+		return nil
+	}
+
+	generated := forecastGeneratedAt(c.metadata)
+	if generated == nil {
+		return &StaleForecastError{Source: source, Reason: "forecastDateTime and lastHeartbeatTime are missing"}
+	}
+	if age := now.Sub(generated.Time); age > c.MaxDataAge {
+		return &StaleForecastError{Source: source, Reason: fmt.Sprintf("data is %s old which is older than %s", age.Round(time.Second), c.MaxDataAge)}
+	}
+
+	return nil
+}
+
+// layouts the exporter may use for its timestamps
+var forecastMetadataTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+}
+
+// parseForecastMetadata reads lastHeartbeatTime, forecastDateTime, numOfRecords and message from the configmap data
+func parseForecastMetadata(data map[string]string) (*carbonawarev1alpha1.ForecastMetadata, error) {
+	md := &carbonawarev1alpha1.ForecastMetadata{
+		Message: strings.TrimSpace(data["message"]),
+	}
+
+	var err error
+	if md.LastHeartbeatTime, err = parseForecastMetadataTime(data, "lastHeartbeatTime"); err != nil {
+		return nil, err
+	}
+	if md.ForecastDateTime, err = parseForecastMetadataTime(data, "forecastDateTime"); err != nil {
+		return nil, err
+	}
+
+	if v := strings.TrimSpace(data["numOfRecords"]); v != "" {
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid numOfRecords %q: %w", v, err)
+		}
+		numOfRecords := int32(n)
+		md.NumOfRecords = &numOfRecords
+	}
+
+	return md, nil
+}
+
+func parseForecastMetadataTime(data map[string]string, key string) (*metav1.Time, error) {
+	v := strings.TrimSpace(data[key])
+	if v == "" {
+		return nil, nil
+	}
+	for _, layout := range forecastMetadataTimeLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			return &metav1.Time{Time: t.UTC()}, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid %s %q", key, v)
+}
+
+const (
+	// annotation on the mock configmap holding the configuration the forecast was generated with
+	mockCarbonForecastAnnotation = "carbonaware.kubernetes.azure.com/mock-carbon-forecast"
+
+	// annotation on the mock configmap holding the time the replayed trace started
+	mockReplayStartAnnotation = "carbonaware.kubernetes.azure.com/mock-replay-start"
+)
+
 // CarbonForecastMockConfigMapFetcher is an implementation of CarbonForecastFetcher that creates and fetches a mock configmap
 type CarbonForecastMockConfigMapFetcher struct {
-	Client         client.Client
+	Client client.Client
+	// Reader reads the mock and trace configmaps, the client is used when it is nil
+	Reader         client.Reader
 	CarbonForecast []CarbonForecast
+	// Config of the generated forecast, defaults are applied to unset fields
+	Config carbonawarev1alpha1.MockCarbonForecast
 }
 
 func (c *CarbonForecastMockConfigMapFetcher) Fetch(ctx context.Context) ([]CarbonForecast, error) {
@@ -74,58 +247,195 @@ func (c *CarbonForecastMockConfigMapFetcher) Fetch(ctx context.Context) ([]Carbo
 		return c.CarbonForecast, nil
 	}
 
-	// if the configmap does not exist, create it
-	configMapName := "mock-carbon-intensity"
-	configMapNamespace := "kube-system"
+	config := defaultMockCarbonForecast(c.Config)
+	if *config.Min > *config.Max {
+		return nil, fmt.Errorf("mock carbon forecast min %d must not be greater than max %d", *config.Min, *config.Max)
+	}
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
 	configMapKey := "data"
+	now := time.Now().UTC()
 
+	// reuse the configmap while it was generated with the same configuration and covers the next day
+	// a trace that is not looped is kept until the configuration changes so it ends rather than restarting
 	cm := &corev1.ConfigMap{}
-	err := c.Client.Get(ctx, types.NamespacedName{Name: configMapName, Namespace: configMapNamespace}, cm)
-	if err != nil {
-		// create a new dynamically sized array of CarbonForecast
-		c.CarbonForecast = make([]CarbonForecast, 0)
-
-		// for 24 hours in the past and 7 days in the future loop at each 5 min increment and add a carbon intensity value
-		for i := -24; i < 7*24*12; i++ {
-			// generate a random number between 529 and 580
-			rand.Seed(time.Now().UnixNano())
-			c.CarbonForecast = append(c.CarbonForecast, CarbonForecast{
-				Timestamp: time.Now().UTC().Add(time.Duration(i*5) * time.Minute),
-				Value:     rand.Float64()*51 + 529,
-				Duration:  5,
-			})
+	err = c.reader().Get(ctx, types.NamespacedName{Name: config.ConfigMapName, Namespace: config.ConfigMapNamespace}, cm)
+	exists := err == nil
+	unchanged := exists && cm.Annotations[mockCarbonForecastAnnotation] == string(configJSON)
+	replayOnce := config.Profile == carbonawarev1alpha1.MockProfileReplay && !config.Loop
+	if unchanged {
+		var cf []CarbonForecast
+		if err = json.Unmarshal(cm.BinaryData[configMapKey], &cf); err == nil && len(cf) > 0 && (replayOnce || findCarbonForecast(cf, now.Add(24*time.Hour)) != nil) {
+			return cf, nil
 		}
+	}
 
-		// marshal the carbon forecast into byte array
-		forecast, err := json.Marshal(c.CarbonForecast)
+	// generate 2 hours in the past and 7 days in the future
+	start := now.Truncate(time.Duration(config.SlotLengthInMins) * time.Minute).Add(-2 * time.Hour)
+	var cf []CarbonForecast
+	if config.Profile == carbonawarev1alpha1.MockProfileReplay {
+		trace, err := c.loadTrace(ctx, config)
 		if err != nil {
-			return nil, err
-		}
-
-		// create a configmap and pass carbon forecast as binary data
-		cm = &corev1.ConfigMap{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      configMapName,
-				Namespace: configMapNamespace,
-			},
-			BinaryData: map[string][]byte{
-				configMapKey: forecast,
-			},
+			return nil, fmt.Errorf("unable to load mock carbon forecast trace: %w", err)
 		}
 
-		// create or update the configmap
-		if err = c.Client.Create(ctx, cm); err != nil {
-			if err = c.Client.Update(ctx, cm); err != nil {
-				return nil, err
+		// a looped trace keeps the time it started so the loop continues when more data is generated
+		anchor := now.Truncate(time.Duration(config.SlotLengthInMins) * time.Minute)
+		if unchanged {
+			if t, err := time.Parse(time.RFC3339, cm.Annotations[mockReplayStartAnnotation]); err == nil {
+				anchor = t
 			}
 		}
+		cf = replayCarbonForecast(trace, anchor, config.Loop, start, start.Add(7*24*time.Hour))
+		if cm.Annotations == nil {
+			cm.Annotations = map[string]string{}
+		}
+		cm.Annotations[mockReplayStartAnnotation] = anchor.Format(time.RFC3339)
 	} else {
-		// unmarshal the configmap data into a map
-		err = json.Unmarshal([]byte(cm.BinaryData[configMapKey]), &c.CarbonForecast)
-		if err != nil {
-			return nil, err
+		cf = generateMockCarbonForecast(config, start, start.Add(7*24*time.Hour))
+	}
+
+	// marshal the carbon forecast into byte array
+	forecast, err := json.Marshal(cf)
+	if err != nil {
+		return nil, err
+	}
+
+	// create or update the configmap and pass carbon forecast as binary data
+	cm.Name = config.ConfigMapName
+	cm.Namespace = config.ConfigMapNamespace
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	cm.Annotations[mockCarbonForecastAnnotation] = string(configJSON)
+	cm.BinaryData = map[string][]byte{
+		configMapKey: forecast,
+	}
+	if exists {
+		err = c.Client.Update(ctx, cm)
+	} else {
+		err = c.Client.Create(ctx, cm)
+	}
+	// the cache may not have seen the last write yet, the forecast written then was generated from the same configuration
+	if err != nil && !apierrors.IsConflict(err) && !apierrors.IsAlreadyExists(err) {
+		return nil, err
+	}
+
+	return cf, nil
+}
+
+// reader returns the reader of the mock and trace configmaps
+func (c *CarbonForecastMockConfigMapFetcher) reader() client.Reader {
+	if c.Reader != nil {
+		return c.Reader
+	}
+	return c.Client
+}
+
+// mockRandom returns a number in [0, 1) that only depends on the seed and the time of the slot, using the splitmix64 finalizer
+func mockRandom(seed int64, unix int64) float64 {
+	x := uint64(seed) ^ uint64(unix)
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	x ^= x >> 31
+	return float64(x>>11) / (1 << 53)
+}
+
+// defaultMockCarbonForecast applies the defaults of the crd to unset fields
+func defaultMockCarbonForecast(config carbonawarev1alpha1.MockCarbonForecast) carbonawarev1alpha1.MockCarbonForecast {
+	if config.Profile == "" {
+		config.Profile = carbonawarev1alpha1.MockProfileRandom
+	}
+	// min and max are pointers so an explicit 0 is not replaced by the default
+	if config.Min == nil {
+		defaultMin := int32(529)
+		config.Min = &defaultMin
+	}
+	if config.Max == nil {
+		defaultMax := int32(580)
+		config.Max = &defaultMax
+	}
+	if config.PeriodInMins <= 0 {
+		config.PeriodInMins = 24 * 60
+	}
+	if config.SlotLengthInMins <= 0 {
+		config.SlotLengthInMins = 5
+	}
+	if config.ConfigMapName == "" {
+		config.ConfigMapName = "mock-carbon-intensity"
+	}
+	if config.ConfigMapNamespace == "" {
+		config.ConfigMapNamespace = "kube-system"
+	}
+	return config
+}
+
+// generateMockCarbonForecast returns slots from start until end whose values only depend on the configuration and the time of the slot
+func generateMockCarbonForecast(config carbonawarev1alpha1.MockCarbonForecast, start time.Time, end time.Time) []CarbonForecast {
+	slotLength := time.Duration(config.SlotLengthInMins) * time.Minute
+	period := time.Duration(config.PeriodInMins) * time.Minute
+	low, high := float64(*config.Min), float64(*config.Max)
+
+	cf := make([]CarbonForecast, 0, int(end.Sub(start)/slotLength))
+	for ts := start; ts.Before(end); ts = ts.Add(slotLength) {
+		// position of the slot within the current period counted from the unix epoch, so cycles continue across midnight
+		// even when the period does not divide a day
+		phase := float64(time.Duration(ts.UnixNano())%period) / float64(period)
+
+		var value float64
+		switch config.Profile {
+		case carbonawarev1alpha1.MockProfileSine:
+			value = low + (high-low)*(1+math.Sin(2*math.Pi*phase))/2
+		case carbonawarev1alpha1.MockProfileStep:
+			value = low
+			if phase >= 0.5 {
+				value = high
+			}
+		case carbonawarev1alpha1.MockProfileConstant:
+			value = (low + high) / 2
+		default:
+			value = low + (high-low)*mockRandom(config.Seed, ts.Unix())
 		}
+
+		cf = append(cf, CarbonForecast{
+			Timestamp: ts,
+			Value:     value,
+			Duration:  config.SlotLengthInMins,
+		})
 	}
+	return cf
+}
 
-	return c.CarbonForecast, nil
+// CarbonForecastStaticProfileFetcher is an implementation of CarbonForecastFetcher that repeats a fixed daily profile
+type CarbonForecastStaticProfileFetcher struct {
+	Values     []int32
+	SlotLength int32
+}
+
+func (c *CarbonForecastStaticProfileFetcher) Fetch(ctx context.Context) ([]CarbonForecast, error) {
+	if len(c.Values) == 0 {
+		return nil, fmt.Errorf("static profile has no values")
+	}
+	slotLength := c.SlotLength
+	if slotLength <= 0 {
+		slotLength = 60
+	}
+
+	// repeat the profile from the start of yesterday until the end of tomorrow so look backs and look aheads are covered
+	midnight := time.Now().UTC().Truncate(24 * time.Hour)
+	cf := make([]CarbonForecast, 0)
+	for ts := midnight.Add(-24 * time.Hour); ts.Before(midnight.Add(48 * time.Hour)); ts = ts.Add(time.Duration(slotLength) * time.Minute) {
+		// find the index of the value for the time of day
+		slot := int(ts.Sub(ts.Truncate(24*time.Hour)).Minutes()) / int(slotLength)
+		cf = append(cf, CarbonForecast{
+			Timestamp: ts,
+			Duration:  slotLength,
+			Value:     float64(c.Values[slot%len(c.Values)]),
+		})
+	}
+
+	return cf, nil
 }
@@ -0,0 +1,146 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package controllers
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// default slot length in minutes when the forecast has nothing to derive it from
+const defaultSlotLength = 60
+
+/*
+normalizeCarbonForecast validates the forecast returned by a fetcher and returns a copy that findCarbonForecast and getRequeueDuration can rely on,
+along with a description of every problem that was found:
+1. slots with a non-finite value or without a timestamp are dropped
+2. slots are sorted by timestamp
+3. slots that share a timestamp are merged into one slot with their mean value
+4. slots without a positive duration get the median slot length of the forecast
+5. slots that overlap the next slot are truncated to end where the next slot starts
+6. gaps between slots are reported
+*/
+func normalizeCarbonForecast(cfs []CarbonForecast) ([]CarbonForecast, []string) {
+	var issues []string
+
+	// drop slots that can never be matched or compared
+	valid := make([]CarbonForecast, 0, len(cfs))
+	for _, cf := range cfs {
+		if math.IsNaN(cf.Value) || math.IsInf(cf.Value, 0) || cf.Timestamp.IsZero() {
+			continue
+		}
+		cf.Timestamp = cf.Timestamp.UTC()
+		valid = append(valid, cf)
+	}
+	if dropped := len(cfs) - len(valid); dropped > 0 {
+		issues = append(issues, fmt.Sprintf("dropped %d slots with a non-finite value or no timestamp", dropped))
+	}
+
+	sort.SliceStable(valid, func(i, j int) bool {
+		return valid[i].Timestamp.Before(valid[j].Timestamp)
+	})
+
+	// merge slots that share a timestamp, keeping the longest duration
+	merged := make([]CarbonForecast, 0, len(valid))
+	counts := make([]int, 0, len(valid))
+	for _, cf := range valid {
+		if n := len(merged); n > 0 && merged[n-1].Timestamp.Equal(cf.Timestamp) {
+			counts[n-1]++
+			merged[n-1].Value += (cf.Value - merged[n-1].Value) / float64(counts[n-1])
+			if cf.Duration > merged[n-1].Duration {
+				merged[n-1].Duration = cf.Duration
+			}
+			continue
+		}
+		merged = append(merged, cf)
+		counts = append(counts, 1)
+	}
+	if duplicates := len(valid) - len(merged); duplicates > 0 {
+		issues = append(issues, fmt.Sprintf("merged %d slots that share a timestamp with another slot", duplicates))
+	}
+
+	// a slot without a duration is never matched and breaks the requeue interval
+	missing := 0
+	for _, cf := range merged {
+		if cf.Duration <= 0 {
+			missing++
+		}
+	}
+	if missing > 0 {
+		median := medianSlotLength(merged)
+		for i := range merged {
+			if merged[i].Duration <= 0 {
+				merged[i].Duration = median
+			}
+		}
+		issues = append(issues, fmt.Sprintf("set the duration of %d slots to the median slot length of %d minutes", missing, median))
+	}
+
+	// truncate overlapping slots and look for gaps
+	normalized := make([]CarbonForecast, 0, len(merged))
+	truncated, gaps := 0, 0
+	var largestGap time.Duration
+	var largestGapStart time.Time
+	for i, cf := range merged {
+		if i < len(merged)-1 {
+			end := cf.Timestamp.Add(time.Duration(cf.Duration) * time.Minute)
+			next := merged[i+1].Timestamp
+			if end.After(next) {
+				truncated++
+				cf.Duration = int32(next.Sub(cf.Timestamp).Minutes())
+				// slots shorter than a minute cannot be represented so they are dropped
+				if cf.Duration <= 0 {
+					continue
+				}
+				end = cf.Timestamp.Add(time.Duration(cf.Duration) * time.Minute)
+			}
+			if gap := next.Sub(end); gap >= time.Minute {
+				gaps++
+				if gap > largestGap {
+					largestGap, largestGapStart = gap, end
+				}
+			}
+		}
+		normalized = append(normalized, cf)
+	}
+	if truncated > 0 {
+		issues = append(issues, fmt.Sprintf("truncated %d slots that overlap the next slot", truncated))
+	}
+	if gaps > 0 {
+		issues = append(issues, fmt.Sprintf("found %d gaps between slots, the largest is %s from %s", gaps, largestGap, largestGapStart.Format(time.RFC3339)))
+	}
+
+	if len(normalized) == 0 && len(cfs) > 0 {
+		issues = append(issues, "no valid slots left")
+	}
+
+	return normalized, issues
+}
+
+// medianSlotLength returns the median of the positive durations in the forecast, or of the time between slots if none have a duration
+func medianSlotLength(cfs []CarbonForecast) int32 {
+	lengths := make([]int32, 0, len(cfs))
+	for _, cf := range cfs {
+		if cf.Duration > 0 {
+			lengths = append(lengths, cf.Duration)
+		}
+	}
+	if len(lengths) == 0 {
+		for i := 1; i < len(cfs); i++ {
+			if length := int32(cfs[i].Timestamp.Sub(cfs[i-1].Timestamp).Minutes()); length > 0 {
+				lengths = append(lengths, length)
+			}
+		}
+	}
+	if len(lengths) == 0 {
+		return defaultSlotLength
+	}
+
+	sort.Slice(lengths, func(i, j int) bool {
+		return lengths[i] < lengths[j]
+	})
+	return lengths[len(lengths)/2]
+}
@@ -0,0 +1,285 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	carbonawarev1alpha1 "github.com/azure/carbon-aware-keda-operator/api/v1alpha1"
+)
+
+// default maximum size of a pushed forecast, well above a 7 day forecast in 5 minute slots
+const defaultMaxPushedForecastSize = 4 << 20
+
+// source of the carbonintensityforecasts written by the forecast push endpoint
+const pushedForecastSource = "forecast push endpoint"
+
+// pushedForecastName returns the name of the carbonintensityforecast a forecast pushed for the location is stored in
+// locations are case insensitive and characters that are not allowed in names are replaced with dashes
+func pushedForecastName(location string) string {
+	name := []rune("pushed-" + strings.ToLower(location))
+	for i, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' && c != '.' {
+			name[i] = '-'
+		}
+	}
+	return strings.TrimRight(string(name), "-.")
+}
+
+/*
+CarbonForecastPushServer serves POST /forecasts/{location} to push the carbon forecast of a location as a json array of carbon forecasts
+1. requests must send the token stored in the token secret as a bearer token
+2. bodies larger than MaxBodySize are rejected
+3. the forecast must have at least one slot, every slot needs a timestamp, a non-negative value and duration, and no other location
+4. the normalized forecast replaces the previous forecast of the location in the carbonintensityforecast named by pushedForecastName in Namespace,
+so it survives restarts and is read by the leader whichever replica received the push
+*/
+type CarbonForecastPushServer struct {
+	// Addr is the address the server binds to
+	Addr string
+	// CertFile and KeyFile serve https when both are set
+	CertFile string
+	KeyFile  string
+	// Client reads the token secret on every request so that rotated tokens are picked up
+	Client client.Reader
+	// TokenSecretRef is the secret holding the bearer token
+	TokenSecretRef types.NamespacedName
+	TokenSecretKey string
+	// MaxBodySize is the maximum size of a request body in bytes
+	MaxBodySize int64
+	// Forecasts reads and writes the carbonintensityforecasts pushed forecasts are stored in
+	Forecasts client.Client
+	// Namespace is the namespace pushed forecasts are stored in
+	Namespace string
+}
+
+// Start serves the endpoint until the context is cancelled
+func (s *CarbonForecastPushServer) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle("/forecasts/", s)
+	srv := &http.Server{
+		Addr:              s.Addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.FromContext(ctx).Error(err, "unable to shut down the forecast push server")
+		}
+	}()
+
+	log.FromContext(ctx).Info("starting forecast push server", "addr", s.Addr)
+	var err error
+	if s.CertFile != "" && s.KeyFile != "" {
+		err = srv.ListenAndServeTLS(s.CertFile, s.KeyFile)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// NeedLeaderElection returns false so that every replica accepts pushes, they are stored in the api server where the leader reads them
+func (s *CarbonForecastPushServer) NeedLeaderElection() bool {
+	return false
+}
+
+func (s *CarbonForecastPushServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	logger := log.FromContext(req.Context())
+
+	location := strings.TrimPrefix(req.URL.Path, "/forecasts/")
+	if location == "" || strings.Contains(location, "/") || len(validation.IsDNS1123Subdomain(pushedForecastName(location))) > 0 {
+		http.NotFound(w, req)
+		return
+	}
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := s.authorize(req); err != nil {
+		logger.Info("rejected carbon forecast push", "location", location, "reason", err.Error())
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	maxBodySize := s.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = defaultMaxPushedForecastSize
+	}
+	var cf []CarbonForecast
+	decoder := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&cf); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, fmt.Sprintf("forecast is larger than %d bytes", maxBodySize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, fmt.Sprintf("invalid json forecast: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	cf, err := validatePushedCarbonForecast(cf, location)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = s.storeForecast(req.Context(), location, cf, time.Now().UTC()); err != nil {
+		logger.Error(err, "unable to store carbon forecast push", "location", location)
+		http.Error(w, "unable to store forecast", http.StatusInternalServerError)
+		return
+	}
+	logger.Info("received carbon forecast push", "location", location, "slots", len(cf))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// storeForecast creates or replaces the carbonintensityforecast of the location with the pushed forecast
+func (s *CarbonForecastPushServer) storeForecast(ctx context.Context, location string, cf []CarbonForecast, receivedAt time.Time) error {
+	spec := carbonawarev1alpha1.CarbonIntensityForecastSpec{
+		Location:    location,
+		Source:      pushedForecastSource,
+		GeneratedAt: &metav1.Time{Time: receivedAt},
+		Slots:       make([]carbonawarev1alpha1.CarbonIntensitySlot, 0, len(cf)),
+	}
+	for _, slot := range cf {
+		spec.Slots = append(spec.Slots, carbonawarev1alpha1.CarbonIntensitySlot{
+			Timestamp:      metav1.Time{Time: slot.Timestamp},
+			DurationInMins: slot.Duration,
+			Value:          *resource.NewMilliQuantity(int64(math.Round(slot.Value*1000)), resource.DecimalSI),
+		})
+	}
+
+	forecast := &carbonawarev1alpha1.CarbonIntensityForecast{}
+	err := s.Forecasts.Get(ctx, types.NamespacedName{Name: pushedForecastName(location), Namespace: s.Namespace}, forecast)
+	if apierrors.IsNotFound(err) {
+		forecast = &carbonawarev1alpha1.CarbonIntensityForecast{
+			ObjectMeta: metav1.ObjectMeta{Name: pushedForecastName(location), Namespace: s.Namespace},
+			Spec:       spec,
+		}
+		return s.Forecasts.Create(ctx, forecast)
+	}
+	if err != nil {
+		return err
+	}
+	forecast.Spec = spec
+	return s.Forecasts.Update(ctx, forecast)
+}
+
+// authorize compares the bearer token of the request with the token secret, ignoring surrounding whitespace like getSecretValue
+func (s *CarbonForecastPushServer) authorize(req *http.Request) error {
+	header := strings.TrimSpace(req.Header.Get("Authorization"))
+	token := strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	if token == "" || !strings.HasPrefix(header, "Bearer ") {
+		return fmt.Errorf("missing bearer token")
+	}
+
+	secret := &corev1.Secret{}
+	if err := s.Client.Get(req.Context(), s.TokenSecretRef, secret); err != nil {
+		return fmt.Errorf("unable to get token secret %s: %w", s.TokenSecretRef, err)
+	}
+	expected := bytes.TrimSpace(secret.Data[s.TokenSecretKey])
+	if len(expected) == 0 {
+		return fmt.Errorf("key %s not found in secret %s", s.TokenSecretKey, s.TokenSecretRef)
+	}
+	if subtle.ConstantTimeCompare([]byte(token), expected) != 1 {
+		return fmt.Errorf("invalid bearer token")
+	}
+	return nil
+}
+
+// validatePushedCarbonForecast rejects forecasts that cannot be used and returns the normalized forecast of the location
+func validatePushedCarbonForecast(cf []CarbonForecast, location string) ([]CarbonForecast, error) {
+	if len(cf) == 0 {
+		return nil, fmt.Errorf("forecast has no slots")
+	}
+	for i := range cf {
+		switch {
+		case cf[i].Timestamp.IsZero():
+			return nil, fmt.Errorf("slot %d has no timestamp", i)
+		case cf[i].Value < 0:
+			return nil, fmt.Errorf("slot %d has a negative value", i)
+		case cf[i].Duration < 0:
+			return nil, fmt.Errorf("slot %d has a negative duration", i)
+		case cf[i].Location != "" && !strings.EqualFold(cf[i].Location, location):
+			return nil, fmt.Errorf("slot %d is for location %s instead of %s", i, cf[i].Location, location)
+		}
+		cf[i].Location = location
+	}
+	normalized, _ := normalizeCarbonForecast(cf)
+	return normalized, nil
+}
+
+// CarbonForecastPushedFetcher is an implementation of CarbonForecastFetcher that returns the forecast last pushed for a location
+type CarbonForecastPushedFetcher struct {
+	Client client.Reader
+	// Namespace is the namespace the forecast push endpoint stores pushed forecasts in, empty when the endpoint is not enabled
+	Namespace string
+	Location  string
+	// MaxDataAge rejects forecasts pushed longer ago than this when set
+	MaxDataAge time.Duration
+
+	metadata *carbonawarev1alpha1.ForecastMetadata
+}
+
+func (c *CarbonForecastPushedFetcher) Fetch(ctx context.Context) ([]CarbonForecast, error) {
+	c.metadata = nil
+	if c.Namespace == "" {
+		return nil, fmt.Errorf("the forecast push endpoint is not enabled")
+	}
+
+	forecast := &carbonawarev1alpha1.CarbonIntensityForecast{}
+	err := c.Client.Get(ctx, types.NamespacedName{Name: pushedForecastName(c.Location), Namespace: c.Namespace}, forecast)
+	if apierrors.IsNotFound(err) || (err == nil && !strings.EqualFold(forecast.Spec.Location, c.Location)) {
+		return nil, fmt.Errorf("no forecast has been pushed for location %s", c.Location)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cf := carbonForecastFromResource(forecast)
+	numOfRecords := int32(len(cf))
+	c.metadata = &carbonawarev1alpha1.ForecastMetadata{
+		LastHeartbeatTime: forecast.Spec.GeneratedAt,
+		NumOfRecords:      &numOfRecords,
+	}
+	if c.MaxDataAge > 0 && forecast.Spec.GeneratedAt != nil {
+		if age := time.Now().UTC().Sub(forecast.Spec.GeneratedAt.Time); age > c.MaxDataAge {
+			return nil, &StaleForecastError{Source: fmt.Sprintf("pushed forecast for location %s", c.Location), Reason: fmt.Sprintf("data is %s old which is older than %s", age.Round(time.Second), c.MaxDataAge)}
+		}
+	}
+	return cf, nil
+}
+
+// Metadata returns when the forecast was pushed and its number of records
+func (c *CarbonForecastPushedFetcher) Metadata() *carbonawarev1alpha1.ForecastMetadata {
+	return c.metadata
+}
@@ -0,0 +1,57 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package controllers
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// registeredFetcher is the fetcher of a carbonawarekedascaler along with the data source spec it was built from
+type registeredFetcher struct {
+	key     string
+	fetcher *CarbonForecastFallbackFetcher
+}
+
+// CarbonForecastFetcherRegistry keeps a fetcher per carbonawarekedascaler so that concurrent reconciles never share a fetcher
+// and state such as api tokens survives between reconciles of the same scaler
+// controller-runtime never reconciles the same scaler concurrently so each fetcher is only used by one reconcile at a time
+type CarbonForecastFetcherRegistry struct {
+	mu       sync.Mutex
+	fetchers map[types.NamespacedName]registeredFetcher
+}
+
+// NewCarbonForecastFetcherRegistry returns an empty CarbonForecastFetcherRegistry
+func NewCarbonForecastFetcherRegistry() *CarbonForecastFetcherRegistry {
+	return &CarbonForecastFetcherRegistry{
+		fetchers: map[types.NamespacedName]registeredFetcher{},
+	}
+}
+
+// Get returns the fetcher of the scaler, building a new one with newFetcher when there is none or the data source spec changed
+func (r *CarbonForecastFetcherRegistry) Get(name types.NamespacedName, key string, newFetcher func() *CarbonForecastFallbackFetcher) *CarbonForecastFallbackFetcher {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if registered, ok := r.fetchers[name]; ok && registered.key == key {
+		return registered.fetcher
+	}
+	fetcher := newFetcher()
+	r.fetchers[name] = registeredFetcher{key: key, fetcher: fetcher}
+	return fetcher
+}
+
+// Delete removes the fetcher of a scaler that no longer exists
+func (r *CarbonForecastFetcherRegistry) Delete(name types.NamespacedName) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.fetchers, name)
+}
+
+// Len returns the number of registered fetchers
+func (r *CarbonForecastFetcherRegistry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.fetchers)
+}
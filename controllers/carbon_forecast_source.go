@@ -0,0 +1,266 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	carbonawarev1alpha1 "github.com/azure/carbon-aware-keda-operator/api/v1alpha1"
+)
+
+// CarbonForecastSourceReporter is implemented by fetchers that can report which source supplied the last forecast
+type CarbonForecastSourceReporter interface {
+	Source() string
+}
+
+// NamedCarbonForecastFetcher is a CarbonForecastFetcher along with a description of its source
+type NamedCarbonForecastFetcher struct {
+	Name string
+	// Key identifies the source in the forecast cache, fetchers without a key are not cached
+	Key string
+	CarbonForecastFetcher
+}
+
+// CarbonForecastSourcesError is returned when every carbon intensity forecast source failed
+type CarbonForecastSourcesError struct {
+	Names  []string
+	Errors []error
+}
+
+func (e *CarbonForecastSourcesError) Error() string {
+	errs := make([]string, 0, len(e.Errors))
+	for i, err := range e.Errors {
+		errs = append(errs, fmt.Sprintf("%s: %v", e.Names[i], err))
+	}
+	return fmt.Sprintf("all carbon intensity forecast sources failed: %s", strings.Join(errs, "; "))
+}
+
+// Unwrap returns the error of the primary source
+func (e *CarbonForecastSourcesError) Unwrap() error {
+	return e.Errors[0]
+}
+
+// CarbonForecastFallbackFetcher is an implementation of CarbonForecastFetcher that tries each fetcher in order until one returns a forecast
+type CarbonForecastFallbackFetcher struct {
+	Fetchers []NamedCarbonForecastFetcher
+	// Cache stores the last forecast returned by each fetcher when set
+	Cache     *CarbonForecastCache
+	source    string
+	metadata  *carbonawarev1alpha1.ForecastMetadata
+	providers map[string][]CarbonForecast
+}
+
+func (c *CarbonForecastFallbackFetcher) Fetch(ctx context.Context) ([]CarbonForecast, error) {
+	c.source = ""
+	c.metadata = nil
+	c.providers = nil
+	sourcesErr := &CarbonForecastSourcesError{}
+	for _, f := range c.Fetchers {
+		cf, err := f.Fetch(ctx)
+		if err == nil && len(cf) == 0 {
+			err = fmt.Errorf("no forecast data")
+		}
+
+		// keep the metadata of the source that supplied the forecast, or of the first failed source that had any
+		var metadata *carbonawarev1alpha1.ForecastMetadata
+		if reporter, ok := f.CarbonForecastFetcher.(CarbonForecastMetadataReporter); ok {
+			metadata = reporter.Metadata()
+		}
+
+		if err != nil {
+			if c.metadata == nil {
+				c.metadata = metadata
+			}
+			sourcesErr.Names = append(sourcesErr.Names, f.Name)
+			sourcesErr.Errors = append(sourcesErr.Errors, err)
+			continue
+		}
+		c.source = f.Name
+		c.metadata = metadata
+		// an ensemble describes which of its members supplied the forecast
+		if reporter, ok := f.CarbonForecastFetcher.(CarbonForecastSourceReporter); ok && reporter.Source() != "" {
+			c.source = reporter.Source()
+		}
+		if reporter, ok := f.CarbonForecastFetcher.(CarbonForecastProvidersReporter); ok {
+			c.providers = reporter.Providers()
+		}
+		if c.Cache != nil && f.Key != "" {
+			c.Cache.Set(f.Key, cf, time.Now().UTC())
+		}
+		return cf, nil
+	}
+
+	if len(sourcesErr.Errors) == 0 {
+		return nil, fmt.Errorf("no carbon intensity forecast data source configured")
+	}
+	return nil, sourcesErr
+}
+
+// Source returns the name of the fetcher that supplied the last forecast
+func (c *CarbonForecastFallbackFetcher) Source() string {
+	return c.source
+}
+
+// Metadata returns the exporter metadata of the source that supplied the last forecast
+func (c *CarbonForecastFallbackFetcher) Metadata() *carbonawarev1alpha1.ForecastMetadata {
+	return c.metadata
+}
+
+// Providers returns the forecast of each provider combined into the last forecast when it was supplied by an ensemble
+func (c *CarbonForecastFallbackFetcher) Providers() map[string][]CarbonForecast {
+	return c.providers
+}
+
+// LastKnownGood returns the cached forecast of the first fetcher in order that was fetched no longer than maxAge ago along with its name
+func (c *CarbonForecastFallbackFetcher) LastKnownGood(maxAge time.Duration) ([]CarbonForecast, string, bool) {
+	if c.Cache == nil {
+		return nil, "", false
+	}
+	now := time.Now().UTC()
+	for _, f := range c.Fetchers {
+		if f.Key == "" {
+			continue
+		}
+		if cf, fetchedAt, ok := c.Cache.Get(f.Key, maxAge, now); ok {
+			return cf, fmt.Sprintf("%s fetched at %s", f.Name, fetchedAt.Format(time.RFC3339)), true
+		}
+	}
+	return nil, "", false
+}
+
+// newFallbackFetcher returns a fetcher that tries the primary source followed by each fallback source in order, reading secrets from the namespace
+func (r *CarbonAwareKedaScalerReconciler) newFallbackFetcher(namespace string, ds carbonawarev1alpha1.CarbonIntensityForecastDataSource) *CarbonForecastFallbackFetcher {
+	fallback := &CarbonForecastFallbackFetcher{Cache: r.ForecastCache}
+
+	// the ensemble is used instead of the primary source
+	if ds.Ensemble != nil {
+		name, fetcher := r.newEnsembleFetcher(namespace, *ds.Ensemble)
+		key := ""
+		if b, err := json.Marshal(ds.Ensemble); err == nil {
+			key = namespace + "/" + string(b)
+		}
+		fallback.Fetchers = append(fallback.Fetchers, NamedCarbonForecastFetcher{Name: name, Key: key, CarbonForecastFetcher: fetcher})
+		ds.CarbonIntensityForecastSource = carbonawarev1alpha1.CarbonIntensityForecastSource{}
+	}
+
+	for i, src := range append([]carbonawarev1alpha1.CarbonIntensityForecastSource{ds.CarbonIntensityForecastSource}, ds.Fallbacks...) {
+		name, fetcher := r.newCarbonForecastFetcher(namespace, src)
+		if fetcher == nil {
+			continue
+		}
+		if i > 0 {
+			name = fmt.Sprintf("fallbacks[%d] %s", i-1, name)
+		}
+		// the spec of the source identifies it in the cache so scalers sharing a source share its last known good forecast,
+		// scoped to the namespace since secrets are read from the namespace of the scaler
+		key := ""
+		if b, err := json.Marshal(src); err == nil {
+			key = namespace + "/" + string(b)
+		}
+		fallback.Fetchers = append(fallback.Fetchers, NamedCarbonForecastFetcher{Name: name, Key: key, CarbonForecastFetcher: fetcher})
+	}
+	return fallback
+}
+
+// newCarbonForecastFetcher returns a description and the fetcher of a carbon intensity forecast source or nil if no source is set
+// secrets referenced by the source are read from the namespace of the carbonawarekedascaler
+func (r *CarbonAwareKedaScalerReconciler) newCarbonForecastFetcher(namespace string, src carbonawarev1alpha1.CarbonIntensityForecastSource) (string, CarbonForecastFetcher) {
+	switch {
+	// if mock carbon forecast is enabled use the mock fetcher
+	case src.MockCarbonForecast != nil:
+		return fmt.Sprintf("mock %s carbon forecast", defaultMockCarbonForecast(*src.MockCarbonForecast).Profile), &CarbonForecastMockConfigMapFetcher{
+			Client: r.Client,
+			Reader: r.configMapReader(),
+			Config: *src.MockCarbonForecast,
+		}
+	case src.LocalConfigMap != (carbonawarev1alpha1.LocalConfigMap{}):
+		return fmt.Sprintf("configmap %s/%s", src.LocalConfigMap.Namespace, src.LocalConfigMap.Name), &CarbonForecastConfigMapFetcher{
+			Client:             r.configMapReader(),
+			ConfigMapName:      src.LocalConfigMap.Name,
+			ConfigMapNamespace: src.LocalConfigMap.Namespace,
+			ConfigMapKey:       src.LocalConfigMap.Key,
+			MaxDataAge:         time.Duration(src.LocalConfigMap.MaxDataAgeInMins) * time.Minute,
+			Format:             src.LocalConfigMap.Format,
+		}
+	case src.CarbonAwareSdk != nil:
+		return fmt.Sprintf("carbon aware sdk location %s", src.CarbonAwareSdk.Location), &CarbonForecastCarbonAwareSdkFetcher{
+			Client:        r.apiReader(),
+			Namespace:     namespace,
+			URL:           src.CarbonAwareSdk.URL,
+			Location:      src.CarbonAwareSdk.Location,
+			AuthSecretRef: src.CarbonAwareSdk.AuthSecretRef,
+			TLS:           src.CarbonAwareSdk.TLS,
+		}
+	case src.WattTime != nil:
+		wattTimeURL := src.WattTime.URL
+		if wattTimeURL == "" {
+			wattTimeURL = "https://api.watttime.org"
+		}
+		return fmt.Sprintf("watttime %s signal for region %s", src.WattTime.Signal, src.WattTime.Region), &CarbonForecastWattTimeFetcher{
+			Client:               r.apiReader(),
+			Namespace:            namespace,
+			URL:                  wattTimeURL,
+			Region:               src.WattTime.Region,
+			CredentialsSecretRef: src.WattTime.CredentialsSecretRef,
+			Signal:               src.WattTime.Signal,
+		}
+	case src.ElectricityMaps != nil:
+		electricityMapsURL := src.ElectricityMaps.URL
+		if electricityMapsURL == "" {
+			electricityMapsURL = "https://api.electricitymap.org"
+		}
+		return fmt.Sprintf("electricity maps zone %s", src.ElectricityMaps.Zone), &CarbonForecastElectricityMapsFetcher{
+			Client:             r.apiReader(),
+			Namespace:          namespace,
+			URL:                electricityMapsURL,
+			Zone:               src.ElectricityMaps.Zone,
+			AuthTokenSecretRef: src.ElectricityMaps.AuthTokenSecretRef,
+		}
+	case src.UkCarbonIntensity != nil:
+		ukURL := src.UkCarbonIntensity.URL
+		if ukURL == "" {
+			ukURL = "https://api.carbonintensity.org.uk"
+		}
+		return "uk carbon intensity api", &CarbonForecastUkCarbonIntensityFetcher{
+			URL:      ukURL,
+			RegionID: src.UkCarbonIntensity.RegionID,
+			Postcode: src.UkCarbonIntensity.Postcode,
+		}
+	case src.Prometheus != nil:
+		return fmt.Sprintf("prometheus %s", src.Prometheus.URL), &CarbonForecastPrometheusFetcher{
+			Client:        r.apiReader(),
+			Namespace:     namespace,
+			URL:           src.Prometheus.URL,
+			Query:         src.Prometheus.Query,
+			Range:         time.Duration(src.Prometheus.RangeInMins) * time.Minute,
+			Step:          time.Duration(src.Prometheus.StepInMins) * time.Minute,
+			AuthSecretRef: src.Prometheus.AuthSecretRef,
+			TLS:           src.Prometheus.TLS,
+		}
+	case src.StaticProfile != nil:
+		return "static profile", &CarbonForecastStaticProfileFetcher{
+			Values:     src.StaticProfile.Values,
+			SlotLength: src.StaticProfile.SlotLengthInMins,
+		}
+	case src.ForecastRef != nil:
+		return fmt.Sprintf("carbonintensityforecast %s/%s", src.ForecastRef.Namespace, src.ForecastRef.Name), &CarbonForecastResourceFetcher{
+			Client:     r.Client,
+			Name:       src.ForecastRef.Name,
+			Namespace:  src.ForecastRef.Namespace,
+			MaxDataAge: time.Duration(src.ForecastRef.MaxDataAgeInMins) * time.Minute,
+		}
+	case src.Pushed != nil:
+		return fmt.Sprintf("pushed forecast for location %s", src.Pushed.Location), &CarbonForecastPushedFetcher{
+			Client:     r.Client,
+			Namespace:  r.PushNamespace,
+			Location:   src.Pushed.Location,
+			MaxDataAge: time.Duration(src.Pushed.MaxDataAgeInMins) * time.Minute,
+		}
+	}
+	return "", nil
+}
@@ -18,11 +18,13 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
 
 	kedav1alpha1 "github.com/kedacore/keda/v2/apis/keda/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -30,8 +32,14 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	carbonawarev1alpha1 "github.com/azure/carbon-aware-keda-operator/api/v1alpha1"
 )
@@ -41,6 +49,19 @@ type CarbonAwareKedaScalerReconciler struct {
 	client.Client
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
+	// APIReader reads objects that should not be cached by the manager such as secrets, pods and nodes
+	APIReader client.Reader
+	// ConfigMaps serves the configmaps used as data sources, they are read through the client when it is nil
+	ConfigMaps *CarbonForecastConfigMapCache
+	// ForecastCache keeps the last known good forecast of each carbon intensity data source
+	ForecastCache *CarbonForecastCache
+	// PushNamespace is the namespace the forecast push endpoint stores pushed forecasts in, the pushed data source is unavailable when it is empty
+	PushNamespace string
+	// Fetchers keeps the carbon forecast fetcher of each carbonawarekedascaler
+	Fetchers *CarbonForecastFetcherRegistry
+	// MaxConcurrentReconciles is the maximum number of carbonawarekedascalers reconciled in parallel
+	MaxConcurrentReconciles int
+	// CarbonForecastFetcher is used for carbonawarekedascalers without a configured data source, e.g. to inject forecasts in tests
 	CarbonForecastFetcher
 }
 
@@ -51,6 +72,10 @@ type CarbonAwareKedaScalerReconciler struct {
 //+kubebuilder:rbac:groups=keda.sh,resources=scaledjobs,verbs=get;list;watch;update;patch
 //+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch
 //+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list
+//+kubebuilder:rbac:groups="",resources=pods,verbs=list
+//+kubebuilder:rbac:groups=apps,resources=deployments;statefulsets,verbs=get
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=list
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -60,8 +85,6 @@ type CarbonAwareKedaScalerReconciler struct {
 func (r *CarbonAwareKedaScalerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
 
-	kedav1alpha1.AddToScheme(r.Scheme)
-
 	now := time.Now().UTC()
 
 	// default interval the controller should requeue at
@@ -89,50 +112,173 @@ func (r *CarbonAwareKedaScalerReconciler) Reconcile(ctx context.Context, req ctr
 	err := r.Get(ctx, req.NamespacedName, carbonAwareKedaScaler)
 	if err != nil && errors.IsNotFound(err) {
 		logger.Error(err, "unable to find carbonawarekedascaler")
+		if r.Fetchers != nil {
+			r.Fetchers.Delete(req.NamespacedName)
+		}
+		r.pruneConfigMapCache()
+		setProviderCarbonIntensity(req.Name, nil)
+		setForecastMetadataMetrics(req.Name, nil, now)
 		r.Recorder.Event(carbonAwareKedaScaler, "Warning", "NoCustomResource", fmt.Sprintf("Unable to find carbonawarekedascaler %s", req.NamespacedName))
 		return ctrl.Result{RequeueAfter: getRequeueDuration(now, requeueInterval)}, client.IgnoreNotFound(err)
 	}
 
 	ReconcilesTotal.WithLabelValues(carbonAwareKedaScaler.Name).Inc()
 
-	// if mock carbon forecast is enabled use the mock fetcher otherwise, use the configmap fetcher
-	if carbonAwareKedaScaler.Spec.CarbonIntensityForecastDataSource.MockCarbonForecast {
-		r.CarbonForecastFetcher = &CarbonForecastMockConfigMapFetcher{
-			Client: r.Client,
-		}
-		r.Recorder.Event(carbonAwareKedaScaler, "Normal", "CarbonForecastSource", "Using mock carbon forecast")
-	} else if carbonAwareKedaScaler.Spec.CarbonIntensityForecastDataSource.LocalConfigMap != (carbonawarev1alpha1.LocalConfigMap{}) {
-		// fetch the carbon forecast from configmap
-		r.CarbonForecastFetcher = &CarbonForecastConfigMapFetcher{
-			Client:             r.Client,
-			ConfigMapName:      carbonAwareKedaScaler.Spec.CarbonIntensityForecastDataSource.LocalConfigMap.Name,
-			ConfigMapNamespace: carbonAwareKedaScaler.Spec.CarbonIntensityForecastDataSource.LocalConfigMap.Namespace,
-			ConfigMapKey:       carbonAwareKedaScaler.Spec.CarbonIntensityForecastDataSource.LocalConfigMap.Key,
-		}
-		r.Recorder.Event(carbonAwareKedaScaler, "Normal", "CarbonForecastSource", fmt.Sprintf("Using carbon forecast from configmap %s", carbonAwareKedaScaler.Spec.CarbonIntensityForecastDataSource.LocalConfigMap.Name))
+	// get the fetcher of this scaler's data source
+	fetcher := r.carbonForecastFetcher(carbonAwareKedaScaler)
+
+	// strategy to use when there is no forecast for the current time
+	strategy := carbonAwareKedaScaler.Spec.OnForecastUnavailable
+	if strategy == "" {
+		strategy = carbonawarev1alpha1.ForecastUnavailableEcoModeOff
 	}
+	carbonAwareKedaScaler.Status.ForecastUnavailableStrategy = ""
+
+	// reason the forecast is unavailable if fetching it failed
+	unavailableReason := ""
+
+	// set when the last known good forecast is used because fetching the forecast failed
+	lastKnownGood := false
 
 	// fetch the carbon forecast
-	forecast, err := r.CarbonForecastFetcher.Fetch(ctx)
+	forecast, err := fetcher.Fetch(ctx)
+
+	// report the metadata written by the exporter, even when the data was rejected as stale
+	carbonAwareKedaScaler.Status.ForecastMetadata = nil
+	if reporter, ok := fetcher.(CarbonForecastMetadataReporter); ok {
+		carbonAwareKedaScaler.Status.ForecastMetadata = reporter.Metadata()
+	}
+
+	// log the age and number of records of the forecast reported by the exporter
+	setForecastMetadataMetrics(carbonAwareKedaScaler.Name, carbonAwareKedaScaler.Status.ForecastMetadata, now)
+
 	if err != nil {
-		ecoModeStatus.IsDisabled = true
-		ecoModeStatus.DisableReason = err.Error()
-		ecoModeStatus.RequeueAfter = getRequeueDuration(now, requeueInterval)
-		maxReplicaCount = &carbonAwareKedaScaler.Spec.EcoModeOff.MaxReplicas
+		unavailableReason = err.Error()
+		carbonAwareKedaScaler.Status.ForecastSource = ""
 		logger.Error(err, "failed to fetch carbon forecast")
 		setStatusCondition(carbonAwareKedaScaler, metav1.ConditionTrue, carbonawarev1alpha1.ReasonCarbonDataFetchError, fmt.Sprintf("failed to fetch carbon forecast: %v", err))
-		r.Recorder.Event(carbonAwareKedaScaler, "Warning", "CarbonIntensityForecastMissing", "Failed to fetch carbon forecast")
+		if isStaleForecastError(err) {
+			r.Recorder.Event(carbonAwareKedaScaler, "Warning", "CarbonIntensityForecastStale", fmt.Sprintf("Rejected stale carbon forecast: %v", err))
+		} else {
+			r.Recorder.Event(carbonAwareKedaScaler, "Warning", "CarbonIntensityForecastMissing", "Failed to fetch carbon forecast")
+		}
+
+		// use the last forecast fetched from any of the configured sources if it has not expired
+		if fallback, ok := fetcher.(*CarbonForecastFallbackFetcher); ok && strategy == carbonawarev1alpha1.ForecastUnavailableLastKnownGood {
+			maxAge := time.Duration(carbonAwareKedaScaler.Spec.CarbonIntensityForecastDataSource.CacheMaxAgeInMins) * time.Minute
+			if cf, source, found := fallback.LastKnownGood(maxAge); found {
+				forecast = cf
+				lastKnownGood = true
+				carbonAwareKedaScaler.Status.ForecastSource = fmt.Sprintf("%s (last known good)", source)
+				logger.Info("using last known good carbon forecast", "source", source)
+				r.Recorder.Event(carbonAwareKedaScaler, "Warning", "CarbonForecastLastKnownGood", fmt.Sprintf("Using last known good carbon forecast from %s", source))
+			}
+		}
+	} else if reporter, ok := fetcher.(CarbonForecastSourceReporter); ok {
+		// report which source supplied the forecast
+		carbonAwareKedaScaler.Status.ForecastSource = reporter.Source()
+		r.Recorder.Event(carbonAwareKedaScaler, "Normal", "CarbonForecastSource", fmt.Sprintf("Using carbon forecast from %s", reporter.Source()))
+	}
+
+	// only use the slots for the configured location, resolving it from the nodes running the target when it is auto
+	if len(forecast) > 0 {
+		location, locationErr := r.resolveForecastLocation(ctx, carbonAwareKedaScaler, now)
+		if locationErr != nil {
+			forecast = nil
+			unavailableReason = fmt.Sprintf("unable to resolve carbon forecast location: %v", locationErr)
+			logger.Error(locationErr, "unable to resolve carbon forecast location")
+			r.Recorder.Event(carbonAwareKedaScaler, "Warning", "ForecastLocationError", fmt.Sprintf("Unable to resolve carbon forecast location: %v", locationErr))
+		} else if location != "" {
+			forecast = filterCarbonForecastByLocation(forecast, location)
+			if len(forecast) == 0 {
+				unavailableReason = fmt.Sprintf("no carbon forecast for location %s", location)
+			}
+		}
+		carbonAwareKedaScaler.Status.ForecastLocation = location
+	}
+
+	// validate and normalize the forecast so problems with the data are reported instead of silently ignored
+	forecastCondition := metav1.Condition{
+		Type:    carbonawarev1alpha1.ConditionForecastDegraded,
+		Status:  metav1.ConditionFalse,
+		Reason:  carbonawarev1alpha1.ReasonForecastValid,
+		Message: "carbon forecast is valid",
+	}
+	if len(forecast) > 0 {
+		var issues []string
+		forecast, issues = normalizeCarbonForecast(forecast)
+		if len(issues) > 0 {
+			forecastCondition.Status = metav1.ConditionTrue
+			forecastCondition.Reason = carbonawarev1alpha1.ReasonForecastNormalized
+			forecastCondition.Message = strings.Join(issues, "; ")
+			logger.Info("normalized carbon forecast", "issues", issues)
+			r.Recorder.Event(carbonAwareKedaScaler, "Warning", "CarbonForecastNormalized", fmt.Sprintf("Normalized carbon forecast: %s", forecastCondition.Message))
+		}
+	} else {
+		forecastCondition.Status = metav1.ConditionTrue
+		forecastCondition.Reason = carbonawarev1alpha1.ReasonForecastUnavailable
+		forecastCondition.Message = "no carbon forecast data"
+		if unavailableReason != "" {
+			forecastCondition.Message = unavailableReason
+		}
+	}
+	meta.SetStatusCondition(&carbonAwareKedaScaler.Status.Conditions, forecastCondition)
+
+	// keep the current max replicas of the keda target when the holdCurrent strategy is in effect
+	holdCurrent := false
+
+	// get the baseline that maxReplicasPercent is relative to, a missing baseline is reported when the percentages are resolved
+	var baseline *int32
+	carbonAwareKedaScaler.Status.BaselineMaxReplicas = nil
+	if usesMaxReplicasPercent(carbonAwareKedaScaler.Spec) {
+		value, baselineErr := r.maxReplicasBaseline(ctx, carbonAwareKedaScaler)
+		if baselineErr != nil {
+			logger.Error(baselineErr, "unable to get baseline max replicas")
+		} else {
+			baseline = &value
+			carbonAwareKedaScaler.Status.BaselineMaxReplicas = baseline
+		}
 	}
 
 	// get the current carbon forecast
 	currentforecast := findCarbonForecast(forecast, now)
 	if currentforecast != nil {
 		requeueInterval = currentforecast.Duration
+		if lastKnownGood {
+			carbonAwareKedaScaler.Status.ForecastUnavailableStrategy = carbonawarev1alpha1.ForecastUnavailableLastKnownGood
+		}
 	} else {
-		ecoModeStatus.IsDisabled = true
-		ecoModeStatus.DisableReason = "unable to find current carbon forecast"
+		if unavailableReason == "" {
+			unavailableReason = "unable to find current carbon forecast"
+		}
 		ecoModeStatus.RequeueAfter = getRequeueDuration(now, requeueInterval)
-		maxReplicaCount = &carbonAwareKedaScaler.Spec.EcoModeOff.MaxReplicas
+
+		switch strategy {
+		case carbonawarev1alpha1.ForecastUnavailableMostConservative:
+			configs := carbonAwareKedaScaler.Spec.MaxReplicasByCarbonIntensity
+			if relative := carbonAwareKedaScaler.Spec.RelativeThresholds; relative != nil {
+				configs = relativeThresholdConfigs(relative.Thresholds)
+			}
+			if resolved, resolveErr := resolveMaxReplicasPercent(configs, baseline, carbonAwareKedaScaler.Spec.PercentOfBaseline); resolveErr == nil {
+				maxReplicaCount = getLowestMaxReplicas(resolved)
+			} else {
+				logger.Error(resolveErr, "unable to resolve maxReplicasPercent")
+			}
+		case carbonawarev1alpha1.ForecastUnavailableHoldCurrent:
+			holdCurrent = true
+		}
+
+		if maxReplicaCount != nil || holdCurrent {
+			carbonAwareKedaScaler.Status.ForecastUnavailableStrategy = strategy
+			logger.Info("carbon forecast unavailable", "reason", unavailableReason, "strategy", strategy)
+			r.Recorder.Event(carbonAwareKedaScaler, "Warning", "ForecastUnavailableStrategy", fmt.Sprintf("Carbon forecast unavailable, using %s strategy: %s", strategy, unavailableReason))
+		} else {
+			// lastKnownGood without a cached forecast also ends up here
+			carbonAwareKedaScaler.Status.ForecastUnavailableStrategy = carbonawarev1alpha1.ForecastUnavailableEcoModeOff
+			ecoModeStatus.IsDisabled = true
+			ecoModeStatus.DisableReason = unavailableReason
+			maxReplicaCount = &carbonAwareKedaScaler.Spec.EcoModeOff.MaxReplicas
+		}
 	}
 
 	// check if it should be disabled based on the eco mode off configuration
@@ -149,9 +295,111 @@ func (r *CarbonAwareKedaScalerReconciler) Reconcile(ctx context.Context, req ctr
 		}
 	}
 
+	// add up the estimated emissions of the keda target since the last reconcile
+	if budget := carbonAwareKedaScaler.Spec.CarbonBudget; budget != nil {
+		previous := carbonAwareKedaScaler.Status.CarbonBudget
+		replicas, observeErr := r.observedReplicas(ctx, carbonAwareKedaScaler)
+		if observeErr != nil {
+			logger.Error(observeErr, "unable to observe replicas of keda target for carbon budget")
+			if previous != nil {
+				replicas = previous.ObservedReplicas
+			}
+		}
+		var intensity float64
+		if currentforecast != nil {
+			intensity = currentforecast.Value
+		} else if previous != nil {
+			intensity = float64(previous.ObservedCarbonIntensity)
+		}
+		carbonAwareKedaScaler.Status.CarbonBudget = accrueCarbonBudget(previous, *budget, now, replicas, intensity)
+	} else {
+		carbonAwareKedaScaler.Status.CarbonBudget = nil
+	}
+
 	// get the max replicas for the current hour based on carbon forecast configuration
-	if !ecoModeStatus.IsDisabled {
-		maxReplicaCount, err = getMaxReplicas(currentforecast, carbonAwareKedaScaler.Spec.MaxReplicasByCarbonIntensity)
+	carbonAwareKedaScaler.Status.CarbonIntensityThresholds = nil
+	currentBand := carbonAwareKedaScaler.Status.CarbonIntensityBand
+	carbonAwareKedaScaler.Status.CarbonIntensityBand = nil
+	carbonAwareKedaScaler.Status.LookAheadSlotTime = nil
+	currentWindow := carbonAwareKedaScaler.Status.TimeShiftWindow
+	carbonAwareKedaScaler.Status.TimeShiftWindow = nil
+	if !ecoModeStatus.IsDisabled && currentforecast != nil {
+		// work out the thresholds from the percentiles of the forecast when relative thresholds are set
+		configs := carbonAwareKedaScaler.Spec.MaxReplicasByCarbonIntensity
+		err = nil
+		if relative := carbonAwareKedaScaler.Spec.RelativeThresholds; relative != nil {
+			configs, err = getRelativeThresholds(forecast, *relative, now)
+			carbonAwareKedaScaler.Status.CarbonIntensityThresholds = configs
+		}
+		if err == nil {
+			configs, err = resolveMaxReplicasPercent(configs, baseline, carbonAwareKedaScaler.Spec.PercentOfBaseline)
+		}
+		if err == nil {
+			spec := carbonAwareKedaScaler.Spec
+			maxReplicasFor := func(cf *CarbonForecast) (*int32, error) {
+				if spec.Interpolation == carbonawarev1alpha1.InterpolationLinear {
+					return getLinearMaxReplicas(cf, configs, spec.InterpolationRounding)
+				}
+				return getMaxReplicas(cf, configs)
+			}
+			switch {
+			case spec.TimeShift != nil:
+				// hold the jobs until the greenest window that still meets the deadline opens
+				if !strings.Contains(string(spec.KedaTarget), "scaledjob") {
+					err = fmt.Errorf("timeShift is only supported for scaledjobs")
+					break
+				}
+				var window *carbonawarev1alpha1.TimeShiftWindow
+				maxReplicaCount, window, err = getTimeShiftMaxReplicas(forecast, now, currentWindow, *spec.TimeShift, spec.EcoModeOff.MaxReplicas)
+				carbonAwareKedaScaler.Status.TimeShiftWindow = window
+				if err == nil && window == nil {
+					r.Recorder.Event(carbonAwareKedaScaler, "Warning", "TimeShiftNoWindow", "No carbon forecast window completes before the deadline, running jobs now")
+				} else if window != nil && (currentWindow == nil || !currentWindow.Start.Equal(&window.Start)) {
+					logger.Info("shifted jobs to carbon forecast window", "start", window.Start, "end", window.End, "carbonIntensity", window.CarbonIntensity)
+					r.Recorder.Event(carbonAwareKedaScaler, "Normal", "TimeShiftWindow", fmt.Sprintf("Shifted jobs to the window from %s to %s with a carbon intensity of %d", window.Start.UTC().Format(time.RFC3339), window.End.UTC().Format(time.RFC3339), window.CarbonIntensity))
+				}
+			case spec.Interpolation != carbonawarev1alpha1.InterpolationLinear && (spec.Hysteresis > 0 || spec.MinDwellInMins > 0):
+				// stay in the band of the last reconcile until the carbon intensity has moved far enough for long enough
+				var band *carbonawarev1alpha1.CarbonIntensityBand
+				maxReplicaCount, band, err = getBandedMaxReplicas(currentforecast, configs, currentBand, spec.Hysteresis, time.Duration(spec.MinDwellInMins)*time.Minute, now)
+				carbonAwareKedaScaler.Status.CarbonIntensityBand = band
+				if band != nil && (currentBand == nil || currentBand.Index != band.Index) {
+					logger.Info("changed carbon intensity band", "threshold", band.CarbonIntensityThreshold, "maxReplicas", band.MaxReplicas)
+				}
+			default:
+				maxReplicaCount, err = maxReplicasFor(currentforecast)
+			}
+
+			// change max replicas ahead of upcoming slots with a different max replicas
+			if err == nil && spec.LookAhead != nil && spec.TimeShift == nil {
+				var slot *CarbonForecast
+				maxReplicaCount, slot, err = getLookAheadMaxReplicas(forecast, now, maxReplicaCount, *spec.LookAhead, maxReplicasFor)
+				if slot != nil {
+					carbonAwareKedaScaler.Status.LookAheadSlotTime = &metav1.Time{Time: slot.Timestamp}
+					logger.Info("using max replicas of upcoming carbon forecast", "forecast", slot, "maxReplicas", maxReplicaCount)
+					r.Recorder.Event(carbonAwareKedaScaler, "Normal", "LookAhead", fmt.Sprintf("Using max replicas %d of the carbon forecast starting at %s", *maxReplicaCount, slot.Timestamp.Format(time.RFC3339)))
+				}
+			}
+
+			// lower max replicas to what the rest of the carbon budget allows
+			if err == nil && spec.CarbonBudget != nil && spec.TimeShift == nil {
+				budgetStatus := carbonAwareKedaScaler.Status.CarbonBudget
+				var budgetMaxReplicas int32
+				var projected float64
+				budgetMaxReplicas, projected, err = planCarbonBudget(forecast, now, budgetStatus, *spec.CarbonBudget, maxReplicasFor)
+				if err == nil {
+					if floor := spec.CarbonBudget.MinReplicas; floor != nil && budgetMaxReplicas < *floor {
+						budgetMaxReplicas = *floor
+					}
+					budgetStatus.MaxReplicas = &budgetMaxReplicas
+					budgetStatus.Projected = *emissionsQuantity(projected)
+					if budgetMaxReplicas < *maxReplicaCount {
+						maxReplicaCount = &budgetMaxReplicas
+						logger.Info("carbon budget lowered max replicas", "maxReplicas", budgetMaxReplicas, "used", budgetStatus.Used.String(), "budget", spec.CarbonBudget.Budget.String())
+					}
+				}
+			}
+		}
 		if err != nil {
 			ecoModeStatus.IsDisabled = true
 			ecoModeStatus.DisableReason = err.Error()
@@ -189,6 +437,26 @@ func (r *CarbonAwareKedaScalerReconciler) Reconcile(ctx context.Context, req ctr
 			return ctrl.Result{RequeueAfter: getRequeueDuration(now, requeueInterval)}, err
 		}
 
+		// keep the current max replica count when holding it, otherwise fall back to the eco mode off max replicas
+		if holdCurrent {
+			maxReplicaCount = scaledObject.Spec.MaxReplicaCount
+			if maxReplicaCount == nil {
+				maxReplicaCount = &carbonAwareKedaScaler.Spec.EcoModeOff.MaxReplicas
+			}
+		}
+
+		// move the max replica count toward the target in steps when a ramp policy is set
+		maxReplicaCount, err = rampMaxReplicaCount(carbonAwareKedaScaler, scaledObject.Spec.MaxReplicaCount, maxReplicaCount, now)
+		if err != nil {
+			logger.Error(err, "invalid ramp policy")
+			r.Recorder.Event(carbonAwareKedaScaler, "Warning", "RampPolicyError", fmt.Sprintf("Invalid ramp policy, setting max replicas without ramping: %v", err))
+		} else if *maxReplicaCount != *carbonAwareKedaScaler.Status.TargetMaxReplicas {
+			r.Recorder.Event(carbonAwareKedaScaler, "Normal", "MaxReplicaCountRamping", fmt.Sprintf("Ramping max replicas of %s to %d toward %d", scaledObject.Name, *maxReplicaCount, *carbonAwareKedaScaler.Status.TargetMaxReplicas))
+		}
+
+		// remember the max replica count before it is overwritten when it is used as a baseline
+		recordOriginalMaxReplicas(scaledObject, scaledObject.Spec.MaxReplicaCount, maxReplicaCount, usesTargetMaxReplicasBaseline(carbonAwareKedaScaler.Spec))
+
 		// ovewrite the scaledobject.Spec.MaxReplicaCount with the max replica count for the current carbon rating
 		scaledObject.Spec.MaxReplicaCount = maxReplicaCount
 
@@ -220,6 +488,26 @@ func (r *CarbonAwareKedaScalerReconciler) Reconcile(ctx context.Context, req ctr
 			return ctrl.Result{RequeueAfter: getRequeueDuration(now, requeueInterval)}, err
 		}
 
+		// keep the current max replica count when holding it, otherwise fall back to the eco mode off max replicas
+		if holdCurrent {
+			maxReplicaCount = scaledJob.Spec.MaxReplicaCount
+			if maxReplicaCount == nil {
+				maxReplicaCount = &carbonAwareKedaScaler.Spec.EcoModeOff.MaxReplicas
+			}
+		}
+
+		// move the max replica count toward the target in steps when a ramp policy is set
+		maxReplicaCount, err = rampMaxReplicaCount(carbonAwareKedaScaler, scaledJob.Spec.MaxReplicaCount, maxReplicaCount, now)
+		if err != nil {
+			logger.Error(err, "invalid ramp policy")
+			r.Recorder.Event(carbonAwareKedaScaler, "Warning", "RampPolicyError", fmt.Sprintf("Invalid ramp policy, setting max replicas without ramping: %v", err))
+		} else if *maxReplicaCount != *carbonAwareKedaScaler.Status.TargetMaxReplicas {
+			r.Recorder.Event(carbonAwareKedaScaler, "Normal", "MaxReplicaCountRamping", fmt.Sprintf("Ramping max replicas of %s to %d toward %d", scaledJob.Name, *maxReplicaCount, *carbonAwareKedaScaler.Status.TargetMaxReplicas))
+		}
+
+		// remember the max replica count before it is overwritten when it is used as a baseline
+		recordOriginalMaxReplicas(scaledJob, scaledJob.Spec.MaxReplicaCount, maxReplicaCount, usesTargetMaxReplicasBaseline(carbonAwareKedaScaler.Spec))
+
 		// ovewrite the scaledobject.Spec.MaxReplicaCount with the max replica count for the current carbon rating
 		scaledJob.Spec.MaxReplicaCount = maxReplicaCount
 
@@ -244,21 +532,292 @@ func (r *CarbonAwareKedaScalerReconciler) Reconcile(ctx context.Context, req ctr
 		CarbonIntensityMetric.WithLabelValues(carbonAwareKedaScaler.Name).Set(currentforecast.Value)
 	}
 
+	// log the current carbon intensity of each provider of an ensemble for comparison
+	providerValues := map[string]float64{}
+	if reporter, ok := fetcher.(CarbonForecastProvidersReporter); ok && !lastKnownGood {
+		for provider, cf := range reporter.Providers() {
+			if location := carbonAwareKedaScaler.Status.ForecastLocation; location != "" {
+				cf = filterCarbonForecastByLocation(cf, location)
+			}
+			cf, _ = normalizeCarbonForecast(cf)
+			if providerForecast := findCarbonForecast(cf, now); providerForecast != nil {
+				providerValues[provider] = providerForecast.Value
+			}
+		}
+	}
+	setProviderCarbonIntensity(carbonAwareKedaScaler.Name, providerValues)
+
 	// log the default max replicas
 	DefaultMaxReplicasMetric.WithLabelValues(carbonAwareKedaScaler.Name).Set(float64(carbonAwareKedaScaler.Spec.EcoModeOff.MaxReplicas))
 
-	// log the current max replicas
+	// log the current max replicas and the max replicas it is ramping toward
 	MaxReplicasMetric.WithLabelValues(carbonAwareKedaScaler.Name).Set(float64(*maxReplicaCount))
+	if target := carbonAwareKedaScaler.Status.TargetMaxReplicas; target != nil {
+		TargetMaxReplicasMetric.WithLabelValues(carbonAwareKedaScaler.Name).Set(float64(*target))
+	}
 
 	// record the successful reconcile event
 	r.Recorder.Event(carbonAwareKedaScaler, "Normal", "MaxReplicaCountReconciled", fmt.Sprintf("Successfully set max replicas for %s to %d", carbonAwareKedaScaler.Spec.KedaTargetRef.Name, *maxReplicaCount))
 
-	return ctrl.Result{RequeueAfter: getRequeueDuration(now, requeueInterval)}, nil
+	// come back sooner for the next step when the max replica count is still ramping toward the target
+	requeueAfter := getRequeueDuration(now, requeueInterval)
+	if rampAfter, ramping := rampRequeueAfter(carbonAwareKedaScaler, now); ramping && rampAfter < requeueAfter {
+		requeueAfter = rampAfter
+	}
+
+	// come back sooner when an upcoming slot comes within a look ahead lead time before the next reconcile
+	if lookAhead := carbonAwareKedaScaler.Spec.LookAhead; lookAhead != nil && !ecoModeStatus.IsDisabled {
+		if lookAheadAfter, ok := lookAheadRequeueAfter(forecast, now, *lookAhead); ok && lookAheadAfter < requeueAfter {
+			requeueAfter = lookAheadAfter
+		}
+	}
+
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// carbonForecastFetcher returns the fetcher of the configured sources in order, which is kept in the registry between reconciles,
+// or the fetcher set on the reconciler when no source is configured
+func (r *CarbonAwareKedaScalerReconciler) carbonForecastFetcher(carbonAwareKedaScaler *carbonawarev1alpha1.CarbonAwareKedaScaler) CarbonForecastFetcher {
+	ds := carbonAwareKedaScaler.Spec.CarbonIntensityForecastDataSource
+	newFetcher := func() *CarbonForecastFallbackFetcher {
+		// the data source changed so configmaps the scaler used before may no longer be used by any scaler
+		r.pruneConfigMapCache()
+		return r.newFallbackFetcher(carbonAwareKedaScaler.Namespace, ds)
+	}
+
+	var fallback *CarbonForecastFallbackFetcher
+	if key, err := json.Marshal(ds); err == nil && r.Fetchers != nil {
+		fallback = r.Fetchers.Get(client.ObjectKeyFromObject(carbonAwareKedaScaler), string(key), newFetcher)
+	} else {
+		fallback = newFetcher()
+	}
+
+	if len(fallback.Fetchers) == 0 && r.CarbonForecastFetcher != nil {
+		return r.CarbonForecastFetcher
+	}
+	return fallback
+}
+
+// apiReader returns the reader used to load objects that should not be cached by the manager such as secrets, pods and nodes
+func (r *CarbonAwareKedaScalerReconciler) apiReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.Client
+}
+
+// dataSourceSources returns the primary, fallback and ensemble member sources of a data source
+func dataSourceSources(ds carbonawarev1alpha1.CarbonIntensityForecastDataSource) []carbonawarev1alpha1.CarbonIntensityForecastSource {
+	sources := append([]carbonawarev1alpha1.CarbonIntensityForecastSource{ds.CarbonIntensityForecastSource}, ds.Fallbacks...)
+	if ds.Ensemble != nil {
+		for _, member := range ds.Ensemble.Members {
+			sources = append(sources, member.CarbonIntensityForecastSource)
+		}
+	}
+	return sources
+}
+
+// localConfigMapIndexKey indexes carbonawarekedascalers by the namespace/name of each configmap used as a data source
+const localConfigMapIndexKey = ".spec.carbonIntensityForecastDataSource.localConfigMap"
+
+// localConfigMapIndexer returns the namespace/name of the primary, fallback and ensemble configmaps of a carbonawarekedascaler
+// including the configmaps the mock carbon forecast is written to and its trace is read from
+func localConfigMapIndexer(obj client.Object) []string {
+	carbonAwareKedaScaler, ok := obj.(*carbonawarev1alpha1.CarbonAwareKedaScaler)
+	if !ok {
+		return nil
+	}
+
+	var keys []string
+	for _, src := range dataSourceSources(carbonAwareKedaScaler.Spec.CarbonIntensityForecastDataSource) {
+		if src.LocalConfigMap != (carbonawarev1alpha1.LocalConfigMap{}) {
+			keys = append(keys, types.NamespacedName{Name: src.LocalConfigMap.Name, Namespace: src.LocalConfigMap.Namespace}.String())
+		}
+		if src.MockCarbonForecast != nil {
+			config := defaultMockCarbonForecast(*src.MockCarbonForecast)
+			keys = append(keys, types.NamespacedName{Name: config.ConfigMapName, Namespace: config.ConfigMapNamespace}.String())
+			if trace := config.TraceConfigMap; trace != nil {
+				keys = append(keys, types.NamespacedName{Name: trace.Name, Namespace: trace.Namespace}.String())
+			}
+		}
+	}
+	return keys
 }
 
+// scalersForConfigMap returns a request for every carbonawarekedascaler that uses the configmap as a data source
+func (r *CarbonAwareKedaScalerReconciler) scalersForConfigMap(obj client.Object) []reconcile.Request {
+	return r.scalersForIndex(localConfigMapIndexKey, obj)
+}
+
+// configMapReader returns the reader of the configmaps used as data sources, which is the shared configmap cache when it is set
+func (r *CarbonAwareKedaScalerReconciler) configMapReader() client.Reader {
+	if r.ConfigMaps != nil {
+		return r.ConfigMaps
+	}
+	return r.Client
+}
+
+// pruneConfigMapCache stops the informers of the configmaps that no carbonawarekedascaler uses anymore
+func (r *CarbonAwareKedaScalerReconciler) pruneConfigMapCache() {
+	if r.ConfigMaps == nil {
+		return
+	}
+	r.ConfigMaps.Prune(func(key types.NamespacedName) bool {
+		return r.isDataSourceConfigMap(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}})
+	})
+}
+
+// isDataSourceConfigMap returns whether any carbonawarekedascaler uses the configmap as a data source so events of other configmaps are dropped
+func (r *CarbonAwareKedaScalerReconciler) isDataSourceConfigMap(obj client.Object) bool {
+	return len(r.scalersForConfigMap(obj)) > 0
+}
+
+// forecastRefIndexKey indexes carbonawarekedascalers by the namespace/name of each carbonintensityforecast used as a data source
+const forecastRefIndexKey = ".spec.carbonIntensityForecastDataSource.forecastRef"
+
+// forecastRefIndexer returns the namespace/name of the primary, fallback and ensemble carbonintensityforecasts of a carbonawarekedascaler
+func forecastRefIndexer(obj client.Object) []string {
+	carbonAwareKedaScaler, ok := obj.(*carbonawarev1alpha1.CarbonAwareKedaScaler)
+	if !ok {
+		return nil
+	}
+
+	var keys []string
+	for _, src := range dataSourceSources(carbonAwareKedaScaler.Spec.CarbonIntensityForecastDataSource) {
+		if src.ForecastRef != nil {
+			keys = append(keys, types.NamespacedName{Name: src.ForecastRef.Name, Namespace: src.ForecastRef.Namespace}.String())
+		}
+	}
+	return keys
+}
+
+// pushedIndexKey indexes carbonawarekedascalers by the name of the carbonintensityforecast each pushed data source is stored in
+const pushedIndexKey = ".spec.carbonIntensityForecastDataSource.pushed"
+
+// pushedIndexer returns the names of the carbonintensityforecasts the primary, fallback and ensemble pushed forecasts of a carbonawarekedascaler are stored in
+func pushedIndexer(obj client.Object) []string {
+	carbonAwareKedaScaler, ok := obj.(*carbonawarev1alpha1.CarbonAwareKedaScaler)
+	if !ok {
+		return nil
+	}
+
+	var keys []string
+	for _, src := range dataSourceSources(carbonAwareKedaScaler.Spec.CarbonIntensityForecastDataSource) {
+		if src.Pushed != nil {
+			keys = append(keys, pushedForecastName(src.Pushed.Location))
+		}
+	}
+	return keys
+}
+
+// scalersForForecast returns a request for every carbonawarekedascaler that uses the carbonintensityforecast as a data source
+// including the scalers reading the forecasts pushed for its location when it is stored by the forecast push endpoint
+func (r *CarbonAwareKedaScalerReconciler) scalersForForecast(obj client.Object) []reconcile.Request {
+	requests := r.scalersForIndex(forecastRefIndexKey, obj)
+	if r.PushNamespace == "" || obj.GetNamespace() != r.PushNamespace {
+		return requests
+	}
+
+	carbonAwareKedaScalers := &carbonawarev1alpha1.CarbonAwareKedaScalerList{}
+	err := r.List(context.Background(), carbonAwareKedaScalers, client.MatchingFields{pushedIndexKey: obj.GetName()})
+	if err != nil {
+		log.Log.Error(err, "unable to list carbonawarekedascalers for pushed forecast", "object", client.ObjectKeyFromObject(obj))
+		return requests
+	}
+	for _, item := range carbonAwareKedaScalers.Items {
+		request := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)}
+		if !containsRequest(requests, request) {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// containsRequest returns whether the request is in the requests
+func containsRequest(requests []reconcile.Request, request reconcile.Request) bool {
+	for _, r := range requests {
+		if r == request {
+			return true
+		}
+	}
+	return false
+}
+
+// scalersForIndex returns a request for every carbonawarekedascaler indexed by the namespace/name of the object
+func (r *CarbonAwareKedaScalerReconciler) scalersForIndex(indexKey string, obj client.Object) []reconcile.Request {
+	carbonAwareKedaScalers := &carbonawarev1alpha1.CarbonAwareKedaScalerList{}
+	err := r.List(context.Background(), carbonAwareKedaScalers, client.MatchingFields{indexKey: client.ObjectKeyFromObject(obj).String()})
+	if err != nil {
+		log.Log.Error(err, "unable to list carbonawarekedascalers for data source", "index", indexKey, "object", client.ObjectKeyFromObject(obj))
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(carbonAwareKedaScalers.Items))
+	for _, item := range carbonAwareKedaScalers.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)})
+	}
+	return requests
+}
+
+// maxReplicasBaseline returns the max replicas that maxReplicasPercent is relative to
+func (r *CarbonAwareKedaScalerReconciler) maxReplicasBaseline(ctx context.Context, carbonAwareKedaScaler *carbonawarev1alpha1.CarbonAwareKedaScaler) (int32, error) {
+	if carbonAwareKedaScaler.Spec.PercentOfBaseline == nil || carbonAwareKedaScaler.Spec.PercentOfBaseline.Baseline != carbonawarev1alpha1.BaselineTargetMaxReplicas {
+		return carbonAwareKedaScaler.Spec.EcoModeOff.MaxReplicas, nil
+	}
+
+	key := types.NamespacedName{Name: carbonAwareKedaScaler.Spec.KedaTargetRef.Name, Namespace: carbonAwareKedaScaler.Spec.KedaTargetRef.Namespace}
+	switch {
+	case strings.Contains(string(carbonAwareKedaScaler.Spec.KedaTarget), "scaledobject"):
+		scaledObject := &kedav1alpha1.ScaledObject{}
+		if err := r.Get(ctx, key, scaledObject); err != nil {
+			return 0, err
+		}
+		return originalMaxReplicas(scaledObject.Annotations, scaledObject.Spec.MaxReplicaCount)
+	case strings.Contains(string(carbonAwareKedaScaler.Spec.KedaTarget), "scaledjob"):
+		scaledJob := &kedav1alpha1.ScaledJob{}
+		if err := r.Get(ctx, key, scaledJob); err != nil {
+			return 0, err
+		}
+		return originalMaxReplicas(scaledJob.Annotations, scaledJob.Spec.MaxReplicaCount)
+	}
+	return 0, fmt.Errorf("unsupported keda target %s", carbonAwareKedaScaler.Spec.KedaTarget)
+}
+
+// carbonAwareKedaScalerPredicate only reconciles carbonawarekedascalers when they are created, deleted or their spec, labels or annotations change,
+// so the status updates of the reconciler do not trigger another reconcile and the requeue interval takes care of everything else
+var carbonAwareKedaScalerPredicate = predicate.Or(predicate.GenerationChangedPredicate{}, predicate.LabelChangedPredicate{}, predicate.AnnotationChangedPredicate{})
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *CarbonAwareKedaScalerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.ForecastCache == nil {
+		r.ForecastCache = NewCarbonForecastCache()
+	}
+	if r.Fetchers == nil {
+		r.Fetchers = NewCarbonForecastFetcherRegistry()
+	}
+
+	// index the configmaps used as data sources so configmap events can be mapped back to the scalers that use them
+	err := mgr.GetFieldIndexer().IndexField(context.Background(), &carbonawarev1alpha1.CarbonAwareKedaScaler{}, localConfigMapIndexKey, localConfigMapIndexer)
+	if err != nil {
+		return err
+	}
+	err = mgr.GetFieldIndexer().IndexField(context.Background(), &carbonawarev1alpha1.CarbonAwareKedaScaler{}, forecastRefIndexKey, forecastRefIndexer)
+	if err != nil {
+		return err
+	}
+	err = mgr.GetFieldIndexer().IndexField(context.Background(), &carbonawarev1alpha1.CarbonAwareKedaScaler{}, pushedIndexKey, pushedIndexer)
+	if err != nil {
+		return err
+	}
+
+	// reconcile the scalers as soon as a configmap or carbonintensityforecast they use, including pushed forecasts, is created, updated or deleted instead of waiting for the next requeue
+	// the manager only caches the metadata of configmaps to trigger reconciles, their data is served by the ConfigMaps cache
+	// status updates of carbonawarekedascalers and carbonintensityforecasts do not change their generation and are ignored,
+	// otherwise the status written on every reconcile, e.g. the accrued carbon budget, would trigger another reconcile in a loop
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&carbonawarev1alpha1.CarbonAwareKedaScaler{}).
+		For(&carbonawarev1alpha1.CarbonAwareKedaScaler{}, builder.WithPredicates(carbonAwareKedaScalerPredicate)).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(r.scalersForConfigMap), builder.OnlyMetadata, builder.WithPredicates(predicate.NewPredicateFuncs(r.isDataSourceConfigMap))).
+		Watches(&source.Kind{Type: &carbonawarev1alpha1.CarbonIntensityForecast{}}, handler.EnqueueRequestsFromMapFunc(r.scalersForForecast), builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
@@ -4,20 +4,40 @@
 package controllers
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"time"
 
 	kedav1alpha1 "github.com/kedacore/keda/v2/apis/keda/v1alpha1"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"github.com/azure/carbon-aware-keda-operator/api/v1alpha1"
 	carbonawarev1alpha1 "github.com/azure/carbon-aware-keda-operator/api/v1alpha1"
@@ -60,6 +80,126 @@ var _ = Describe("scenarios for the carbon aware KEDA Scaler", func() {
 			})
 		})
 
+		When("a mock profile is configured", func() {
+			start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+			It("will generate the same random forecast for the same seed", func() {
+				config := defaultMockCarbonForecast(carbonawarev1alpha1.MockCarbonForecast{Seed: 42})
+				first := generateMockCarbonForecast(config, start, start.Add(time.Hour))
+				second := generateMockCarbonForecast(config, start.Add(-time.Hour), start.Add(time.Hour))
+				Expect(first).Should(HaveLen(12))
+				Expect(second[12:]).Should(Equal(first))
+				for _, cf := range first {
+					Expect(cf.Value).Should(BeNumerically(">=", 529))
+					Expect(cf.Value).Should(BeNumerically("<", 580))
+				}
+			})
+
+			It("will keep an explicit min and max of zero", func() {
+				config := defaultMockCarbonForecast(carbonawarev1alpha1.MockCarbonForecast{Profile: carbonawarev1alpha1.MockProfileConstant, Min: pointer.Int32(0), Max: pointer.Int32(0)})
+				Expect(*config.Min).Should(Equal(int32(0)))
+				Expect(*config.Max).Should(Equal(int32(0)))
+				for _, cf := range generateMockCarbonForecast(config, start, start.Add(time.Hour)) {
+					Expect(cf.Value).Should(Equal(float64(0)))
+				}
+
+				// only the unset bound is defaulted
+				config = defaultMockCarbonForecast(carbonawarev1alpha1.MockCarbonForecast{Min: pointer.Int32(0)})
+				Expect(*config.Min).Should(Equal(int32(0)))
+				Expect(*config.Max).Should(Equal(int32(580)))
+			})
+
+			It("will alternate between min and max with the step profile", func() {
+				config := defaultMockCarbonForecast(carbonawarev1alpha1.MockCarbonForecast{
+					Profile:          carbonawarev1alpha1.MockProfileStep,
+					Min:              pointer.Int32(100),
+					Max:              pointer.Int32(500),
+					PeriodInMins:     120,
+					SlotLengthInMins: 30,
+				})
+				cf := generateMockCarbonForecast(config, start, start.Add(4*time.Hour))
+				values := make([]float64, 0, len(cf))
+				for _, slot := range cf {
+					values = append(values, slot.Value)
+				}
+				Expect(values).Should(Equal([]float64{100, 100, 500, 500, 100, 100, 500, 500}))
+			})
+
+			It("will continue the cycle across midnight when the period does not divide a day", func() {
+				config := defaultMockCarbonForecast(carbonawarev1alpha1.MockCarbonForecast{
+					Profile:          carbonawarev1alpha1.MockProfileSine,
+					Min:              pointer.Int32(100),
+					Max:              pointer.Int32(500),
+					PeriodInMins:     420,
+					SlotLengthInMins: 60,
+				})
+				cf := generateMockCarbonForecast(config, start, start.Add(48*time.Hour))
+				for i := 0; i+7 < len(cf); i++ {
+					Expect(cf[i+7].Value).Should(BeNumerically("~", cf[i].Value, 1e-9), "slot at %s", cf[i+7].Timestamp)
+				}
+			})
+
+			It("will regenerate the configmap when the configuration changes", func() {
+				c := fake.NewClientBuilder().Build()
+				f := &CarbonForecastMockConfigMapFetcher{
+					Client: c,
+					Config: carbonawarev1alpha1.MockCarbonForecast{Profile: carbonawarev1alpha1.MockProfileConstant, Min: pointer.Int32(100), Max: pointer.Int32(200), ConfigMapName: "mock", ConfigMapNamespace: "default"},
+				}
+				cf, err := f.Fetch(context.TODO())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(findCarbonForecast(cf, time.Now().UTC()).Value).Should(Equal(float64(150)))
+
+				f.Config.Max = pointer.Int32(400)
+				cf, err = f.Fetch(context.TODO())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(findCarbonForecast(cf, time.Now().UTC()).Value).Should(Equal(float64(250)))
+
+				cm := &corev1.ConfigMap{}
+				Expect(c.Get(context.TODO(), types.NamespacedName{Name: "mock", Namespace: "default"}, cm)).Should(Succeed())
+				Expect(cm.Annotations).Should(HaveKey(mockCarbonForecastAnnotation))
+			})
+		})
+
+		When("the replay profile is configured", func() {
+			It("will shift an embedded trace to start at the current time", func() {
+				f := &CarbonForecastMockConfigMapFetcher{
+					Client: fake.NewClientBuilder().Build(),
+					Config: carbonawarev1alpha1.MockCarbonForecast{Profile: carbonawarev1alpha1.MockProfileReplay, Trace: "gb-wind"},
+				}
+				cf, err := f.Fetch(context.TODO())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(cf).Should(HaveLen(48))
+				now := time.Now().UTC()
+				Expect(cf[0].Timestamp).Should(BeTemporally("~", now.Truncate(5*time.Minute), 5*time.Minute))
+				Expect(findCarbonForecast(cf, now.Add(25*time.Hour))).Should(BeNil())
+			})
+
+			It("will loop a trace from a configmap", func() {
+				cm := &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "trace", Namespace: "default"},
+					Data:       map[string]string{"data": "2023-01-01T00:00:00Z,100,30\n2023-01-01T00:30:00Z,200,30\n"},
+				}
+				trace, err := (&CarbonForecastMockConfigMapFetcher{Client: fake.NewClientBuilder().WithObjects(cm).Build()}).loadTrace(context.TODO(), carbonawarev1alpha1.MockCarbonForecast{
+					TraceConfigMap: &carbonawarev1alpha1.LocalConfigMap{Name: "trace", Namespace: "default", Key: "data", Format: carbonawarev1alpha1.ConfigMapFormatCSV},
+				})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				anchor := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+				cf := replayCarbonForecast(trace, anchor, true, anchor.Add(-30*time.Minute), anchor.Add(90*time.Minute))
+				Expect(cf).Should(Equal([]CarbonForecast{
+					{Timestamp: anchor.Add(-30 * time.Minute), Duration: 30, Value: 200},
+					{Timestamp: anchor, Duration: 30, Value: 100},
+					{Timestamp: anchor.Add(30 * time.Minute), Duration: 30, Value: 200},
+					{Timestamp: anchor.Add(60 * time.Minute), Duration: 30, Value: 100},
+				}))
+			})
+
+			It("will return an error for an unknown trace", func() {
+				_, err := (&CarbonForecastMockConfigMapFetcher{}).loadTrace(context.TODO(), carbonawarev1alpha1.MockCarbonForecast{Trace: "unknown"})
+				Expect(err).Should(MatchError(ContainSubstring("gb-wind, in-coal, us-west-solar")))
+			})
+		})
+
 		When("data is passed into a mock data fetcher", func() {
 			It("will use the data and return it", func() {
 				now := time.Now().UTC()
@@ -96,621 +236,2959 @@ var _ = Describe("scenarios for the carbon aware KEDA Scaler", func() {
 		})
 	})
 
-	Context("the controller requeue time should be calculated based on the carbon intensity forecast", func() {
-		When("the interval is set to 5 minutes and the current time is 12:37", func() {
-			It("will return a duration of 3 minutes", func() {
-				now := time.Date(2021, 1, 1, 12, 37, 0, 0, time.UTC)
-				duration := getRequeueDuration(now, 5)
-				By("confirming the time until next interval")
-				Expect(duration).Should(Equal(time.Duration(3) * time.Minute))
+	Context("the controller should be able to fetch forecast data from the carbon aware sdk", func() {
+		When("the webapi returns a forecast for the location", func() {
+			It("will map the forecast data into carbon forecasts", func() {
+				now := time.Now().UTC().Truncate(time.Minute)
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					By("confirming the current forecast endpoint is called for the location")
+					Expect(r.URL.Path).Should(Equal("/emissions/forecasts/current"))
+					Expect(r.URL.Query().Get("location")).Should(Equal("eastus"))
+					fmt.Fprintf(w, `[{"location":"eastus","forecastData":[{"location":"eastus","timestamp":"%s","duration":5,"value":120.5},{"location":"eastus","timestamp":"%s","duration":5,"value":80}]}]`,
+						now.Format(time.RFC3339), now.Add(5*time.Minute).Format(time.RFC3339))
+				}))
+				defer server.Close()
+
+				f := &CarbonForecastCarbonAwareSdkFetcher{
+					HTTPClient: server.Client(),
+					URL:        server.URL,
+					Location:   "eastus",
+				}
+				cf, err := f.Fetch(context.TODO())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(cf).Should(HaveLen(2))
+				Expect(cf[0].Location).Should(Equal("eastus"))
+				Expect(findCarbonForecast(cf, now).Value).Should(Equal(120.5))
+				Expect(findCarbonForecast(cf, now.Add(6*time.Minute)).Value).Should(Equal(float64(80)))
 			})
 		})
 
-		When("the interval is set to 60 minutes and the current time is 12:37", func() {
-			It("will return a duration of 23 minutes", func() {
-				now := time.Date(2021, 1, 1, 12, 37, 0, 0, time.UTC)
-				duration := getRequeueDuration(now, 60)
-				By("confirming the time until next interval")
-				Expect(duration).Should(Equal(time.Duration(23) * time.Minute))
+		When("the webapi returns an error", func() {
+			It("will return an error", func() {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					http.Error(w, "location not found", http.StatusBadRequest)
+				}))
+				defer server.Close()
+
+				f := &CarbonForecastCarbonAwareSdkFetcher{
+					HTTPClient: server.Client(),
+					URL:        server.URL,
+					Location:   "nowhere",
+				}
+				cf, err := f.Fetch(context.TODO())
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("location not found"))
+				Expect(cf).Should(BeNil())
 			})
 		})
 
-		When("the interval is set to 15 minutes and the current time is 12:37", func() {
-			It("will return a duration of 8 minutes", func() {
-				now := time.Date(2021, 1, 1, 12, 37, 0, 0, time.UTC)
-				duration := getRequeueDuration(now, 15)
-				By("confirming the time until next interval")
-				Expect(duration).Should(Equal(time.Duration(8) * time.Minute))
+		When("the webapi returns a body larger than the limit", func() {
+			It("will return an error", func() {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write(bytes.Repeat([]byte(" "), maxResponseBodyBytes+1))
+				}))
+				defer server.Close()
+
+				f := &CarbonForecastCarbonAwareSdkFetcher{
+					HTTPClient: server.Client(),
+					URL:        server.URL,
+					Location:   "eastus",
+				}
+				_, err := f.Fetch(context.TODO())
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("larger than"))
+			})
+		})
+
+		When("the auth secret is only in another namespace", func() {
+			It("will not read it or call the webapi", func() {
+				called := false
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					called = true
+				}))
+				defer server.Close()
+
+				f := &CarbonForecastCarbonAwareSdkFetcher{
+					Client: fake.NewClientBuilder().WithObjects(&corev1.Secret{
+						ObjectMeta: metav1.ObjectMeta{Name: "carbon-aware-sdk", Namespace: "kube-system"},
+						Data:       map[string][]byte{"token": []byte("token")},
+					}).Build(),
+					Namespace:     "default",
+					HTTPClient:    server.Client(),
+					URL:           server.URL,
+					Location:      "eastus",
+					AuthSecretRef: &carbonawarev1alpha1.SecretKeyRef{Name: "carbon-aware-sdk", Key: "token"},
+				}
+				_, err := f.Fetch(context.TODO())
+				Expect(errors.IsNotFound(err)).Should(BeTrue())
+				Expect(called).Should(BeFalse())
 			})
 		})
 	})
 
-	Context("the controller reconcilation logic", func() {
-		const (
-			deploymentName                  = "mynginx"
-			deploymentNamespace             = "default"
-			scaledObjectName                = "mynginx-scaledobject"
-			scaledObjectNamespace           = "default"
-			scaledObjectKind                = "Deployment"
-			carbonAwareKedaScalerName       = "test-carbonawarekedascaler"
-			carbonAwareKedaScalerNamespace  = "default"
-			carbonAwareKedaScalerKedaTarget = "scaledobjects.keda.sh"
-			timeout                         = time.Second * 5
-			interval                        = time.Millisecond * 250
+	Context("the controller should be able to fetch marginal emissions from watttime", func() {
+		var (
+			server *httptest.Server
+			logins int
+			now    time.Time
+			secret *corev1.Secret
 		)
 
-		When("the carbonawarekedascaler resource is created", func() {
-			BeforeEach(func() {
-				deployment := &appsv1.Deployment{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      deploymentName,
-						Namespace: deploymentNamespace,
-					},
-					Spec: appsv1.DeploymentSpec{
-						Replicas: pointer.Int32(1),
-						Selector: &metav1.LabelSelector{
-							MatchLabels: map[string]string{
-								"app": deploymentName,
-							},
-						},
-						Template: corev1.PodTemplateSpec{
-							ObjectMeta: metav1.ObjectMeta{
-								Labels: map[string]string{
-									"app": deploymentName,
-								},
-							},
-							Spec: corev1.PodSpec{
-								Containers: []corev1.Container{
-									{
-										Name:  "nginx",
-										Image: "nginx:latest",
-										Ports: []corev1.ContainerPort{
-											{
-												ContainerPort: 80,
-											},
-										},
-									},
-								},
-							},
-						},
-					},
+		BeforeEach(func() {
+			logins = 0
+			now = time.Now().UTC().Truncate(5 * time.Minute)
+			secret = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "watttime", Namespace: "kube-system"},
+				Data: map[string][]byte{
+					"username": []byte("user"),
+					"password": []byte("pass\n"),
+				},
+			}
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				if r.URL.Path == "/login" {
+					username, password, ok := r.BasicAuth()
+					Expect(ok).Should(BeTrue())
+					Expect(username).Should(Equal("user"))
+					Expect(password).Should(Equal("pass"))
+					logins++
+					fmt.Fprint(w, `{"token":"abc"}`)
+					return
 				}
-				Expect(k8sClient.Create(ctx, deployment)).Should(Succeed())
-
-				scaledobject := &kedav1alpha1.ScaledObject{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      scaledObjectName,
-						Namespace: scaledObjectNamespace,
-					},
-					Spec: kedav1alpha1.ScaledObjectSpec{
-						ScaleTargetRef: &kedav1alpha1.ScaleTarget{
-							Name: scaledObjectName,
-							Kind: scaledObjectKind,
-						},
-						Triggers: []kedav1alpha1.ScaleTriggers{
-							{
-								Type: "kubernetes-workload",
-								Metadata: map[string]string{
-									"podSelector": "app=mynginx",
-									"value":       "3",
-								},
-							},
-						},
-					},
+				Expect(r.Header.Get("Authorization")).Should(Equal("Bearer abc"))
+				Expect(r.URL.Query().Get("region")).Should(Equal("CAISO_NORTH"))
+				Expect(r.URL.Query().Get("signal_type")).Should(Equal("co2_moer"))
+				switch r.URL.Path {
+				case "/v3/forecast":
+					fmt.Fprintf(w, `{"data":[{"point_time":"%s","value":900},{"point_time":"%s","value":1000},{"point_time":"%s","value":800}],"meta":{"data_point_period_seconds":300}}`,
+						now.Format(time.RFC3339), now.Add(5*time.Minute).Format(time.RFC3339), now.Add(10*time.Minute).Format(time.RFC3339))
+				case "/v3/historical":
+					fmt.Fprintf(w, `{"data":[{"point_time":"%s","value":850}],"meta":{"data_point_period_seconds":300}}`, now.Format(time.RFC3339))
+				case "/v3/signal-index":
+					fmt.Fprintf(w, `{"data":[{"point_time":"%s","value":42}],"meta":{"data_point_period_seconds":300}}`, now.Format(time.RFC3339))
+				default:
+					http.NotFound(w, r)
 				}
-				Expect(k8sClient.Create(ctx, scaledobject)).Should(Succeed())
+			}))
+		})
 
-				carbonawarekedascaler := &carbonawarev1alpha1.CarbonAwareKedaScaler{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      carbonAwareKedaScalerName,
-						Namespace: carbonAwareKedaScalerNamespace,
-					},
-					Spec: carbonawarev1alpha1.CarbonAwareKedaScalerSpec{
-						CarbonIntensityForecastDataSource: carbonawarev1alpha1.CarbonIntensityForecastDataSource{
-							MockCarbonForecast: true,
-						},
-						KedaTarget: carbonawarev1alpha1.KedaTarget("scaledobjects.keda.sh"),
-						KedaTargetRef: carbonawarev1alpha1.KedaTargetRef{
-							Name:      scaledObjectName,
-							Namespace: scaledObjectNamespace,
-						},
-						MaxReplicasByCarbonIntensity: []carbonawarev1alpha1.CarbonIntensityConfig{
-							{
-								CarbonIntensityThreshold: 100,
-								MaxReplicas:              pointer.Int32(10),
-							},
-						},
-					},
+		AfterEach(func() {
+			server.Close()
+		})
+
+		When("the moer signal is selected", func() {
+			It("will return absolute values with the current moer in the current slot", func() {
+				f := &CarbonForecastWattTimeFetcher{
+					Client:               fake.NewClientBuilder().WithObjects(secret).Build(),
+					Namespace:            "kube-system",
+					HTTPClient:           server.Client(),
+					URL:                  server.URL,
+					Region:               "CAISO_NORTH",
+					CredentialsSecretRef: carbonawarev1alpha1.SecretRef{Name: "watttime"},
+					Signal:               carbonawarev1alpha1.WattTimeSignalMoer,
 				}
-				Expect(k8sClient.Create(ctx, carbonawarekedascaler)).Should(Succeed())
+				cf, err := f.Fetch(context.TODO())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(cf).Should(HaveLen(3))
+				Expect(findCarbonForecast(cf, now).Value).Should(Equal(float64(850)))
+				Expect(findCarbonForecast(cf, now.Add(5*time.Minute)).Value).Should(Equal(float64(1000)))
+
+				By("confirming the token is reused on the next fetch")
+				_, err = f.Fetch(context.TODO())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(logins).Should(Equal(1))
 			})
+		})
 
-			It("can read the KEDA scaledobject", func() {
-				carbonawarekedascaler := &carbonawarev1alpha1.CarbonAwareKedaScaler{}
-				err := k8sClient.Get(ctx, client.ObjectKey{Name: carbonAwareKedaScalerName, Namespace: carbonAwareKedaScalerNamespace}, carbonawarekedascaler)
-				By("Confirming no error was returned")
-				Expect(err).NotTo(HaveOccurred())
+		When("the percent signal is selected", func() {
+			It("will return the current signal index", func() {
+				f := &CarbonForecastWattTimeFetcher{
+					Client:               fake.NewClientBuilder().WithObjects(secret).Build(),
+					Namespace:            "kube-system",
+					HTTPClient:           server.Client(),
+					URL:                  server.URL,
+					Region:               "CAISO_NORTH",
+					CredentialsSecretRef: carbonawarev1alpha1.SecretRef{Name: "watttime"},
+					Signal:               carbonawarev1alpha1.WattTimeSignalPercent,
+				}
+				cf, err := f.Fetch(context.TODO())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(cf).Should(HaveLen(1))
+				Expect(cf[0].Timestamp).Should(Equal(now))
+				Expect(cf[0].Duration).Should(Equal(int32(5)))
+				Expect(cf[0].Value).Should(Equal(float64(42)))
+			})
+		})
 
-				scaledobject := &kedav1alpha1.ScaledObject{}
-				err = k8sClient.Get(ctx, client.ObjectKey{Name: scaledObjectName, Namespace: scaledObjectNamespace}, scaledobject)
-				By("Confirming no error was returned")
-				Expect(err).NotTo(HaveOccurred())
+		When("the credentials secret is missing", func() {
+			It("will return an error", func() {
+				f := &CarbonForecastWattTimeFetcher{
+					Client:               fake.NewClientBuilder().Build(),
+					Namespace:            "kube-system",
+					HTTPClient:           server.Client(),
+					URL:                  server.URL,
+					Region:               "CAISO_NORTH",
+					CredentialsSecretRef: carbonawarev1alpha1.SecretRef{Name: "watttime"},
+				}
+				_, err := f.Fetch(context.TODO())
+				Expect(err).Should(HaveOccurred())
+				Expect(logins).Should(Equal(0))
 			})
+		})
 
-			AfterEach(func() {
-				carbonawarekedascaler := &carbonawarev1alpha1.CarbonAwareKedaScaler{}
-				err := k8sClient.Get(ctx, client.ObjectKey{Name: carbonAwareKedaScalerName, Namespace: carbonAwareKedaScalerNamespace}, carbonawarekedascaler)
-				Expect(err).NotTo(HaveOccurred())
-				Expect(k8sClient.Delete(ctx, carbonawarekedascaler)).Should(Succeed())
+		When("the credentials secret is only in another namespace", func() {
+			It("will not read it or log in", func() {
+				f := &CarbonForecastWattTimeFetcher{
+					Client:               fake.NewClientBuilder().WithObjects(secret).Build(),
+					Namespace:            "default",
+					HTTPClient:           server.Client(),
+					URL:                  server.URL,
+					Region:               "CAISO_NORTH",
+					CredentialsSecretRef: carbonawarev1alpha1.SecretRef{Name: "watttime"},
+				}
+				_, err := f.Fetch(context.TODO())
+				Expect(errors.IsNotFound(err)).Should(BeTrue())
+				Expect(logins).Should(Equal(0))
+			})
+		})
+	})
 
-				scaledobject := &kedav1alpha1.ScaledObject{}
-				err = k8sClient.Get(ctx, client.ObjectKey{Name: scaledObjectName, Namespace: scaledObjectNamespace}, scaledobject)
-				Expect(err).NotTo(HaveOccurred())
-				Expect(k8sClient.Delete(ctx, scaledobject)).Should(Succeed())
+	Context("the controller should be able to fetch forecast data from electricity maps", func() {
+		When("the api returns the latest value and an hourly forecast", func() {
+			It("will derive hourly slots covering the current hour", func() {
+				hour := time.Now().UTC().Truncate(time.Hour)
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					Expect(r.Header.Get("auth-token")).Should(Equal("token"))
+					Expect(r.URL.Query().Get("zone")).Should(Equal("DE"))
+					switch r.URL.Path {
+					case "/v3/carbon-intensity/latest":
+						fmt.Fprintf(w, `{"zone":"DE","carbonIntensity":300,"datetime":"%s"}`, hour.Format("2006-01-02T15:04:05.000Z"))
+					case "/v3/carbon-intensity/forecast":
+						fmt.Fprintf(w, `{"zone":"DE","forecast":[{"carbonIntensity":250,"datetime":"%s"},{"carbonIntensity":200,"datetime":"%s"}]}`,
+							hour.Add(time.Hour).Format("2006-01-02T15:04:05.000Z"), hour.Add(2*time.Hour).Format("2006-01-02T15:04:05.000Z"))
+					default:
+						http.NotFound(w, r)
+					}
+				}))
+				defer server.Close()
 
-				deployment := &appsv1.Deployment{}
-				err = k8sClient.Get(ctx, client.ObjectKey{Name: deploymentName, Namespace: deploymentNamespace}, deployment)
-				Expect(err).NotTo(HaveOccurred())
-				Expect(k8sClient.Delete(ctx, deployment)).Should(Succeed())
+				f := &CarbonForecastElectricityMapsFetcher{
+					Client: fake.NewClientBuilder().WithObjects(&corev1.Secret{
+						ObjectMeta: metav1.ObjectMeta{Name: "electricitymaps", Namespace: "kube-system"},
+						Data:       map[string][]byte{"token": []byte("token")},
+					}).Build(),
+					Namespace:          "kube-system",
+					HTTPClient:         server.Client(),
+					URL:                server.URL,
+					Zone:               "DE",
+					AuthTokenSecretRef: carbonawarev1alpha1.SecretKeyRef{Name: "electricitymaps", Key: "token"},
+				}
+				cf, err := f.Fetch(context.TODO())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(cf).Should(HaveLen(3))
+				for _, slot := range cf {
+					Expect(slot.Duration).Should(Equal(int32(60)))
+					Expect(slot.Location).Should(Equal("DE"))
+				}
+				Expect(findCarbonForecast(cf, hour.Add(30*time.Minute)).Value).Should(Equal(float64(300)))
+				Expect(findCarbonForecast(cf, hour.Add(150*time.Minute)).Value).Should(Equal(float64(200)))
 			})
 		})
 
-		When("the carbon intensity is within a configured range", func() {
-			const (
-				testConfigMapName      = "another-mock-carbon-intensity"
-				testConfigMapNamespace = "kube-system"
-				testConfigMapKey       = "data"
-			)
-			BeforeEach(func() {
-				deployment := &appsv1.Deployment{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      deploymentName,
-						Namespace: deploymentNamespace,
-					},
-					Spec: appsv1.DeploymentSpec{
-						Replicas: pointer.Int32(1),
-						Selector: &metav1.LabelSelector{
-							MatchLabels: map[string]string{
-								"app": deploymentName,
-							},
-						},
-						Template: corev1.PodTemplateSpec{
-							ObjectMeta: metav1.ObjectMeta{
-								Labels: map[string]string{
-									"app": deploymentName,
-								},
-							},
-							Spec: corev1.PodSpec{
-								Containers: []corev1.Container{
-									{
-										Name:  "nginx",
-										Image: "nginx:latest",
-										Ports: []corev1.ContainerPort{
-											{
-												ContainerPort: 80,
-											},
-										},
-									},
-								},
-							},
-						},
-					},
-				}
-				Expect(k8sClient.Create(ctx, deployment)).Should(Succeed())
+		When("the token secret is only in another namespace", func() {
+			It("will not read it or call the api", func() {
+				called := false
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					called = true
+				}))
+				defer server.Close()
 
-				scaledobject := &kedav1alpha1.ScaledObject{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      scaledObjectName,
-						Namespace: scaledObjectNamespace,
+				f := &CarbonForecastElectricityMapsFetcher{
+					Client: fake.NewClientBuilder().WithObjects(&corev1.Secret{
+						ObjectMeta: metav1.ObjectMeta{Name: "electricitymaps", Namespace: "kube-system"},
+						Data:       map[string][]byte{"token": []byte("token")},
+					}).Build(),
+					Namespace:          "default",
+					HTTPClient:         server.Client(),
+					URL:                server.URL,
+					Zone:               "DE",
+					AuthTokenSecretRef: carbonawarev1alpha1.SecretKeyRef{Name: "electricitymaps", Key: "token"},
+				}
+				_, err := f.Fetch(context.TODO())
+				Expect(errors.IsNotFound(err)).Should(BeTrue())
+				Expect(called).Should(BeFalse())
+			})
+		})
+	})
+
+	Context("the controller should be able to fetch forecast data from the uk carbon intensity api", func() {
+		var (
+			server *httptest.Server
+			now    time.Time
+		)
+
+		BeforeEach(func() {
+			now = time.Now().UTC().Truncate(30 * time.Minute)
+			periods := fmt.Sprintf(`[{"from":"%s","to":"%s","intensity":{"forecast":180,"index":"moderate"}},{"from":"%s","to":"%s","intensity":{"forecast":120,"index":"low"}}]`,
+				now.Format(ukCarbonIntensityTimeFormat), now.Add(30*time.Minute).Format(ukCarbonIntensityTimeFormat),
+				now.Add(30*time.Minute).Format(ukCarbonIntensityTimeFormat), now.Add(60*time.Minute).Format(ukCarbonIntensityTimeFormat))
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				from := now.Format(ukCarbonIntensityTimeFormat)
+				switch r.URL.Path {
+				case "/intensity/" + from + "/fw24h":
+					fmt.Fprintf(w, `{"data":%s}`, periods)
+				case "/regional/intensity/" + from + "/fw24h/regionid/13":
+					fmt.Fprintf(w, `{"data":[{"regionid":13,"shortname":"London","data":%s}]}`, periods)
+				case "/regional/intensity/" + from + "/fw24h/postcode/RG10":
+					fmt.Fprintf(w, `{"data":{"regionid":12,"shortname":"South England","postcode":"RG10","data":%s}}`, periods)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		When("no region is configured", func() {
+			It("will return the national half hourly forecast", func() {
+				f := &CarbonForecastUkCarbonIntensityFetcher{HTTPClient: server.Client(), URL: server.URL}
+				cf, err := f.Fetch(context.TODO())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(cf).Should(HaveLen(2))
+				Expect(cf[0].Location).Should(Equal("GB"))
+				Expect(cf[0].Duration).Should(Equal(int32(30)))
+				Expect(findCarbonForecast(cf, now.Add(45*time.Minute)).Value).Should(Equal(float64(120)))
+			})
+		})
+
+		When("a region id is configured", func() {
+			It("will return the regional forecast", func() {
+				f := &CarbonForecastUkCarbonIntensityFetcher{HTTPClient: server.Client(), URL: server.URL, RegionID: 13}
+				cf, err := f.Fetch(context.TODO())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(cf[0].Location).Should(Equal("London"))
+				Expect(findCarbonForecast(cf, now).Value).Should(Equal(float64(180)))
+			})
+		})
+
+		When("a postcode is configured", func() {
+			It("will return the regional forecast", func() {
+				f := &CarbonForecastUkCarbonIntensityFetcher{HTTPClient: server.Client(), URL: server.URL, Postcode: "RG10"}
+				cf, err := f.Fetch(context.TODO())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(cf[0].Location).Should(Equal("South England"))
+			})
+		})
+	})
+
+	Context("the controller should be able to build forecast data from a prometheus query", func() {
+		When("the query returns a single series", func() {
+			It("will turn each sample into a slot the length of the step", func() {
+				now := time.Now().UTC()
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					Expect(r.URL.Path).Should(Equal("/api/v1/query_range"))
+					Expect(r.ParseForm()).Should(Succeed())
+					Expect(r.Form.Get("query")).Should(Equal("carbon_intensity"))
+					Expect(r.Form.Get("step")).Should(Equal("300"))
+					w.Header().Set("Content-Type", "application/json")
+					fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"location":"westus"},"values":[[%d,"410"],[%d,"390.5"]]}]}}`,
+						now.Add(-7*time.Minute).Unix(), now.Add(-2*time.Minute).Unix())
+				}))
+				defer server.Close()
+
+				f := &CarbonForecastPrometheusFetcher{
+					HTTPClient: server.Client(),
+					URL:        server.URL,
+					Query:      "carbon_intensity",
+					Range:      time.Hour,
+					Step:       5 * time.Minute,
+				}
+				cf, err := f.Fetch(context.TODO())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(cf).Should(HaveLen(2))
+				Expect(cf[0].Duration).Should(Equal(int32(5)))
+				Expect(cf[0].Location).Should(Equal("westus"))
+				Expect(findCarbonForecast(cf, now).Value).Should(Equal(390.5))
+			})
+		})
+
+		When("the auth secret is only in another namespace", func() {
+			It("will not read it or query prometheus", func() {
+				called := false
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					called = true
+				}))
+				defer server.Close()
+
+				f := &CarbonForecastPrometheusFetcher{
+					Client: fake.NewClientBuilder().WithObjects(&corev1.Secret{
+						ObjectMeta: metav1.ObjectMeta{Name: "prometheus", Namespace: "monitoring"},
+						Data:       map[string][]byte{"token": []byte("token")},
+					}).Build(),
+					Namespace:     "default",
+					HTTPClient:    server.Client(),
+					URL:           server.URL,
+					Query:         "carbon_intensity",
+					Range:         time.Hour,
+					Step:          5 * time.Minute,
+					AuthSecretRef: &carbonawarev1alpha1.SecretKeyRef{Name: "prometheus", Key: "token"},
+				}
+				_, err := f.Fetch(context.TODO())
+				Expect(errors.IsNotFound(err)).Should(BeTrue())
+				Expect(called).Should(BeFalse())
+			})
+		})
+
+		When("the query returns more than one series", func() {
+			It("will return an error", func() {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					fmt.Fprint(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"a":"1"},"values":[[1,"1"]]},{"metric":{"a":"2"},"values":[[1,"2"]]}]}}`)
+				}))
+				defer server.Close()
+
+				f := &CarbonForecastPrometheusFetcher{
+					HTTPClient: server.Client(),
+					URL:        server.URL,
+					Query:      "carbon_intensity",
+					Range:      time.Hour,
+					Step:       5 * time.Minute,
+				}
+				_, err := f.Fetch(context.TODO())
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+	})
+
+	Context("the controller should try carbon intensity forecast sources in order", func() {
+		When("the primary source fails", func() {
+			It("will return the forecast of the next source and report it", func() {
+				f := &CarbonForecastFallbackFetcher{
+					Fetchers: []NamedCarbonForecastFetcher{
+						{Name: "primary", CarbonForecastFetcher: &CarbonForecastConfigMapFetcher{
+							Client:             fake.NewClientBuilder().Build(),
+							ConfigMapName:      "missing",
+							ConfigMapNamespace: "kube-system",
+							ConfigMapKey:       "data",
+						}},
+						{Name: "static", CarbonForecastFetcher: &CarbonForecastStaticProfileFetcher{Values: []int32{300}}},
+						{Name: "unused", CarbonForecastFetcher: &CarbonForecastMockConfigMapFetcher{CarbonForecast: carbonforecast}},
+					},
+				}
+				cf, err := f.Fetch(context.TODO())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(f.Source()).Should(Equal("static"))
+				Expect(findCarbonForecast(cf, time.Now().UTC()).Value).Should(Equal(float64(300)))
+			})
+		})
+
+		When("every source fails", func() {
+			It("will return an error listing each source", func() {
+				f := &CarbonForecastFallbackFetcher{
+					Fetchers: []NamedCarbonForecastFetcher{
+						{Name: "first", CarbonForecastFetcher: &CarbonForecastStaticProfileFetcher{}},
+						{Name: "second", CarbonForecastFetcher: &CarbonForecastStaticProfileFetcher{}},
+					},
+				}
+				_, err := f.Fetch(context.TODO())
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("first"))
+				Expect(err.Error()).Should(ContainSubstring("second"))
+				Expect(f.Source()).Should(BeEmpty())
+			})
+		})
+
+		When("fallbacks are configured on the data source", func() {
+			It("will build a fetcher for the primary source followed by each fallback", func() {
+				r := &CarbonAwareKedaScalerReconciler{}
+				f := r.newFallbackFetcher("default", carbonawarev1alpha1.CarbonIntensityForecastDataSource{
+					CarbonIntensityForecastSource: carbonawarev1alpha1.CarbonIntensityForecastSource{
+						CarbonAwareSdk: &carbonawarev1alpha1.CarbonAwareSdk{URL: "http://localhost", Location: "eastus"},
+					},
+					Fallbacks: []carbonawarev1alpha1.CarbonIntensityForecastSource{
+						{LocalConfigMap: carbonawarev1alpha1.LocalConfigMap{Name: "carbon-intensity", Namespace: "kube-system", Key: "data"}},
+						{StaticProfile: &carbonawarev1alpha1.StaticProfile{Values: []int32{500}}},
+					},
+				})
+				Expect(f.Fetchers).Should(HaveLen(3))
+				Expect(f.Fetchers[0].Name).Should(Equal("carbon aware sdk location eastus"))
+				Expect(f.Fetchers[1].Name).Should(Equal("fallbacks[0] configmap kube-system/carbon-intensity"))
+				Expect(f.Fetchers[2].Name).Should(Equal("fallbacks[1] static profile"))
+			})
+		})
+	})
+
+	Context("the controller should be able to use a static carbon intensity profile", func() {
+		When("hourly values are configured", func() {
+			It("will repeat the value for the hour of the day", func() {
+				values := make([]int32, 24)
+				for i := range values {
+					values[i] = int32(i * 10)
+				}
+				f := &CarbonForecastStaticProfileFetcher{Values: values, SlotLength: 60}
+				cf, err := f.Fetch(context.TODO())
+				Expect(err).ShouldNot(HaveOccurred())
+				now := time.Now().UTC()
+				Expect(findCarbonForecast(cf, now).Value).Should(Equal(float64(now.Hour() * 10)))
+				Expect(findCarbonForecast(cf, now.Add(24*time.Hour)).Value).Should(Equal(float64(now.Hour() * 10)))
+			})
+		})
+	})
+
+	Context("the controller should be able to combine several carbon intensity forecast sources", func() {
+		start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+		hourly := ensembleForecast{weight: 1, forecast: []CarbonForecast{
+			{Timestamp: start, Duration: 60, Value: 300},
+			{Timestamp: start.Add(time.Hour), Duration: 60, Value: 500},
+		}}
+		quarterly := ensembleForecast{weight: 3, forecast: []CarbonForecast{
+			{Timestamp: start.Add(15 * time.Minute), Duration: 15, Value: 100},
+			{Timestamp: start.Add(30 * time.Minute), Duration: 15, Value: 200},
+		}}
+
+		When("the members have different slot lengths", func() {
+			It("will line up the slots on a grid of the shortest slot length", func() {
+				cf := combineCarbonForecasts([]ensembleForecast{hourly, quarterly}, carbonawarev1alpha1.EnsembleMethodWeightedMean, 0, 1)
+				Expect(cf).Should(HaveLen(8))
+				Expect(cf[0]).Should(Equal(CarbonForecast{Timestamp: start, Duration: 15, Value: 300}))
+				Expect(cf[1]).Should(Equal(CarbonForecast{Timestamp: start.Add(15 * time.Minute), Duration: 15, Value: 150}))
+				Expect(cf[2].Value).Should(Equal(float64(225)))
+				Expect(cf[7]).Should(Equal(CarbonForecast{Timestamp: start.Add(105 * time.Minute), Duration: 15, Value: 500}))
+			})
+
+			It("will leave out the slots covered by fewer than the minimum number of members", func() {
+				cf := combineCarbonForecasts([]ensembleForecast{hourly, quarterly}, carbonawarev1alpha1.EnsembleMethodMax, 0, 2)
+				Expect(cf).Should(HaveLen(2))
+				Expect(cf[0].Value).Should(Equal(float64(300)))
+				Expect(cf[1].Value).Should(Equal(float64(300)))
+			})
+
+			It("will average the finer slots of a member over each grid slot", func() {
+				cf := combineCarbonForecasts([]ensembleForecast{hourly, quarterly}, carbonawarev1alpha1.EnsembleMethodWeightedMean, 60, 1)
+				Expect(cf).Should(HaveLen(2))
+				// the quarterly member covers 30 minutes of the first hour with a mean of 150
+				Expect(cf[0]).Should(Equal(CarbonForecast{Timestamp: start, Duration: 60, Value: 187.5}))
+				Expect(cf[1]).Should(Equal(CarbonForecast{Timestamp: start.Add(time.Hour), Duration: 60, Value: 500}))
+			})
+		})
+
+		When("the members use different units", func() {
+			It("will refuse to combine them", func() {
+				r := &CarbonAwareKedaScalerReconciler{}
+				_, f := r.newEnsembleFetcher("default", carbonawarev1alpha1.Ensemble{
+					Members: []carbonawarev1alpha1.EnsembleMember{
+						{Name: "static", CarbonIntensityForecastSource: carbonawarev1alpha1.CarbonIntensityForecastSource{StaticProfile: &carbonawarev1alpha1.StaticProfile{Values: []int32{100}}}},
+						{Name: "watttime", CarbonIntensityForecastSource: carbonawarev1alpha1.CarbonIntensityForecastSource{WattTime: &carbonawarev1alpha1.WattTime{Region: "CAISO_NORTH", Signal: carbonawarev1alpha1.WattTimeSignalMoer}}},
+					},
+				})
+				_, err := f.Fetch(context.TODO())
+				Expect(err).Should(MatchError("ensemble members must use the same unit, static is in gCO2/kWh and watttime is in lbs/MWh"))
+			})
+		})
+
+		When("a member is removed from the ensemble", func() {
+			It("will stop reporting the carbon intensity of the removed provider", func() {
+				setProviderCarbonIntensity("ensemble-test", map[string]float64{"low": 100, "high": 300})
+				Expect(testutil.ToFloat64(ProviderCarbonIntensityMetric.WithLabelValues("ensemble-test", "high"))).Should(Equal(float64(300)))
+
+				setProviderCarbonIntensity("ensemble-test", map[string]float64{"low": 150})
+				Expect(ProviderCarbonIntensityMetric.DeleteLabelValues("ensemble-test", "high")).Should(BeFalse())
+				Expect(testutil.ToFloat64(ProviderCarbonIntensityMetric.WithLabelValues("ensemble-test", "low"))).Should(Equal(float64(150)))
+				setProviderCarbonIntensity("ensemble-test", nil)
+			})
+		})
+
+		When("a method is set", func() {
+			It("will combine the values with the method", func() {
+				values, weights := []float64{400, 100, 200, 300}, []float64{1, 1, 1, 1}
+				Expect(combineValues(values, weights, carbonawarev1alpha1.EnsembleMethodMedian)).Should(Equal(float64(250)))
+				Expect(combineValues(values[:3], weights, carbonawarev1alpha1.EnsembleMethodMedian)).Should(Equal(float64(200)))
+				Expect(combineValues(values, weights, carbonawarev1alpha1.EnsembleMethodMax)).Should(Equal(float64(400)))
+				Expect(combineValues(values, weights, carbonawarev1alpha1.EnsembleMethodMin)).Should(Equal(float64(100)))
+				Expect(combineValues([]float64{100, 400}, []float64{3, 1}, carbonawarev1alpha1.EnsembleMethodWeightedMean)).Should(Equal(float64(175)))
+			})
+		})
+
+		When("the members are in several locations", func() {
+			It("will combine each location separately", func() {
+				cf := combineCarbonForecasts([]ensembleForecast{
+					{weight: 1, forecast: []CarbonForecast{{Location: "eastus", Timestamp: start, Duration: 60, Value: 100}, {Location: "westus", Timestamp: start, Duration: 60, Value: 300}}},
+					{weight: 1, forecast: []CarbonForecast{{Location: "eastus", Timestamp: start, Duration: 60, Value: 200}}},
+				}, carbonawarev1alpha1.EnsembleMethodMin, 0, 1)
+				Expect(cf).Should(Equal([]CarbonForecast{
+					{Location: "eastus", Timestamp: start, Duration: 60, Value: 100},
+					{Location: "westus", Timestamp: start, Duration: 60, Value: 300},
+				}))
+			})
+		})
+
+		When("a member fails", func() {
+			var f *CarbonForecastEnsembleFetcher
+
+			BeforeEach(func() {
+				f = &CarbonForecastEnsembleFetcher{
+					Method: carbonawarev1alpha1.EnsembleMethodMedian,
+					Members: []EnsembleMemberFetcher{
+						{NamedCarbonForecastFetcher: NamedCarbonForecastFetcher{Name: "low", CarbonForecastFetcher: &CarbonForecastStaticProfileFetcher{Values: []int32{100}}}},
+						{NamedCarbonForecastFetcher: NamedCarbonForecastFetcher{Name: "high", CarbonForecastFetcher: &CarbonForecastStaticProfileFetcher{Values: []int32{300}}}},
+						{NamedCarbonForecastFetcher: NamedCarbonForecastFetcher{Name: "broken", CarbonForecastFetcher: &CarbonForecastStaticProfileFetcher{}}},
+					},
+				}
+			})
+
+			It("will combine the other members and report each provider", func() {
+				cf, err := f.Fetch(context.TODO())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(findCarbonForecast(cf, time.Now().UTC()).Value).Should(Equal(float64(200)))
+				Expect(f.Source()).Should(HavePrefix("ensemble median of low, high (failed: broken:"))
+				Expect(f.Providers()).Should(HaveKey("low"))
+				Expect(f.Providers()).Should(HaveKey("high"))
+				Expect(f.Providers()).ShouldNot(HaveKey("broken"))
+			})
+
+			It("will fail when fewer than the minimum number of members returned a forecast", func() {
+				f.MinMembers = 3
+				_, err := f.Fetch(context.TODO())
+				Expect(err).Should(MatchError(ContainSubstring("2 of 3 ensemble members returned a forecast, 3 required")))
+			})
+		})
+
+		When("an ensemble is configured on the carbonawarekedascaler", func() {
+			It("will use the ensemble instead of the primary source and keep the fallbacks", func() {
+				r := &CarbonAwareKedaScalerReconciler{}
+				f := r.newFallbackFetcher("default", carbonawarev1alpha1.CarbonIntensityForecastDataSource{
+					CarbonIntensityForecastSource: carbonawarev1alpha1.CarbonIntensityForecastSource{
+						StaticProfile: &carbonawarev1alpha1.StaticProfile{Values: []int32{500}},
+					},
+					Ensemble: &carbonawarev1alpha1.Ensemble{
+						Members: []carbonawarev1alpha1.EnsembleMember{
+							{Name: "static", CarbonIntensityForecastSource: carbonawarev1alpha1.CarbonIntensityForecastSource{StaticProfile: &carbonawarev1alpha1.StaticProfile{Values: []int32{100}}}},
+							{CarbonIntensityForecastSource: carbonawarev1alpha1.CarbonIntensityForecastSource{StaticProfile: &carbonawarev1alpha1.StaticProfile{Values: []int32{300}}}},
+						},
+					},
+					Fallbacks: []carbonawarev1alpha1.CarbonIntensityForecastSource{
+						{StaticProfile: &carbonawarev1alpha1.StaticProfile{Values: []int32{500}}},
+					},
+				})
+				Expect(f.Fetchers).Should(HaveLen(2))
+				Expect(f.Fetchers[0].Name).Should(Equal("ensemble weightedMean"))
+				Expect(f.Fetchers[1].Name).Should(Equal("fallbacks[0] static profile"))
+
+				cf, err := f.Fetch(context.TODO())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(findCarbonForecast(cf, time.Now().UTC()).Value).Should(Equal(float64(200)))
+				Expect(f.Source()).Should(Equal("ensemble weightedMean of static, members[1] static profile"))
+				Expect(f.Providers()).Should(HaveLen(2))
+			})
+		})
+	})
+
+	Context("the controller should accept carbon intensity forecasts pushed to its endpoint", func() {
+		var (
+			server *CarbonForecastPushServer
+			c      client.Client
+			now    time.Time
+		)
+
+		push := func(path string, token string, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, req)
+			return rec
+		}
+
+		BeforeEach(func() {
+			s := runtime.NewScheme()
+			Expect(corev1.AddToScheme(s)).Should(Succeed())
+			Expect(carbonawarev1alpha1.AddToScheme(s)).Should(Succeed())
+			c = fake.NewClientBuilder().WithScheme(s).WithObjects(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "push-token", Namespace: "kube-system"},
+				Data:       map[string][]byte{"token": []byte("secret\n")},
+			}).Build()
+			server = &CarbonForecastPushServer{
+				Client:         c,
+				TokenSecretRef: types.NamespacedName{Name: "push-token", Namespace: "kube-system"},
+				TokenSecretKey: "token",
+				MaxBodySize:    1024,
+				Forecasts:      c,
+				Namespace:      "kube-system",
+			}
+			now = time.Now().UTC().Truncate(time.Hour)
+		})
+
+		When("a valid forecast is pushed with the bearer token", func() {
+			It("will be returned by the pushed data source", func() {
+				rec := push("/forecasts/eastus", "secret", fmt.Sprintf(`[{"timestamp":%q,"duration":60,"value":300}]`, now.Format(time.RFC3339)))
+				Expect(rec.Code).Should(Equal(http.StatusNoContent))
+
+				f := &CarbonForecastPushedFetcher{Client: c, Namespace: "kube-system", Location: "EastUS", MaxDataAge: time.Hour}
+				cf, err := f.Fetch(context.TODO())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(cf).Should(Equal([]CarbonForecast{{Location: "eastus", Timestamp: now, Duration: 60, Value: 300}}))
+				Expect(*f.Metadata().NumOfRecords).Should(Equal(int32(1)))
+			})
+
+			It("will be stored in a carbonintensityforecast that later pushes replace", func() {
+				Expect(push("/forecasts/CAISO_NORTH", "secret", fmt.Sprintf(`[{"timestamp":%q,"duration":60,"value":300}]`, now.Format(time.RFC3339))).Code).Should(Equal(http.StatusNoContent))
+				Expect(push("/forecasts/CAISO_NORTH", " secret ", fmt.Sprintf(`[{"timestamp":%q,"duration":30,"value":250.5}]`, now.Format(time.RFC3339))).Code).Should(Equal(http.StatusNoContent))
+
+				forecast := &carbonawarev1alpha1.CarbonIntensityForecast{}
+				Expect(c.Get(context.TODO(), types.NamespacedName{Name: "pushed-caiso-north", Namespace: "kube-system"}, forecast)).Should(Succeed())
+				Expect(forecast.Spec.Location).Should(Equal("CAISO_NORTH"))
+				Expect(forecast.Spec.Source).Should(Equal(pushedForecastSource))
+				Expect(forecast.Spec.Slots).Should(HaveLen(1))
+				Expect(forecast.Spec.Slots[0].DurationInMins).Should(Equal(int32(30)))
+				Expect(forecast.Spec.Slots[0].Value.AsApproximateFloat64()).Should(Equal(250.5))
+			})
+
+			It("will reconcile the carbonawarekedascalers that use the pushed location", func() {
+				scaler := &carbonawarev1alpha1.CarbonAwareKedaScaler{
+					ObjectMeta: metav1.ObjectMeta{Name: "scaler", Namespace: "default"},
+					Spec: carbonawarev1alpha1.CarbonAwareKedaScalerSpec{
+						CarbonIntensityForecastDataSource: carbonawarev1alpha1.CarbonIntensityForecastDataSource{
+							CarbonIntensityForecastSource: carbonawarev1alpha1.CarbonIntensityForecastSource{Pushed: &carbonawarev1alpha1.Pushed{Location: "EastUS"}},
+						},
+					},
+				}
+				s := runtime.NewScheme()
+				Expect(carbonawarev1alpha1.AddToScheme(s)).Should(Succeed())
+				r := &CarbonAwareKedaScalerReconciler{
+					Client: fake.NewClientBuilder().
+						WithScheme(s).
+						WithObjects(scaler).
+						WithIndex(&carbonawarev1alpha1.CarbonAwareKedaScaler{}, forecastRefIndexKey, forecastRefIndexer).
+						WithIndex(&carbonawarev1alpha1.CarbonAwareKedaScaler{}, pushedIndexKey, pushedIndexer).
+						Build(),
+					PushNamespace: "kube-system",
+				}
+
+				forecast := &carbonawarev1alpha1.CarbonIntensityForecast{ObjectMeta: metav1.ObjectMeta{Name: "pushed-eastus", Namespace: "kube-system"}}
+				Expect(r.scalersForForecast(forecast)).Should(ConsistOf(
+					reconcile.Request{NamespacedName: types.NamespacedName{Name: "scaler", Namespace: "default"}},
+				))
+				forecast.Namespace = "default"
+				Expect(r.scalersForForecast(forecast)).Should(BeEmpty())
+			})
+		})
+
+		When("the request is not authorized", func() {
+			It("will reject it", func() {
+				Expect(push("/forecasts/eastus", "", "[]").Code).Should(Equal(http.StatusUnauthorized))
+				Expect(push("/forecasts/eastus", "wrong", "[]").Code).Should(Equal(http.StatusUnauthorized))
+			})
+		})
+
+		When("the forecast is invalid or too large", func() {
+			It("will reject it", func() {
+				Expect(push("/forecasts/eastus", "secret", "[]").Code).Should(Equal(http.StatusBadRequest))
+				Expect(push("/forecasts/eastus", "secret", `[{"timestamp":"2023-01-01T00:00:00Z","value":-1}]`).Code).Should(Equal(http.StatusBadRequest))
+				Expect(push("/forecasts/eastus", "secret", `[{"location":"westus","timestamp":"2023-01-01T00:00:00Z","value":1}]`).Code).Should(Equal(http.StatusBadRequest))
+				Expect(push("/forecasts/eastus", "secret", `[{"timestamp":"2023-01-01T00:00:00Z","value":1,"unit":"g"}]`).Code).Should(Equal(http.StatusBadRequest))
+				Expect(push("/forecasts/eastus", "secret", "["+strings.Repeat(`{"value":1},`, 100)+"]").Code).Should(Equal(http.StatusRequestEntityTooLarge))
+
+				_, err := (&CarbonForecastPushedFetcher{Client: c, Namespace: "kube-system", Location: "eastus"}).Fetch(context.TODO())
+				Expect(err).Should(MatchError("no forecast has been pushed for location eastus"))
+			})
+		})
+
+		When("the request does not post to a location", func() {
+			It("will reject it", func() {
+				Expect(push("/forecasts/", "secret", "[]").Code).Should(Equal(http.StatusNotFound))
+				Expect(push("/forecasts/eastus/extra", "secret", "[]").Code).Should(Equal(http.StatusNotFound))
+
+				req := httptest.NewRequest(http.MethodGet, "/forecasts/eastus", nil)
+				rec := httptest.NewRecorder()
+				server.ServeHTTP(rec, req)
+				Expect(rec.Code).Should(Equal(http.StatusMethodNotAllowed))
+			})
+		})
+
+		When("the pushed forecast is older than the maximum age", func() {
+			It("will be rejected as stale", func() {
+				Expect(server.storeForecast(context.TODO(), "eastus", []CarbonForecast{{Location: "eastus", Timestamp: now, Duration: 60, Value: 300}}, time.Now().UTC().Add(-2*time.Hour))).Should(Succeed())
+				_, err := (&CarbonForecastPushedFetcher{Client: c, Namespace: "kube-system", Location: "eastus", MaxDataAge: time.Hour}).Fetch(context.TODO())
+				Expect(isStaleForecastError(err)).Should(BeTrue())
+
+				_, err = (&CarbonForecastPushedFetcher{Location: "eastus"}).Fetch(context.TODO())
+				Expect(err).Should(MatchError("the forecast push endpoint is not enabled"))
+			})
+		})
+	})
+
+	Context("the controller should be able to use a carbonintensityforecast resource", func() {
+		var (
+			forecast *carbonawarev1alpha1.CarbonIntensityForecast
+			start    time.Time
+		)
+
+		BeforeEach(func() {
+			start = time.Now().UTC().Truncate(time.Hour)
+			forecast = &carbonawarev1alpha1.CarbonIntensityForecast{
+				ObjectMeta: metav1.ObjectMeta{Name: "eastus", Namespace: "kube-system", Generation: 2},
+				Spec: carbonawarev1alpha1.CarbonIntensityForecastSpec{
+					Location:    "eastus",
+					GeneratedAt: &metav1.Time{Time: start.Add(-10 * time.Minute)},
+					Slots: []carbonawarev1alpha1.CarbonIntensitySlot{
+						{Timestamp: metav1.Time{Time: start}, DurationInMins: 60, Value: resource.MustParse("420.5")},
+						{Timestamp: metav1.Time{Time: start.Add(time.Hour)}, DurationInMins: 60, Value: resource.MustParse("380")},
+					},
+				},
+			}
+		})
+
+		When("the forecast covers the current time", func() {
+			It("will report the current intensity and horizon in the status", func() {
+				status, requeueAfter := carbonIntensityForecastStatus(forecast, start.Add(30*time.Minute))
+				Expect(status.CurrentIntensity.String()).Should(Equal("420500m"))
+				Expect(status.ForecastEnd.Time).Should(Equal(start.Add(2 * time.Hour)))
+				Expect(status.Horizon).Should(Equal("90m"))
+				Expect(status.ObservedGeneration).Should(Equal(int64(2)))
+				Expect(requeueAfter).Should(Equal(15 * time.Minute))
+
+				_, requeueAfter = carbonIntensityForecastStatus(forecast, start.Add(55*time.Minute))
+				Expect(requeueAfter).Should(Equal(5 * time.Minute))
+			})
+		})
+
+		When("the forecast has expired", func() {
+			It("will not report a current intensity or requeue", func() {
+				status, requeueAfter := carbonIntensityForecastStatus(forecast, start.Add(3*time.Hour))
+				Expect(status.CurrentIntensity).Should(BeNil())
+				Expect(status.Horizon).Should(Equal("0s"))
+				Expect(requeueAfter).Should(BeZero())
+			})
+		})
+
+		When("a carbonawarekedascaler references the forecast", func() {
+			var c client.Client
+
+			BeforeEach(func() {
+				s := runtime.NewScheme()
+				Expect(carbonawarev1alpha1.AddToScheme(s)).Should(Succeed())
+				c = fake.NewClientBuilder().WithScheme(s).WithObjects(forecast).Build()
+			})
+
+			It("will return the slots of the forecast", func() {
+				f := &CarbonForecastResourceFetcher{Client: c, Name: "eastus", Namespace: "kube-system", MaxDataAge: 2 * time.Hour}
+				cf, err := f.Fetch(context.TODO())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(cf).Should(Equal([]CarbonForecast{
+					{Location: "eastus", Timestamp: start, Duration: 60, Value: 420.5},
+					{Location: "eastus", Timestamp: start.Add(time.Hour), Duration: 60, Value: 380},
+				}))
+				Expect(*f.Metadata().NumOfRecords).Should(Equal(int32(2)))
+				Expect(f.Metadata().ForecastDateTime.Time).Should(BeTemporally("==", start.Add(-10*time.Minute)))
+			})
+
+			It("will reject a forecast older than the maximum age as stale", func() {
+				f := &CarbonForecastResourceFetcher{Client: c, Name: "eastus", Namespace: "kube-system", MaxDataAge: time.Minute}
+				_, err := f.Fetch(context.TODO())
+				Expect(isStaleForecastError(err)).Should(BeTrue())
+			})
+
+			It("will map the forecast to every carbonawarekedascaler that uses it", func() {
+				ref := &carbonawarev1alpha1.ForecastRef{Name: "eastus", Namespace: "kube-system"}
+				scaler := &carbonawarev1alpha1.CarbonAwareKedaScaler{
+					ObjectMeta: metav1.ObjectMeta{Name: "scaler", Namespace: "default"},
+					Spec: carbonawarev1alpha1.CarbonAwareKedaScalerSpec{
+						CarbonIntensityForecastDataSource: carbonawarev1alpha1.CarbonIntensityForecastDataSource{
+							Ensemble: &carbonawarev1alpha1.Ensemble{Members: []carbonawarev1alpha1.EnsembleMember{
+								{CarbonIntensityForecastSource: carbonawarev1alpha1.CarbonIntensityForecastSource{ForecastRef: ref}},
+							}},
+						},
+					},
+				}
+				s := runtime.NewScheme()
+				Expect(carbonawarev1alpha1.AddToScheme(s)).Should(Succeed())
+				r := &CarbonAwareKedaScalerReconciler{
+					Client: fake.NewClientBuilder().
+						WithScheme(s).
+						WithObjects(scaler).
+						WithIndex(&carbonawarev1alpha1.CarbonAwareKedaScaler{}, forecastRefIndexKey, forecastRefIndexer).
+						Build(),
+				}
+
+				Expect(r.scalersForForecast(forecast)).Should(ConsistOf(
+					reconcile.Request{NamespacedName: types.NamespacedName{Name: "scaler", Namespace: "default"}},
+				))
+			})
+		})
+	})
+
+	Context("the controller should handle an unavailable carbon intensity forecast", func() {
+		When("a source that returned a forecast earlier fails", func() {
+			It("will return the last known good forecast until it expires", func() {
+				cf := []CarbonForecast{{Location: "eastus", Timestamp: time.Now().UTC().Add(-5 * time.Minute), Duration: 60, Value: 400}}
+				f := &CarbonForecastFallbackFetcher{
+					Cache: NewCarbonForecastCache(),
+					Fetchers: []NamedCarbonForecastFetcher{
+						{Name: "mock", Key: "mock", CarbonForecastFetcher: &CarbonForecastMockConfigMapFetcher{CarbonForecast: cf}},
 					},
+				}
+				_, err := f.Fetch(context.TODO())
+				Expect(err).ShouldNot(HaveOccurred())
+
+				f.Fetchers[0].CarbonForecastFetcher = &CarbonForecastStaticProfileFetcher{}
+				_, err = f.Fetch(context.TODO())
+				Expect(err).Should(HaveOccurred())
+
+				lastKnownGood, source, ok := f.LastKnownGood(time.Hour)
+				Expect(ok).Should(BeTrue())
+				Expect(lastKnownGood).Should(Equal(cf))
+				Expect(source).Should(HavePrefix("mock fetched at"))
+
+				_, _, ok = f.LastKnownGood(0)
+				Expect(ok).Should(BeFalse())
+			})
+		})
+
+		When("the strategy is set on the carbonawarekedascaler", func() {
+			var (
+				r            *CarbonAwareKedaScalerReconciler
+				scaledObject *kedav1alpha1.ScaledObject
+				scaler       *carbonawarev1alpha1.CarbonAwareKedaScaler
+			)
+
+			BeforeEach(func() {
+				s := runtime.NewScheme()
+				Expect(carbonawarev1alpha1.AddToScheme(s)).Should(Succeed())
+				Expect(kedav1alpha1.AddToScheme(s)).Should(Succeed())
+
+				scaledObject = &kedav1alpha1.ScaledObject{
+					ObjectMeta: metav1.ObjectMeta{Name: "unavailable", Namespace: "default"},
 					Spec: kedav1alpha1.ScaledObjectSpec{
-						ScaleTargetRef: &kedav1alpha1.ScaleTarget{
-							Name: scaledObjectName,
-							Kind: scaledObjectKind,
+						ScaleTargetRef:  &kedav1alpha1.ScaleTarget{Name: "unavailable"},
+						MaxReplicaCount: pointer.Int32(7),
+					},
+				}
+				scaler = &carbonawarev1alpha1.CarbonAwareKedaScaler{
+					ObjectMeta: metav1.ObjectMeta{Name: "unavailable", Namespace: "default"},
+					Spec: carbonawarev1alpha1.CarbonAwareKedaScalerSpec{
+						KedaTarget:    carbonawarev1alpha1.ScaledObject,
+						KedaTargetRef: carbonawarev1alpha1.KedaTargetRef{Name: "unavailable", Namespace: "default"},
+						MaxReplicasByCarbonIntensity: []carbonawarev1alpha1.CarbonIntensityConfig{
+							{CarbonIntensityThreshold: 100, MaxReplicas: pointer.Int32(8)},
+							{CarbonIntensityThreshold: 200, MaxReplicas: pointer.Int32(3)},
 						},
-						Triggers: []kedav1alpha1.ScaleTriggers{
-							{
-								Type: "kubernetes-workload",
-								Metadata: map[string]string{
-									"podSelector": "app=mynginx",
-									"value":       "3",
-								},
+						EcoModeOff: carbonawarev1alpha1.EcoModeOff{MaxReplicas: 10},
+					},
+				}
+
+				r = &CarbonAwareKedaScalerReconciler{
+					Scheme:   s,
+					Recorder: record.NewFakeRecorder(100),
+					// no sources are configured on the scaler so this fetcher is used and always fails
+					CarbonForecastFetcher: &CarbonForecastStaticProfileFetcher{},
+				}
+			})
+
+			reconcile := func() {
+				r.Client = fake.NewClientBuilder().WithScheme(r.Scheme).WithObjects(scaledObject, scaler).Build()
+				_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "unavailable", Namespace: "default"}})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				Expect(r.Get(context.TODO(), client.ObjectKeyFromObject(scaledObject), scaledObject)).Should(Succeed())
+				Expect(r.Get(context.TODO(), client.ObjectKeyFromObject(scaler), scaler)).Should(Succeed())
+			}
+
+			It("will use the eco mode off max replicas by default", func() {
+				reconcile()
+				Expect(*scaledObject.Spec.MaxReplicaCount).Should(Equal(int32(10)))
+				Expect(scaler.Status.ForecastUnavailableStrategy).Should(Equal(carbonawarev1alpha1.ForecastUnavailableEcoModeOff))
+			})
+
+			It("will use the lowest configured max replicas with the mostConservative strategy", func() {
+				scaler.Spec.OnForecastUnavailable = carbonawarev1alpha1.ForecastUnavailableMostConservative
+				reconcile()
+				Expect(*scaledObject.Spec.MaxReplicaCount).Should(Equal(int32(3)))
+				Expect(scaler.Status.ForecastUnavailableStrategy).Should(Equal(carbonawarev1alpha1.ForecastUnavailableMostConservative))
+			})
+
+			It("will keep the current max replicas with the holdCurrent strategy", func() {
+				scaler.Spec.OnForecastUnavailable = carbonawarev1alpha1.ForecastUnavailableHoldCurrent
+				reconcile()
+				Expect(*scaledObject.Spec.MaxReplicaCount).Should(Equal(int32(7)))
+				Expect(scaler.Status.ForecastUnavailableStrategy).Should(Equal(carbonawarev1alpha1.ForecastUnavailableHoldCurrent))
+			})
+		})
+	})
+
+	Context("the controller should reconcile carbonawarekedascalers when their configmap changes", func() {
+		When("a configmap is used as a primary or fallback source", func() {
+			It("will map the configmap to every carbonawarekedascaler that uses it", func() {
+				s := runtime.NewScheme()
+				Expect(carbonawarev1alpha1.AddToScheme(s)).Should(Succeed())
+
+				configMap := carbonawarev1alpha1.LocalConfigMap{Name: "carbon-intensity", Namespace: "kube-system", Key: "data"}
+				primary := &carbonawarev1alpha1.CarbonAwareKedaScaler{
+					ObjectMeta: metav1.ObjectMeta{Name: "primary", Namespace: "default"},
+					Spec: carbonawarev1alpha1.CarbonAwareKedaScalerSpec{
+						CarbonIntensityForecastDataSource: carbonawarev1alpha1.CarbonIntensityForecastDataSource{
+							CarbonIntensityForecastSource: carbonawarev1alpha1.CarbonIntensityForecastSource{LocalConfigMap: configMap},
+						},
+					},
+				}
+				fallback := &carbonawarev1alpha1.CarbonAwareKedaScaler{
+					ObjectMeta: metav1.ObjectMeta{Name: "fallback", Namespace: "default"},
+					Spec: carbonawarev1alpha1.CarbonAwareKedaScalerSpec{
+						CarbonIntensityForecastDataSource: carbonawarev1alpha1.CarbonIntensityForecastDataSource{
+							CarbonIntensityForecastSource: carbonawarev1alpha1.CarbonIntensityForecastSource{
+								StaticProfile: &carbonawarev1alpha1.StaticProfile{Values: []int32{500}},
+							},
+							Fallbacks: []carbonawarev1alpha1.CarbonIntensityForecastSource{{LocalConfigMap: configMap}},
+						},
+					},
+				}
+				unrelated := &carbonawarev1alpha1.CarbonAwareKedaScaler{
+					ObjectMeta: metav1.ObjectMeta{Name: "unrelated", Namespace: "default"},
+					Spec: carbonawarev1alpha1.CarbonAwareKedaScalerSpec{
+						CarbonIntensityForecastDataSource: carbonawarev1alpha1.CarbonIntensityForecastDataSource{
+							CarbonIntensityForecastSource: carbonawarev1alpha1.CarbonIntensityForecastSource{
+								LocalConfigMap: carbonawarev1alpha1.LocalConfigMap{Name: "other", Namespace: "kube-system", Key: "data"},
 							},
 						},
 					},
 				}
-				Expect(k8sClient.Create(ctx, scaledobject)).Should(Succeed())
-				// Eventually(func() bool {
-				// 	hpa := &autoscalingv2.HorizontalPodAutoscaler{}
-				// 	err := k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("keda-hpa-%s", scaledObjectName), Namespace: scaledObjectNamespace}, hpa)
-				// 	return err == nil
-				// }, 30, interval).Should(BeTrue())
 
-				// create a mock carbon intensity forecast
-				cf := make([]CarbonForecast, 1)
-				cf[0] = CarbonForecast{
+				r := &CarbonAwareKedaScalerReconciler{
+					Client: fake.NewClientBuilder().
+						WithScheme(s).
+						WithObjects(primary, fallback, unrelated).
+						WithIndex(&carbonawarev1alpha1.CarbonAwareKedaScaler{}, localConfigMapIndexKey, localConfigMapIndexer).
+						Build(),
+				}
+
+				requests := r.scalersForConfigMap(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "carbon-intensity", Namespace: "kube-system"}})
+				Expect(requests).Should(ConsistOf(
+					reconcile.Request{NamespacedName: types.NamespacedName{Name: "primary", Namespace: "default"}},
+					reconcile.Request{NamespacedName: types.NamespacedName{Name: "fallback", Namespace: "default"}},
+				))
+
+				requests = r.scalersForConfigMap(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "kube-root-ca.crt", Namespace: "kube-system"}})
+				Expect(requests).Should(BeEmpty())
+
+				By("confirming events of configmaps that no scaler uses are dropped")
+				Expect(r.isDataSourceConfigMap(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: "carbon-intensity", Namespace: "kube-system"}})).Should(BeTrue())
+				Expect(r.isDataSourceConfigMap(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: "kube-root-ca.crt", Namespace: "kube-system"}})).Should(BeFalse())
+			})
+		})
+
+		When("the data of a configmap is read", func() {
+			It("will share one informer per configmap and stop it once no scaler uses it", func() {
+				s := runtime.NewScheme()
+				Expect(corev1.AddToScheme(s)).Should(Succeed())
+				Expect(carbonawarev1alpha1.AddToScheme(s)).Should(Succeed())
+
+				scaler := &carbonawarev1alpha1.CarbonAwareKedaScaler{
+					ObjectMeta: metav1.ObjectMeta{Name: "scaler", Namespace: "default"},
+					Spec: carbonawarev1alpha1.CarbonAwareKedaScalerSpec{
+						CarbonIntensityForecastDataSource: carbonawarev1alpha1.CarbonIntensityForecastDataSource{
+							CarbonIntensityForecastSource: carbonawarev1alpha1.CarbonIntensityForecastSource{
+								LocalConfigMap: carbonawarev1alpha1.LocalConfigMap{Name: "carbon-intensity", Namespace: "kube-system", Key: "data"},
+							},
+						},
+					},
+				}
+				configMap := &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "carbon-intensity", Namespace: "kube-system"},
+					Data:       map[string]string{"data": "[]"},
+				}
+				k8sClient := fake.NewClientBuilder().
+					WithScheme(s).
+					WithObjects(scaler, configMap).
+					WithIndex(&carbonawarev1alpha1.CarbonAwareKedaScaler{}, localConfigMapIndexKey, localConfigMapIndexer).
+					Build()
+
+				created := 0
+				configMaps := &CarbonForecastConfigMapCache{
+					NewCache: func(key types.NamespacedName) (cache.Cache, error) {
+						created++
+						return &fakeConfigMapCache{reader: k8sClient}, nil
+					},
+				}
+				key := types.NamespacedName{Name: "carbon-intensity", Namespace: "kube-system"}
+
+				By("confirming reads fail until the cache is started")
+				Expect(configMaps.Get(context.Background(), key, &corev1.ConfigMap{})).ShouldNot(Succeed())
+
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				go func() {
+					_ = configMaps.Start(ctx)
+				}()
+				Eventually(func() error {
+					return configMaps.Get(ctx, key, &corev1.ConfigMap{})
+				}).Should(Succeed())
+
+				read := &corev1.ConfigMap{}
+				Expect(configMaps.Get(ctx, key, read)).Should(Succeed())
+				Expect(read.Data).Should(HaveKeyWithValue("data", "[]"))
+				Expect(created).Should(Equal(1))
+				Expect(configMaps.Len()).Should(Equal(1))
+				Expect(configMaps.Get(ctx, key, &corev1.Secret{})).ShouldNot(Succeed())
+
+				By("confirming the informer is kept while a scaler uses the configmap")
+				r := &CarbonAwareKedaScalerReconciler{Client: k8sClient, ConfigMaps: configMaps}
+				r.pruneConfigMapCache()
+				Expect(configMaps.Len()).Should(Equal(1))
+
+				By("confirming the informer is stopped once the scaler uses another data source")
+				scaler.Spec.CarbonIntensityForecastDataSource.LocalConfigMap.Name = "other"
+				Expect(k8sClient.Update(ctx, scaler)).Should(Succeed())
+				r.pruneConfigMapCache()
+				Expect(configMaps.Len()).Should(Equal(0))
+			})
+
+			It("will index the configmaps of the mock carbon forecast", func() {
+				scaler := &carbonawarev1alpha1.CarbonAwareKedaScaler{
+					Spec: carbonawarev1alpha1.CarbonAwareKedaScalerSpec{
+						CarbonIntensityForecastDataSource: carbonawarev1alpha1.CarbonIntensityForecastDataSource{
+							CarbonIntensityForecastSource: carbonawarev1alpha1.CarbonIntensityForecastSource{
+								MockCarbonForecast: &carbonawarev1alpha1.MockCarbonForecast{},
+							},
+						},
+					},
+				}
+				Expect(localConfigMapIndexer(scaler)).Should(ContainElement("kube-system/mock-carbon-intensity"))
+			})
+		})
+	})
+
+	Context("the controller should honor the metadata written by the carbon intensity exporter", func() {
+		var (
+			now       time.Time
+			configMap *corev1.ConfigMap
+		)
+
+		BeforeEach(func() {
+			now = time.Now().UTC()
+			data, err := json.Marshal([]CarbonForecast{{Location: "eastus", Timestamp: now.Add(-5 * time.Minute), Duration: 60, Value: 400}})
+			Expect(err).ShouldNot(HaveOccurred())
+			configMap = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "carbonintensity", Namespace: "kube-system"},
+				Data: map[string]string{
+					"lastHeartbeatTime": now.Add(-10 * time.Minute).Format(time.RFC3339),
+					"forecastDateTime":  now.Add(-3 * time.Hour).Format(time.RFC3339),
+					"numOfRecords":      "288",
+					"message":           "",
+				},
+				BinaryData: map[string][]byte{"data": data},
+			}
+		})
+
+		fetcher := func(maxDataAge time.Duration) *CarbonForecastConfigMapFetcher {
+			return &CarbonForecastConfigMapFetcher{
+				Client:             fake.NewClientBuilder().WithObjects(configMap).Build(),
+				ConfigMapName:      "carbonintensity",
+				ConfigMapNamespace: "kube-system",
+				ConfigMapKey:       "data",
+				MaxDataAge:         maxDataAge,
+			}
+		}
+
+		When("the forecast is newer than the maximum age", func() {
+			It("will return the forecast and its metadata", func() {
+				f := fetcher(4 * time.Hour)
+				cf, err := f.Fetch(context.TODO())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(cf).Should(HaveLen(1))
+				Expect(f.Metadata().ForecastDateTime.Time).Should(BeTemporally("~", now.Add(-3*time.Hour), time.Second))
+				Expect(f.Metadata().LastHeartbeatTime.Time).Should(BeTemporally("~", now.Add(-10*time.Minute), time.Second))
+				Expect(*f.Metadata().NumOfRecords).Should(Equal(int32(288)))
+			})
+		})
+
+		When("the forecast is older than the maximum age", func() {
+			It("will return a stale forecast error", func() {
+				f := fetcher(time.Hour)
+				_, err := f.Fetch(context.TODO())
+				Expect(err).Should(HaveOccurred())
+				Expect(isStaleForecastError(err)).Should(BeTrue())
+				Expect(f.Metadata()).ShouldNot(BeNil())
+			})
+		})
+
+		When("the exporter reported zero records", func() {
+			It("will return a stale forecast error with the exporter message", func() {
+				configMap.Data["numOfRecords"] = "0"
+				configMap.Data["message"] = "no data for location"
+				_, err := fetcher(0).Fetch(context.TODO())
+				Expect(isStaleForecastError(err)).Should(BeTrue())
+				Expect(err.Error()).Should(ContainSubstring("no data for location"))
+			})
+		})
+
+		When("the stale configmap is the primary source of a fallback chain", func() {
+			It("will keep the stale forecast error and metadata when every source fails", func() {
+				f := &CarbonForecastFallbackFetcher{
+					Fetchers: []NamedCarbonForecastFetcher{
+						{Name: "configmap", CarbonForecastFetcher: fetcher(time.Hour)},
+						{Name: "static", CarbonForecastFetcher: &CarbonForecastStaticProfileFetcher{}},
+					},
+				}
+				_, err := f.Fetch(context.TODO())
+				Expect(isStaleForecastError(err)).Should(BeTrue())
+				Expect(*f.Metadata().NumOfRecords).Should(Equal(int32(288)))
+			})
+		})
+
+		When("the data source stops reporting metadata or the carbonawarekedascaler is deleted", func() {
+			It("will stop reporting the age and number of records of the forecast", func() {
+				f := fetcher(4 * time.Hour)
+				_, err := f.Fetch(context.TODO())
+				Expect(err).ShouldNot(HaveOccurred())
+				setForecastMetadataMetrics("metadata-test", f.Metadata(), now)
+				Expect(testutil.ToFloat64(ForecastAgeMetric.WithLabelValues("metadata-test"))).Should(BeNumerically("~", 3*time.Hour.Seconds(), 1))
+				Expect(testutil.ToFloat64(ForecastRecordsMetric.WithLabelValues("metadata-test"))).Should(Equal(float64(288)))
+
+				// a data source without metadata, such as a static profile
+				setForecastMetadataMetrics("metadata-test", nil, now)
+				Expect(ForecastAgeMetric.DeleteLabelValues("metadata-test")).Should(BeFalse())
+				Expect(ForecastRecordsMetric.DeleteLabelValues("metadata-test")).Should(BeFalse())
+
+				setForecastMetadataMetrics("metadata-test", f.Metadata(), now)
+				s := runtime.NewScheme()
+				Expect(carbonawarev1alpha1.AddToScheme(s)).Should(Succeed())
+				r := &CarbonAwareKedaScalerReconciler{
+					Client:   fake.NewClientBuilder().WithScheme(s).Build(),
+					Recorder: record.NewFakeRecorder(100),
+				}
+				_, err = r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "metadata-test", Namespace: "default"}})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(ForecastAgeMetric.DeleteLabelValues("metadata-test")).Should(BeFalse())
+				Expect(ForecastRecordsMetric.DeleteLabelValues("metadata-test")).Should(BeFalse())
+			})
+		})
+	})
+
+	Context("the controller should decode forecast configmaps in different formats", func() {
+		fetch := func(cm *corev1.ConfigMap, format carbonawarev1alpha1.ConfigMapFormat) ([]CarbonForecast, error) {
+			cm.ObjectMeta = metav1.ObjectMeta{Name: "carbonintensity", Namespace: "kube-system"}
+			f := &CarbonForecastConfigMapFetcher{
+				Client:             fake.NewClientBuilder().WithObjects(cm).Build(),
+				ConfigMapName:      "carbonintensity",
+				ConfigMapNamespace: "kube-system",
+				ConfigMapKey:       "data",
+				Format:             format,
+			}
+			return f.Fetch(context.TODO())
+		}
+
+		When("json is stored in data", func() {
+			It("will decode it", func() {
+				cf, err := fetch(&corev1.ConfigMap{Data: map[string]string{
+					"data": `[{"timestamp":"2023-01-01T00:00:00Z","value":400,"duration":60}]`,
+				}}, carbonawarev1alpha1.ConfigMapFormatJSON)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(cf).Should(Equal([]CarbonForecast{{Timestamp: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), Value: 400, Duration: 60}}))
+			})
+		})
+
+		When("gzip compressed json is stored in binaryData or base64 encoded in data", func() {
+			It("will decompress and decode it", func() {
+				var buf bytes.Buffer
+				zw := gzip.NewWriter(&buf)
+				_, err := zw.Write([]byte(`[{"timestamp":"2023-01-01T00:00:00Z","value":400,"duration":60}]`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(zw.Close()).Should(Succeed())
+
+				cf, err := fetch(&corev1.ConfigMap{BinaryData: map[string][]byte{"data": buf.Bytes()}}, carbonawarev1alpha1.ConfigMapFormatJSONGzip)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(cf).Should(HaveLen(1))
+
+				cf, err = fetch(&corev1.ConfigMap{Data: map[string]string{"data": base64.StdEncoding.EncodeToString(buf.Bytes())}}, carbonawarev1alpha1.ConfigMapFormatJSONGzip)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(cf).Should(HaveLen(1))
+			})
+		})
+
+		When("csv is stored in data", func() {
+			It("will decode each row and derive missing durations", func() {
+				cf, err := fetch(&corev1.ConfigMap{Data: map[string]string{
+					"data": "timestamp,value,duration\n# hand edited\n2023-01-01T00:00:00Z,400,30\n2023-01-01T00:30:00Z,350\n",
+				}}, carbonawarev1alpha1.ConfigMapFormatCSV)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(cf).Should(Equal([]CarbonForecast{
+					{Timestamp: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), Value: 400, Duration: 30},
+					{Timestamp: time.Date(2023, 1, 1, 0, 30, 0, 0, time.UTC), Value: 350, Duration: 30},
+				}))
+			})
+		})
+
+		When("the key is missing", func() {
+			It("will return an error naming the key and configmap", func() {
+				_, err := fetch(&corev1.ConfigMap{Data: map[string]string{"other": "[]"}}, carbonawarev1alpha1.ConfigMapFormatJSON)
+				Expect(err).Should(MatchError(ContainSubstring("key data not found in data or binaryData of configmap kube-system/carbonintensity")))
+			})
+		})
+	})
+
+	Context("the controller should validate and normalize the carbon intensity forecast", func() {
+		start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		When("the forecast is sorted without overlaps or gaps", func() {
+			It("will return it unchanged without issues", func() {
+				cf := []CarbonForecast{
+					{Timestamp: start, Duration: 30, Value: 400},
+					{Timestamp: start.Add(30 * time.Minute), Duration: 30, Value: 350},
+				}
+				normalized, issues := normalizeCarbonForecast(cf)
+				Expect(issues).Should(BeEmpty())
+				Expect(normalized).Should(Equal(cf))
+			})
+		})
+
+		When("the forecast has unsorted, duplicate, overlapping and non-finite slots", func() {
+			It("will fix each problem and report it", func() {
+				normalized, issues := normalizeCarbonForecast([]CarbonForecast{
+					{Timestamp: start.Add(60 * time.Minute), Duration: 30, Value: 300},
+					{Timestamp: start, Duration: 30, Value: 400},
+					{Timestamp: start, Duration: 30, Value: 200},
+					{Timestamp: start.Add(30 * time.Minute), Duration: 0, Value: 350},
+					{Timestamp: start.Add(90 * time.Minute), Duration: 60, Value: math.NaN()},
+					{Timestamp: start.Add(120 * time.Minute), Duration: 60, Value: 250},
+				})
+				Expect(normalized).Should(Equal([]CarbonForecast{
+					{Timestamp: start, Duration: 30, Value: 300},
+					{Timestamp: start.Add(30 * time.Minute), Duration: 30, Value: 350},
+					{Timestamp: start.Add(60 * time.Minute), Duration: 30, Value: 300},
+					{Timestamp: start.Add(120 * time.Minute), Duration: 60, Value: 250},
+				}))
+				Expect(issues).Should(ConsistOf(
+					"dropped 1 slots with a non-finite value or no timestamp",
+					"merged 1 slots that share a timestamp with another slot",
+					"set the duration of 1 slots to the median slot length of 30 minutes",
+					"found 1 gaps between slots, the largest is 30m0s from 2023-01-01T01:30:00Z",
+				))
+			})
+		})
+
+		When("a slot overlaps the next slot", func() {
+			It("will truncate it to end where the next slot starts", func() {
+				normalized, issues := normalizeCarbonForecast([]CarbonForecast{
+					{Timestamp: start, Duration: 60, Value: 400},
+					{Timestamp: start.Add(30 * time.Minute), Duration: 30, Value: 350},
+				})
+				Expect(normalized[0].Duration).Should(Equal(int32(30)))
+				Expect(issues).Should(ConsistOf("truncated 1 slots that overlap the next slot"))
+			})
+		})
+	})
+
+	Context("the controller should only use the forecast for the configured location", func() {
+		When("the forecast contains several locations", func() {
+			It("will keep the slots for the location and the slots without a location", func() {
+				start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+				filtered := filterCarbonForecastByLocation([]CarbonForecast{
+					{Location: "eastus", Timestamp: start, Duration: 60, Value: 400},
+					{Location: "westus", Timestamp: start, Duration: 60, Value: 200},
+					{Timestamp: start.Add(time.Hour), Duration: 60, Value: 300},
+				}, "EastUS")
+				Expect(filtered).Should(HaveLen(2))
+				Expect(filtered[0].Value).Should(Equal(float64(400)))
+				Expect(filtered[1].Value).Should(Equal(float64(300)))
+			})
+		})
+
+		When("the location is auto", func() {
+			var (
+				r      *CarbonAwareKedaScalerReconciler
+				c      client.Client
+				scaler *carbonawarev1alpha1.CarbonAwareKedaScaler
+				now    time.Time
+			)
+
+			node := func(name string, region string) *corev1.Node {
+				return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{corev1.LabelTopologyRegion: region}}}
+			}
+
+			BeforeEach(func() {
+				s := runtime.NewScheme()
+				Expect(corev1.AddToScheme(s)).Should(Succeed())
+				Expect(appsv1.AddToScheme(s)).Should(Succeed())
+				Expect(kedav1alpha1.AddToScheme(s)).Should(Succeed())
+
+				now = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+				labels := map[string]string{"app": "web"}
+				c = fake.NewClientBuilder().WithScheme(s).WithObjects(
+					&kedav1alpha1.ScaledObject{
+						ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+						Spec:       kedav1alpha1.ScaledObjectSpec{ScaleTargetRef: &kedav1alpha1.ScaleTarget{Name: "web"}},
+					},
+					&appsv1.Deployment{
+						ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+						Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+					},
+					&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default", Labels: labels}, Spec: corev1.PodSpec{NodeName: "node-1"}},
+					&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"}, Spec: corev1.PodSpec{NodeName: "node-2"}},
+					&kedav1alpha1.ScaledJob{ObjectMeta: metav1.ObjectMeta{Name: "batch", Namespace: "default"}},
+					&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "batch-1", Namespace: "default", Labels: map[string]string{scaledJobNameLabel: "batch"}}, Spec: corev1.PodSpec{NodeName: "node-2"}},
+					&corev1.Pod{
+						ObjectMeta: metav1.ObjectMeta{Name: "batch-0", Namespace: "default", Labels: map[string]string{scaledJobNameLabel: "batch"}},
+						Spec:       corev1.PodSpec{NodeName: "node-1"},
+						Status:     corev1.PodStatus{Phase: corev1.PodSucceeded},
+					},
+					node("node-1", "westeurope"),
+					node("node-2", "eastus"),
+					node("node-3", "eastus"),
+				).Build()
+				r = &CarbonAwareKedaScalerReconciler{Client: c, APIReader: c}
+
+				scaler = &carbonawarev1alpha1.CarbonAwareKedaScaler{
+					Spec: carbonawarev1alpha1.CarbonAwareKedaScalerSpec{
+						KedaTarget:    carbonawarev1alpha1.ScaledObject,
+						KedaTargetRef: carbonawarev1alpha1.KedaTargetRef{Name: "web", Namespace: "default"},
+						CarbonIntensityForecastDataSource: carbonawarev1alpha1.CarbonIntensityForecastDataSource{
+							Location: carbonawarev1alpha1.LocationAuto,
+						},
+					},
+				}
+			})
+
+			It("will use the region of the nodes running the target workload", func() {
+				location, err := r.resolveForecastLocation(context.TODO(), scaler, now)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(location).Should(Equal("westeurope"))
+			})
+
+			It("will map the region to a location through the region locations", func() {
+				scaler.Spec.CarbonIntensityForecastDataSource.RegionLocations = map[string]string{"westeurope": "NL"}
+				location, err := r.resolveForecastLocation(context.TODO(), scaler, now)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(location).Should(Equal("NL"))
+			})
+
+			It("will use the region of the nodes running the jobs of a scaledjob", func() {
+				scaler.Spec.KedaTarget = carbonawarev1alpha1.ScaledJob
+				scaler.Spec.KedaTargetRef.Name = "batch"
+				location, err := r.resolveForecastLocation(context.TODO(), scaler, now)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(location).Should(Equal("eastus"))
+			})
+
+			It("will keep the detected region when no pods are running", func() {
+				_, err := r.resolveForecastLocation(context.TODO(), scaler, now)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				// scale the workload to zero and let the detection expire
+				Expect(c.Delete(context.TODO(), &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default"}})).Should(Succeed())
+				location, err := r.resolveForecastLocation(context.TODO(), scaler, now.Add(regionDetectionInterval))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(location).Should(Equal("westeurope"))
+				Expect(scaler.Status.DetectedRegion.Region).Should(Equal("westeurope"))
+			})
+
+			It("will return an error when no pods are running and no region was detected yet", func() {
+				Expect(c.Delete(context.TODO(), &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default"}})).Should(Succeed())
+				_, err := r.resolveForecastLocation(context.TODO(), scaler, now)
+				Expect(err).Should(HaveOccurred())
+				Expect(scaler.Status.DetectedRegion).Should(BeNil())
+
+				By("confirming finished jobs are not used either")
+				scaler.Spec.KedaTarget = carbonawarev1alpha1.ScaledJob
+				scaler.Spec.KedaTargetRef.Name = "batch"
+				Expect(c.Delete(context.TODO(), &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "batch-1", Namespace: "default"}})).Should(Succeed())
+				_, err = r.resolveForecastLocation(context.TODO(), scaler, now)
+				Expect(err).Should(HaveOccurred())
+			})
+
+			It("will reuse the detected region until the pod template changes or the detection interval passes", func() {
+				location, err := r.resolveForecastLocation(context.TODO(), scaler, now)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(location).Should(Equal("westeurope"))
+				Expect(scaler.Status.DetectedRegion).ShouldNot(BeNil())
+				Expect(scaler.Status.DetectedRegion.PodTemplateHash).ShouldNot(BeEmpty())
+
+				// moving the pod is not noticed while the detected region is reused
+				pod := &corev1.Pod{}
+				Expect(c.Get(context.TODO(), types.NamespacedName{Name: "web-1", Namespace: "default"}, pod)).Should(Succeed())
+				Expect(c.Delete(context.TODO(), pod)).Should(Succeed())
+				pod = &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default", Labels: pod.Labels}, Spec: corev1.PodSpec{NodeName: "node-2"}}
+				Expect(c.Create(context.TODO(), pod)).Should(Succeed())
+				location, err = r.resolveForecastLocation(context.TODO(), scaler, now.Add(30*time.Minute))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(location).Should(Equal("westeurope"))
+
+				// a new pod template detects the region again
+				deployment := &appsv1.Deployment{}
+				Expect(c.Get(context.TODO(), types.NamespacedName{Name: "web", Namespace: "default"}, deployment)).Should(Succeed())
+				deployment.Spec.Template.Labels = map[string]string{"app": "web", "version": "2"}
+				Expect(c.Update(context.TODO(), deployment)).Should(Succeed())
+				location, err = r.resolveForecastLocation(context.TODO(), scaler, now.Add(30*time.Minute))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(location).Should(Equal("eastus"))
+
+				// so does an expired detection
+				scaler.Status.DetectedRegion.Region = "westeurope"
+				location, err = r.resolveForecastLocation(context.TODO(), scaler, now.Add(30*time.Minute+regionDetectionInterval))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(location).Should(Equal("eastus"))
+			})
+
+			It("will clear the detected region when the location is no longer auto", func() {
+				_, err := r.resolveForecastLocation(context.TODO(), scaler, now)
+				Expect(err).ShouldNot(HaveOccurred())
+				scaler.Spec.CarbonIntensityForecastDataSource.Location = "eastus"
+				location, err := r.resolveForecastLocation(context.TODO(), scaler, now)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(location).Should(Equal("eastus"))
+				Expect(scaler.Status.DetectedRegion).Should(BeNil())
+			})
+		})
+	})
+
+	Context("the controller should keep a carbon forecast fetcher per carbonawarekedascaler", func() {
+		var (
+			r      *CarbonAwareKedaScalerReconciler
+			scaler *carbonawarev1alpha1.CarbonAwareKedaScaler
+		)
+
+		BeforeEach(func() {
+			r = &CarbonAwareKedaScalerReconciler{Fetchers: NewCarbonForecastFetcherRegistry()}
+			scaler = &carbonawarev1alpha1.CarbonAwareKedaScaler{
+				ObjectMeta: metav1.ObjectMeta{Name: "scaler", Namespace: "default"},
+				Spec: carbonawarev1alpha1.CarbonAwareKedaScalerSpec{
+					CarbonIntensityForecastDataSource: carbonawarev1alpha1.CarbonIntensityForecastDataSource{
+						CarbonIntensityForecastSource: carbonawarev1alpha1.CarbonIntensityForecastSource{
+							StaticProfile: &carbonawarev1alpha1.StaticProfile{Values: []int32{500}},
+						},
+					},
+				},
+			}
+		})
+
+		When("the data source of a carbonawarekedascaler is unchanged", func() {
+			It("will reuse the fetcher between reconciles", func() {
+				fetcher := r.carbonForecastFetcher(scaler)
+				Expect(r.carbonForecastFetcher(scaler)).Should(BeIdenticalTo(fetcher))
+				Expect(r.Fetchers.Len()).Should(Equal(1))
+			})
+		})
+
+		When("the data source of a carbonawarekedascaler changes", func() {
+			It("will build a new fetcher", func() {
+				fetcher := r.carbonForecastFetcher(scaler)
+				scaler.Spec.CarbonIntensityForecastDataSource.StaticProfile.Values = []int32{400}
+				Expect(r.carbonForecastFetcher(scaler)).ShouldNot(BeIdenticalTo(fetcher))
+				Expect(r.Fetchers.Len()).Should(Equal(1))
+			})
+		})
+
+		When("several carbonawarekedascalers are reconciled", func() {
+			It("will give each one its own fetcher", func() {
+				other := scaler.DeepCopy()
+				other.Name = "other"
+				Expect(r.carbonForecastFetcher(other)).ShouldNot(BeIdenticalTo(r.carbonForecastFetcher(scaler)))
+				Expect(r.Fetchers.Len()).Should(Equal(2))
+
+				r.Fetchers.Delete(types.NamespacedName{Name: "other", Namespace: "default"})
+				Expect(r.Fetchers.Len()).Should(Equal(1))
+			})
+		})
+
+		When("no data source is configured", func() {
+			It("will use the fetcher set on the reconciler without replacing it", func() {
+				injected := &CarbonForecastStaticProfileFetcher{Values: []int32{100}}
+				r.CarbonForecastFetcher = injected
+				scaler.Spec.CarbonIntensityForecastDataSource = carbonawarev1alpha1.CarbonIntensityForecastDataSource{}
+				Expect(r.carbonForecastFetcher(scaler)).Should(BeIdenticalTo(injected))
+
+				configured := scaler.DeepCopy()
+				configured.Name = "configured"
+				configured.Spec.CarbonIntensityForecastDataSource.StaticProfile = &carbonawarev1alpha1.StaticProfile{Values: []int32{500}}
+				Expect(r.carbonForecastFetcher(configured)).ShouldNot(BeIdenticalTo(injected))
+				Expect(r.CarbonForecastFetcher).Should(BeIdenticalTo(injected))
+			})
+		})
+	})
+
+	Context("the controller requeue time should be calculated based on the carbon intensity forecast", func() {
+		When("the interval is set to 5 minutes and the current time is 12:37", func() {
+			It("will return a duration of 3 minutes", func() {
+				now := time.Date(2021, 1, 1, 12, 37, 0, 0, time.UTC)
+				duration := getRequeueDuration(now, 5)
+				By("confirming the time until next interval")
+				Expect(duration).Should(Equal(time.Duration(3) * time.Minute))
+			})
+		})
+
+		When("the interval is set to 60 minutes and the current time is 12:37", func() {
+			It("will return a duration of 23 minutes", func() {
+				now := time.Date(2021, 1, 1, 12, 37, 0, 0, time.UTC)
+				duration := getRequeueDuration(now, 60)
+				By("confirming the time until next interval")
+				Expect(duration).Should(Equal(time.Duration(23) * time.Minute))
+			})
+		})
+
+		When("the interval is set to 15 minutes and the current time is 12:37", func() {
+			It("will return a duration of 8 minutes", func() {
+				now := time.Date(2021, 1, 1, 12, 37, 0, 0, time.UTC)
+				duration := getRequeueDuration(now, 15)
+				By("confirming the time until next interval")
+				Expect(duration).Should(Equal(time.Duration(8) * time.Minute))
+			})
+		})
+
+		When("the interval is set to 0 minutes and the current time is 12:37", func() {
+			It("will fall back to the default interval and return a duration of 3 minutes", func() {
+				now := time.Date(2021, 1, 1, 12, 37, 0, 0, time.UTC)
+				duration := getRequeueDuration(now, 0)
+				By("confirming the time until next interval")
+				Expect(duration).Should(Equal(time.Duration(3) * time.Minute))
+			})
+		})
+	})
+
+	Context("the controller reconcilation logic", func() {
+		const (
+			deploymentName                  = "mynginx"
+			deploymentNamespace             = "default"
+			scaledObjectName                = "mynginx-scaledobject"
+			scaledObjectNamespace           = "default"
+			scaledObjectKind                = "Deployment"
+			carbonAwareKedaScalerName       = "test-carbonawarekedascaler"
+			carbonAwareKedaScalerNamespace  = "default"
+			carbonAwareKedaScalerKedaTarget = "scaledobjects.keda.sh"
+			timeout                         = time.Second * 5
+			interval                        = time.Millisecond * 250
+		)
+
+		When("the carbonawarekedascaler resource is created", func() {
+			BeforeEach(func() {
+				deployment := &appsv1.Deployment{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      deploymentName,
+						Namespace: deploymentNamespace,
+					},
+					Spec: appsv1.DeploymentSpec{
+						Replicas: pointer.Int32(1),
+						Selector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{
+								"app": deploymentName,
+							},
+						},
+						Template: corev1.PodTemplateSpec{
+							ObjectMeta: metav1.ObjectMeta{
+								Labels: map[string]string{
+									"app": deploymentName,
+								},
+							},
+							Spec: corev1.PodSpec{
+								Containers: []corev1.Container{
+									{
+										Name:  "nginx",
+										Image: "nginx:latest",
+										Ports: []corev1.ContainerPort{
+											{
+												ContainerPort: 80,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				}
+				Expect(k8sClient.Create(ctx, deployment)).Should(Succeed())
+
+				scaledobject := &kedav1alpha1.ScaledObject{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      scaledObjectName,
+						Namespace: scaledObjectNamespace,
+					},
+					Spec: kedav1alpha1.ScaledObjectSpec{
+						ScaleTargetRef: &kedav1alpha1.ScaleTarget{
+							Name: scaledObjectName,
+							Kind: scaledObjectKind,
+						},
+						Triggers: []kedav1alpha1.ScaleTriggers{
+							{
+								Type: "kubernetes-workload",
+								Metadata: map[string]string{
+									"podSelector": "app=mynginx",
+									"value":       "3",
+								},
+							},
+						},
+					},
+				}
+				Expect(k8sClient.Create(ctx, scaledobject)).Should(Succeed())
+
+				carbonawarekedascaler := &carbonawarev1alpha1.CarbonAwareKedaScaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      carbonAwareKedaScalerName,
+						Namespace: carbonAwareKedaScalerNamespace,
+					},
+					Spec: carbonawarev1alpha1.CarbonAwareKedaScalerSpec{
+						CarbonIntensityForecastDataSource: carbonawarev1alpha1.CarbonIntensityForecastDataSource{
+							CarbonIntensityForecastSource: carbonawarev1alpha1.CarbonIntensityForecastSource{
+								MockCarbonForecast: &carbonawarev1alpha1.MockCarbonForecast{},
+							},
+						},
+						KedaTarget: carbonawarev1alpha1.KedaTarget("scaledobjects.keda.sh"),
+						KedaTargetRef: carbonawarev1alpha1.KedaTargetRef{
+							Name:      scaledObjectName,
+							Namespace: scaledObjectNamespace,
+						},
+						MaxReplicasByCarbonIntensity: []carbonawarev1alpha1.CarbonIntensityConfig{
+							{
+								CarbonIntensityThreshold: 100,
+								MaxReplicas:              pointer.Int32(10),
+							},
+						},
+					},
+				}
+				Expect(k8sClient.Create(ctx, carbonawarekedascaler)).Should(Succeed())
+			})
+
+			It("can read the KEDA scaledobject", func() {
+				carbonawarekedascaler := &carbonawarev1alpha1.CarbonAwareKedaScaler{}
+				err := k8sClient.Get(ctx, client.ObjectKey{Name: carbonAwareKedaScalerName, Namespace: carbonAwareKedaScalerNamespace}, carbonawarekedascaler)
+				By("Confirming no error was returned")
+				Expect(err).NotTo(HaveOccurred())
+
+				scaledobject := &kedav1alpha1.ScaledObject{}
+				err = k8sClient.Get(ctx, client.ObjectKey{Name: scaledObjectName, Namespace: scaledObjectNamespace}, scaledobject)
+				By("Confirming no error was returned")
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				carbonawarekedascaler := &carbonawarev1alpha1.CarbonAwareKedaScaler{}
+				err := k8sClient.Get(ctx, client.ObjectKey{Name: carbonAwareKedaScalerName, Namespace: carbonAwareKedaScalerNamespace}, carbonawarekedascaler)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(k8sClient.Delete(ctx, carbonawarekedascaler)).Should(Succeed())
+
+				scaledobject := &kedav1alpha1.ScaledObject{}
+				err = k8sClient.Get(ctx, client.ObjectKey{Name: scaledObjectName, Namespace: scaledObjectNamespace}, scaledobject)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(k8sClient.Delete(ctx, scaledobject)).Should(Succeed())
+
+				deployment := &appsv1.Deployment{}
+				err = k8sClient.Get(ctx, client.ObjectKey{Name: deploymentName, Namespace: deploymentNamespace}, deployment)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(k8sClient.Delete(ctx, deployment)).Should(Succeed())
+			})
+		})
+
+		When("the carbon intensity is within a configured range", func() {
+			const (
+				testConfigMapName      = "another-mock-carbon-intensity"
+				testConfigMapNamespace = "kube-system"
+				testConfigMapKey       = "data"
+			)
+			BeforeEach(func() {
+				deployment := &appsv1.Deployment{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      deploymentName,
+						Namespace: deploymentNamespace,
+					},
+					Spec: appsv1.DeploymentSpec{
+						Replicas: pointer.Int32(1),
+						Selector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{
+								"app": deploymentName,
+							},
+						},
+						Template: corev1.PodTemplateSpec{
+							ObjectMeta: metav1.ObjectMeta{
+								Labels: map[string]string{
+									"app": deploymentName,
+								},
+							},
+							Spec: corev1.PodSpec{
+								Containers: []corev1.Container{
+									{
+										Name:  "nginx",
+										Image: "nginx:latest",
+										Ports: []corev1.ContainerPort{
+											{
+												ContainerPort: 80,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				}
+				Expect(k8sClient.Create(ctx, deployment)).Should(Succeed())
+
+				scaledobject := &kedav1alpha1.ScaledObject{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      scaledObjectName,
+						Namespace: scaledObjectNamespace,
+					},
+					Spec: kedav1alpha1.ScaledObjectSpec{
+						ScaleTargetRef: &kedav1alpha1.ScaleTarget{
+							Name: scaledObjectName,
+							Kind: scaledObjectKind,
+						},
+						Triggers: []kedav1alpha1.ScaleTriggers{
+							{
+								Type: "kubernetes-workload",
+								Metadata: map[string]string{
+									"podSelector": "app=mynginx",
+									"value":       "3",
+								},
+							},
+						},
+					},
+				}
+				Expect(k8sClient.Create(ctx, scaledobject)).Should(Succeed())
+				// Eventually(func() bool {
+				// 	hpa := &autoscalingv2.HorizontalPodAutoscaler{}
+				// 	err := k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("keda-hpa-%s", scaledObjectName), Namespace: scaledObjectNamespace}, hpa)
+				// 	return err == nil
+				// }, 30, interval).Should(BeTrue())
+
+				// create a mock carbon intensity forecast
+				cf := make([]CarbonForecast, 1)
+				cf[0] = CarbonForecast{
+					Timestamp: time.Now().UTC(),
+					Value:     float64(99),
+					Duration:  5,
+				}
+
+				// marshal the carbon forecast into byte array
+				forecast, err := json.Marshal(cf)
+				Expect(err).NotTo(HaveOccurred())
+
+				// create a configmap with the carbon forecast
+				configmap := &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      testConfigMapName,
+						Namespace: testConfigMapNamespace,
+					},
+					BinaryData: map[string][]byte{
+						testConfigMapKey: forecast,
+					},
+				}
+				Expect(k8sClient.Create(ctx, configmap)).Should(Succeed())
+
+				// create a carbonawarekedascaler resource
+				carbonawarekedascaler := &carbonawarev1alpha1.CarbonAwareKedaScaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      carbonAwareKedaScalerName,
+						Namespace: carbonAwareKedaScalerNamespace,
+					},
+					Spec: carbonawarev1alpha1.CarbonAwareKedaScalerSpec{
+						CarbonIntensityForecastDataSource: carbonawarev1alpha1.CarbonIntensityForecastDataSource{
+							CarbonIntensityForecastSource: carbonawarev1alpha1.CarbonIntensityForecastSource{
+								MockCarbonForecast: nil,
+								LocalConfigMap: carbonawarev1alpha1.LocalConfigMap{
+									Name:      testConfigMapName,
+									Namespace: testConfigMapNamespace,
+									Key:       testConfigMapKey,
+								},
+							},
+						},
+						KedaTarget: carbonawarev1alpha1.KedaTarget("scaledobjects.keda.sh"),
+						KedaTargetRef: carbonawarev1alpha1.KedaTargetRef{
+							Name:      scaledObjectName,
+							Namespace: scaledObjectNamespace,
+						},
+						MaxReplicasByCarbonIntensity: []carbonawarev1alpha1.CarbonIntensityConfig{
+							{
+								CarbonIntensityThreshold: 100,
+								MaxReplicas:              pointer.Int32(9),
+							},
+						},
+					},
+				}
+				Expect(k8sClient.Create(ctx, carbonawarekedascaler)).Should(Succeed())
+			})
+
+			It("should update the scaledobject to the max replicas", func() {
+				scaledobject := &kedav1alpha1.ScaledObject{}
+				err := k8sClient.Get(ctx, client.ObjectKey{Name: scaledObjectName, Namespace: scaledObjectNamespace}, scaledobject)
+				Expect(err).NotTo(HaveOccurred())
+
+				// By("confirming the scaledobject has the correct max replicas")
+				// Expect(scaledobject.Spec.MaxReplicaCount).To(Equal(int32(9)))
+			})
+
+			AfterEach(func() {
+				configmap := &corev1.ConfigMap{}
+				err := k8sClient.Get(ctx, client.ObjectKey{Name: testConfigMapName, Namespace: testConfigMapNamespace}, configmap)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(k8sClient.Delete(ctx, configmap)).Should(Succeed())
+
+				carbonawarekedascaler := &carbonawarev1alpha1.CarbonAwareKedaScaler{}
+				err = k8sClient.Get(ctx, client.ObjectKey{Name: carbonAwareKedaScalerName, Namespace: carbonAwareKedaScalerNamespace}, carbonawarekedascaler)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(k8sClient.Delete(ctx, carbonawarekedascaler)).Should(Succeed())
+
+				scaledobject := &kedav1alpha1.ScaledObject{}
+				err = k8sClient.Get(ctx, client.ObjectKey{Name: scaledObjectName, Namespace: scaledObjectNamespace}, scaledobject)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(k8sClient.Delete(ctx, scaledobject)).Should(Succeed())
+
+				deployment := &appsv1.Deployment{}
+				err = k8sClient.Get(ctx, client.ObjectKey{Name: deploymentName, Namespace: deploymentNamespace}, deployment)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(k8sClient.Delete(ctx, deployment)).Should(Succeed())
+			})
+		})
+	})
+
+	Context("the carbonawarekedascaler should be configurable to be disabled based on certain conditions", func() {
+		When("the custom schedule is configured", func() {
+			It("should turn eco mode off", func() {
+				status := &EcoModeStatus{}
+				configs := carbonawarev1alpha1.EcoModeOff{
+					CustomSchedule: []carbonawarev1alpha1.Schedule{
+						{
+							StartTime: time.Now().UTC().Add(time.Duration(1) * time.Hour).Format("2006-01-02T15:00:00Z"),
+							EndTime:   time.Now().UTC().Add(time.Duration(2) * time.Hour).Format("2006-01-02T15:00:00Z"),
+						},
+						{
+							StartTime: time.Now().UTC().Format("2006-01-02T15:00:00Z"),
+							EndTime:   time.Now().UTC().Add(time.Hour).Format("2006-01-02T15:00:00Z"),
+						},
+					},
+				}
+				err := setEcoMode(status, configs, carbonforecast)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(status.IsDisabled).To(BeTrue())
+			})
+		})
+
+		When("the custom schedule is not configured but does not meet time criteria", func() {
+			It("should leave eco mode on", func() {
+				status := &EcoModeStatus{}
+				configs := carbonawarev1alpha1.EcoModeOff{
+					CustomSchedule: []carbonawarev1alpha1.Schedule{
+						{
+							StartTime: time.Now().UTC().Add(time.Duration(-3) * time.Hour).Format("2006-01-02T15:00:00Z"),
+							EndTime:   time.Now().UTC().Add(time.Duration(-2) * time.Hour).Format("2006-01-02T15:00:00Z"),
+						},
+						{
+							StartTime: time.Now().UTC().Add(time.Duration(2) * time.Hour).Format("2006-01-02T15:00:00Z"),
+							EndTime:   time.Now().UTC().Add(time.Duration(3) * time.Hour).Format("2006-01-02T15:00:00Z"),
+						},
+					},
+				}
+				err := setEcoMode(status, configs, carbonforecast)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(status.IsDisabled).To(BeFalse())
+			})
+		})
+
+		When("the recurring schedule is configured", func() {
+			It("should turn eco mode off", func() {
+				status := &EcoModeStatus{}
+				configs := carbonawarev1alpha1.EcoModeOff{
+					RecurringSchedule: []string{
+						fmt.Sprintf("* * %d * *", time.Now().UTC().Day()), // current day
+					},
+				}
+				err := setEcoMode(status, configs, carbonforecast)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(status.IsDisabled).To(BeTrue())
+			})
+		})
+
+		When("the recurring schedule is not configured but does not meet time criteria", func() {
+			It("should leave eco mode on", func() {
+				status := &EcoModeStatus{}
+				configs := carbonawarev1alpha1.EcoModeOff{
+					RecurringSchedule: []string{
+						fmt.Sprintf("%d * * * *", time.Now().UTC().Add(time.Duration(-1)*time.Hour).Minute()), // one minute in the past
+					},
+				}
+				err := setEcoMode(status, configs, carbonforecast)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(status.IsDisabled).To(BeFalse())
+			})
+		})
+
+		When("the carbon intensity over a duration is configured", func() {
+			It("should turn eco mode off", func() {
+				forecast := []CarbonForecast{
+					{
+						Value:     90,
+						Timestamp: time.Now().UTC().Add(time.Duration(-20) * time.Minute),
+						Duration:  5,
+					},
+					{
+						Value:     60,
+						Timestamp: time.Now().UTC().Add(time.Duration(-15) * time.Minute),
+						Duration:  5,
+					},
+					{
+						Value:     70,
+						Timestamp: time.Now().UTC().Add(time.Duration(-10) * time.Minute),
+						Duration:  5,
+					},
+					{
+						Value:     80,
+						Timestamp: time.Now().UTC().Add(time.Duration(-5) * time.Minute),
+						Duration:  5,
+					},
+					{
+						Value:     90,
+						Timestamp: time.Now().UTC(),
+						Duration:  5,
+					},
+				}
+				status := &EcoModeStatus{}
+				configs := carbonawarev1alpha1.EcoModeOff{
+					CarbonIntensityDuration: v1alpha1.CarbonIntensityDuration{
+						CarbonIntensityThreshold:       50,
+						OverrideEcoAfterDurationInMins: 20,
+					},
+				}
+				err := setEcoMode(status, configs, forecast)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(status.IsDisabled).To(BeTrue())
+			})
+		})
+
+		When("the carbon intensity over a duration is configured but doesn't meet time criteria", func() {
+			It("should leave eco mode on", func() {
+				forecast := []CarbonForecast{
+					{
+						Value:     90,
+						Timestamp: time.Now().UTC().Add(time.Duration(-20) * time.Minute),
+						Duration:  5,
+					},
+					{
+						Value:     80,
+						Timestamp: time.Now().UTC().Add(time.Duration(-15) * time.Minute),
+						Duration:  5,
+					},
+					{
+						Value:     80,
+						Timestamp: time.Now().UTC().Add(time.Duration(-10) * time.Minute),
+						Duration:  5,
+					},
+					{
+						Value:     80,
+						Timestamp: time.Now().UTC().Add(time.Duration(-5) * time.Minute),
+						Duration:  5,
+					},
+					{
+						Value:     60,
+						Timestamp: time.Now().UTC(),
+						Duration:  5,
+					},
+				}
+				status := &EcoModeStatus{}
+				configs := carbonawarev1alpha1.EcoModeOff{
+					CarbonIntensityDuration: v1alpha1.CarbonIntensityDuration{
+						CarbonIntensityThreshold:       80,
+						OverrideEcoAfterDurationInMins: 15,
+					},
+				}
+				err := setEcoMode(status, configs, forecast)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(status.IsDisabled).To(BeFalse())
+			})
+		})
+
+		When("the carbon intensity over a duration is configured but doesn't meet threshold criteria", func() {
+			It("should leave eco mode on", func() {
+				data := []CarbonForecast{
+					{
+						Value:     90,
+						Timestamp: time.Now().UTC().Add(time.Duration(-20) * time.Minute),
+						Duration:  5,
+					},
+					{
+						Value:     60,
+						Timestamp: time.Now().UTC().Add(time.Duration(-15) * time.Minute),
+						Duration:  5,
+					},
+					{
+						Value:     70,
+						Timestamp: time.Now().UTC().Add(time.Duration(-10) * time.Minute),
+						Duration:  5,
+					},
+					{
+						Value:     80,
+						Timestamp: time.Now().UTC().Add(time.Duration(-5) * time.Minute),
+						Duration:  5,
+					},
+					{
+						Value:     90,
+						Timestamp: time.Now().UTC(),
+						Duration:  5,
+					},
+				}
+				status := &EcoModeStatus{}
+				configs := carbonawarev1alpha1.EcoModeOff{
+					CarbonIntensityDuration: v1alpha1.CarbonIntensityDuration{
+						CarbonIntensityThreshold:       80,
+						OverrideEcoAfterDurationInMins: 10,
+					},
+				}
+				err := setEcoMode(status, configs, data)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(status.IsDisabled).To(BeFalse())
+			})
+		})
+	})
+
+	Context("max replicas calculation is based on carbon intensity threshold configured", func() {
+		When("the forecast is nil", func() {
+			It("should return an error", func() {
+				var maxReplicaConfig *int32 = new(int32)
+				*maxReplicaConfig = 10
+				maxReplicas, err := getMaxReplicas(nil, []carbonawarev1alpha1.CarbonIntensityConfig{
+					{
+						MaxReplicas:              maxReplicaConfig,
+						CarbonIntensityThreshold: 100,
+					},
+				})
+				Expect(err).To(HaveOccurred())
+				Expect(maxReplicas).To(BeNil())
+			})
+		})
+
+		When("the forecasted carbon intensity is 100 and max replicas is set to 10", func() {
+			var configs []carbonawarev1alpha1.CarbonIntensityConfig
+
+			BeforeEach(func() {
+				configs = []carbonawarev1alpha1.CarbonIntensityConfig{
+					{
+						CarbonIntensityThreshold: 100,
+						MaxReplicas:              new(int32), // 10
+					},
+					{
+						CarbonIntensityThreshold: 90,
+						MaxReplicas:              new(int32), // 20
+					},
+					{
+						CarbonIntensityThreshold: 40,
+						MaxReplicas:              new(int32), // 80
+					},
+				}
+
+				*configs[0].MaxReplicas = 10
+				*configs[1].MaxReplicas = 20
+				*configs[2].MaxReplicas = 80
+			})
+
+			It("should return 10", func() {
+				forecast := make([]CarbonForecast, 1)
+				forecast[0] = CarbonForecast{
+					Timestamp: time.Now().UTC(),
+					Value:     100,
+					Duration:  5,
+				}
+				maxReplicas, err := getMaxReplicas(&forecast[0], configs)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(10)))
+			})
+
+			It("should return 80", func() {
+				forecast := make([]CarbonForecast, 1)
+				forecast[0] = CarbonForecast{
+					Timestamp: time.Now().UTC(),
+					Value:     30,
+					Duration:  5,
+				}
+				maxReplicas, err := getMaxReplicas(&forecast[0], configs)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(80)))
+			})
+
+			It("should return 10", func() {
+				forecast := make([]CarbonForecast, 1)
+				forecast[0] = CarbonForecast{
+					Timestamp: time.Now().UTC(),
+					Value:     101,
+					Duration:  5,
+				}
+				maxReplicas, err := getMaxReplicas(&forecast[0], configs)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(10)))
+			})
+
+			It("should return 10", func() {
+				forecast := make([]CarbonForecast, 1)
+				forecast[0] = CarbonForecast{
+					Timestamp: time.Now().UTC(),
+					Value:     101010,
+					Duration:  5,
+				}
+				maxReplicas, err := getMaxReplicas(&forecast[0], configs)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(10)))
+			})
+
+			It("should return 20", func() {
+				forecast := make([]CarbonForecast, 1)
+				forecast[0] = CarbonForecast{
 					Timestamp: time.Now().UTC(),
-					Value:     float64(99),
+					Value:     67,
 					Duration:  5,
 				}
+				maxReplicas, err := getMaxReplicas(&forecast[0], configs)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(20)))
+			})
+		})
 
-				// marshal the carbon forecast into byte array
-				forecast, err := json.Marshal(cf)
+		When("the interpolation is linear", func() {
+			var configs []carbonawarev1alpha1.CarbonIntensityConfig
+
+			BeforeEach(func() {
+				configs = []carbonawarev1alpha1.CarbonIntensityConfig{
+					{CarbonIntensityThreshold: 633, MaxReplicas: pointer.Int32(60)},
+					{CarbonIntensityThreshold: 566, MaxReplicas: pointer.Int32(110)},
+					{CarbonIntensityThreshold: 700, MaxReplicas: pointer.Int32(10)},
+				}
+			})
+
+			It("should interpolate between the neighboring thresholds", func() {
+				maxReplicas, err := getLinearMaxReplicas(&CarbonForecast{Value: 566}, configs, carbonawarev1alpha1.InterpolationRoundingNearest)
 				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(110)))
 
-				// create a configmap with the carbon forecast
-				configmap := &corev1.ConfigMap{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      testConfigMapName,
-						Namespace: testConfigMapNamespace,
-					},
-					BinaryData: map[string][]byte{
-						testConfigMapKey: forecast,
+				maxReplicas, err = getLinearMaxReplicas(&CarbonForecast{Value: 567}, configs, carbonawarev1alpha1.InterpolationRoundingNearest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(109)))
+
+				maxReplicas, err = getLinearMaxReplicas(&CarbonForecast{Value: 666.5}, configs, carbonawarev1alpha1.InterpolationRoundingNearest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(35)))
+			})
+
+			It("should round with the configured rule", func() {
+				maxReplicas, err := getLinearMaxReplicas(&CarbonForecast{Value: 567}, configs, carbonawarev1alpha1.InterpolationRoundingDown)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(109)))
+
+				maxReplicas, err = getLinearMaxReplicas(&CarbonForecast{Value: 567}, configs, carbonawarev1alpha1.InterpolationRoundingUp)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(110)))
+			})
+
+			It("should use the nearest threshold outside of the thresholds without reordering them", func() {
+				maxReplicas, err := getLinearMaxReplicas(&CarbonForecast{Value: 100}, configs, carbonawarev1alpha1.InterpolationRoundingNearest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(110)))
+
+				maxReplicas, err = getLinearMaxReplicas(&CarbonForecast{Value: 900}, configs, carbonawarev1alpha1.InterpolationRoundingNearest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(10)))
+				Expect(configs[0].CarbonIntensityThreshold).To(Equal(int32(633)))
+			})
+		})
+
+		When("relative thresholds are configured", func() {
+			var (
+				forecast []CarbonForecast
+				relative carbonawarev1alpha1.RelativeThresholds
+				start    time.Time
+			)
+
+			BeforeEach(func() {
+				start = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+				forecast = []CarbonForecast{
+					{Timestamp: start.Add(-time.Hour), Duration: 60, Value: 50},
+					{Timestamp: start, Duration: 60, Value: 400},
+					{Timestamp: start.Add(time.Hour), Duration: 60, Value: 100.2},
+					{Timestamp: start.Add(2 * time.Hour), Duration: 60, Value: 300},
+					{Timestamp: start.Add(3 * time.Hour), Duration: 60, Value: 200},
+					{Timestamp: start.Add(4 * time.Hour), Duration: 60, Value: 900},
+				}
+				relative = carbonawarev1alpha1.RelativeThresholds{
+					WindowInMins: 240,
+					Thresholds: []carbonawarev1alpha1.RelativeThreshold{
+						{Percentile: 25, MaxReplicas: pointer.Int32(110)},
+						{Percentile: 50, MaxReplicas: pointer.Int32(60)},
+						{Percentile: 100, MaxReplicas: pointer.Int32(10)},
 					},
 				}
-				Expect(k8sClient.Create(ctx, configmap)).Should(Succeed())
+			})
 
-				// create a carbonawarekedascaler resource
-				carbonawarekedascaler := &carbonawarev1alpha1.CarbonAwareKedaScaler{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      carbonAwareKedaScalerName,
-						Namespace: carbonAwareKedaScalerNamespace,
-					},
-					Spec: carbonawarev1alpha1.CarbonAwareKedaScalerSpec{
-						CarbonIntensityForecastDataSource: carbonawarev1alpha1.CarbonIntensityForecastDataSource{
-							MockCarbonForecast: false,
-							LocalConfigMap: carbonawarev1alpha1.LocalConfigMap{
-								Name:      testConfigMapName,
-								Namespace: testConfigMapNamespace,
-								Key:       testConfigMapKey,
-							},
-						},
-						KedaTarget: carbonawarev1alpha1.KedaTarget("scaledobjects.keda.sh"),
-						KedaTargetRef: carbonawarev1alpha1.KedaTargetRef{
-							Name:      scaledObjectName,
-							Namespace: scaledObjectNamespace,
-						},
-						MaxReplicasByCarbonIntensity: []carbonawarev1alpha1.CarbonIntensityConfig{
-							{
-								CarbonIntensityThreshold: 100,
-								MaxReplicas:              pointer.Int32(9),
-							},
-						},
-					},
+			It("should compute the thresholds from the percentiles of the forecast in the window", func() {
+				configs, err := getRelativeThresholds(forecast, relative, start)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(configs).To(Equal([]carbonawarev1alpha1.CarbonIntensityConfig{
+					{CarbonIntensityThreshold: 101, MaxReplicas: pointer.Int32(110)},
+					{CarbonIntensityThreshold: 200, MaxReplicas: pointer.Int32(60)},
+					{CarbonIntensityThreshold: 400, MaxReplicas: pointer.Int32(10)},
+				}))
+
+				maxReplicas, err := getMaxReplicas(&CarbonForecast{Value: 100.2}, configs)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(110)))
+			})
+
+			It("should weigh the slots by the time they overlap the window", func() {
+				configs, err := getRelativeThresholds(forecast, relative, start.Add(150*time.Minute))
+				Expect(err).NotTo(HaveOccurred())
+				// 30 minutes of 300, 60 minutes of 200 and 60 minutes of 900 remain in the window
+				Expect(configs[0].CarbonIntensityThreshold).To(Equal(int32(200)))
+				Expect(configs[1].CarbonIntensityThreshold).To(Equal(int32(300)))
+				Expect(configs[2].CarbonIntensityThreshold).To(Equal(int32(900)))
+			})
+
+			It("should break ties between percentiles with the same threshold on the percentile", func() {
+				// the cleanest 25% and 50% of a flat forecast have the same carbon intensity
+				flat := []CarbonForecast{{Timestamp: start, Duration: 240, Value: 300}}
+				relative.Thresholds = []carbonawarev1alpha1.RelativeThreshold{
+					{Percentile: 100, MaxReplicas: pointer.Int32(10)},
+					{Percentile: 50, MaxReplicas: pointer.Int32(60)},
+					{Percentile: 25, MaxReplicas: pointer.Int32(110)},
 				}
-				Expect(k8sClient.Create(ctx, carbonawarekedascaler)).Should(Succeed())
+				for i := 0; i < 10; i++ {
+					configs, err := getRelativeThresholds(flat, relative, start)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(*configs[0].MaxReplicas).To(Equal(int32(110)))
+
+					maxReplicas, err := getMaxReplicas(&CarbonForecast{Value: 300}, configs)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(*maxReplicas).To(Equal(int32(110)))
+				}
+				Expect(relative.Thresholds[0].Percentile).To(Equal(int32(100)))
 			})
 
-			It("should update the scaledobject to the max replicas", func() {
-				scaledobject := &kedav1alpha1.ScaledObject{}
-				err := k8sClient.Get(ctx, client.ObjectKey{Name: scaledObjectName, Namespace: scaledObjectNamespace}, scaledobject)
+			It("should return an error when there is no forecast in the window", func() {
+				_, err := getRelativeThresholds(forecast, relative, start.Add(24*time.Hour))
+				Expect(err).To(HaveOccurred())
+			})
+
+			It("should use the lowest max replicas of the percentiles when the forecast is unavailable", func() {
+				Expect(*getLowestMaxReplicas(relativeThresholdConfigs(relative.Thresholds))).To(Equal(int32(10)))
+			})
+		})
+
+		When("no thresholds are configured", func() {
+			It("should return an error", func() {
+				_, err := getMaxReplicas(&CarbonForecast{Value: 100}, nil)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		When("max replicas are a percentage of a baseline", func() {
+			configs := []carbonawarev1alpha1.CarbonIntensityConfig{
+				{CarbonIntensityThreshold: 200, MaxReplicasPercent: pointer.Int32(100)},
+				{CarbonIntensityThreshold: 400, MaxReplicasPercent: pointer.Int32(55)},
+				{CarbonIntensityThreshold: 600, MaxReplicas: pointer.Int32(3), MaxReplicasPercent: pointer.Int32(10)},
+				{CarbonIntensityThreshold: 800, MaxReplicas: pointer.Int32(2)},
+			}
+
+			It("should compute max replicas from the percentage of the baseline", func() {
+				resolved, err := resolveMaxReplicasPercent(configs, pointer.Int32(15), nil)
 				Expect(err).NotTo(HaveOccurred())
+				Expect(*resolved[0].MaxReplicas).To(Equal(int32(15)))
+				// 8.25 rounds to the nearest replica
+				Expect(*resolved[1].MaxReplicas).To(Equal(int32(8)))
+				// the percentage wins over maxReplicas
+				Expect(*resolved[2].MaxReplicas).To(Equal(int32(2)))
+				Expect(*resolved[3].MaxReplicas).To(Equal(int32(2)))
+				Expect(resolved[0].MaxReplicasPercent).To(BeNil())
 
-				// By("confirming the scaledobject has the correct max replicas")
-				// Expect(scaledobject.Spec.MaxReplicaCount).To(Equal(int32(9)))
+				maxReplicas, err := getMaxReplicas(&CarbonForecast{Value: 300}, resolved)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(8)))
 			})
 
-			AfterEach(func() {
-				configmap := &corev1.ConfigMap{}
-				err := k8sClient.Get(ctx, client.ObjectKey{Name: testConfigMapName, Namespace: testConfigMapNamespace}, configmap)
+			It("should not change the configs", func() {
+				_, err := resolveMaxReplicasPercent(configs, pointer.Int32(15), nil)
 				Expect(err).NotTo(HaveOccurred())
-				Expect(k8sClient.Delete(ctx, configmap)).Should(Succeed())
+				Expect(configs[0].MaxReplicas).To(BeNil())
+				Expect(*configs[0].MaxReplicasPercent).To(Equal(int32(100)))
+			})
 
-				carbonawarekedascaler := &carbonawarev1alpha1.CarbonAwareKedaScaler{}
-				err = k8sClient.Get(ctx, client.ObjectKey{Name: carbonAwareKedaScalerName, Namespace: carbonAwareKedaScalerNamespace}, carbonawarekedascaler)
+			It("should round and clamp max replicas", func() {
+				resolved, err := resolveMaxReplicasPercent(configs, pointer.Int32(15), &carbonawarev1alpha1.PercentOfBaseline{
+					MinReplicas: pointer.Int32(2),
+					MaxReplicas: pointer.Int32(12),
+					Rounding:    carbonawarev1alpha1.InterpolationRoundingUp,
+				})
 				Expect(err).NotTo(HaveOccurred())
-				Expect(k8sClient.Delete(ctx, carbonawarekedascaler)).Should(Succeed())
+				Expect(*resolved[0].MaxReplicas).To(Equal(int32(12)))
+				Expect(*resolved[1].MaxReplicas).To(Equal(int32(9)))
+				Expect(*resolved[2].MaxReplicas).To(Equal(int32(2)))
+			})
 
-				scaledobject := &kedav1alpha1.ScaledObject{}
-				err = k8sClient.Get(ctx, client.ObjectKey{Name: scaledObjectName, Namespace: scaledObjectNamespace}, scaledobject)
+			It("should return an error when there is no baseline", func() {
+				_, err := resolveMaxReplicasPercent(configs, nil, nil)
+				Expect(err).To(HaveOccurred())
+			})
+
+			It("should return an error when a threshold has no max replicas", func() {
+				_, err := resolveMaxReplicasPercent([]carbonawarev1alpha1.CarbonIntensityConfig{{CarbonIntensityThreshold: 200}}, pointer.Int32(15), nil)
+				Expect(err).To(HaveOccurred())
+			})
+
+			It("should record the max replicas of the target before it is first overwritten", func() {
+				scaledObject := &kedav1alpha1.ScaledObject{}
+				recordOriginalMaxReplicas(scaledObject, pointer.Int32(20), pointer.Int32(10), true)
+				recordOriginalMaxReplicas(scaledObject, pointer.Int32(10), pointer.Int32(5), true)
+				Expect(scaledObject.Annotations).To(HaveKeyWithValue(originalMaxReplicasAnnotation, "20"))
+				Expect(scaledObject.Annotations).To(HaveKeyWithValue(appliedMaxReplicasAnnotation, "5"))
+
+				original, err := originalMaxReplicas(scaledObject.Annotations, pointer.Int32(5))
 				Expect(err).NotTo(HaveOccurred())
-				Expect(k8sClient.Delete(ctx, scaledobject)).Should(Succeed())
+				Expect(original).To(Equal(int32(20)))
+			})
 
-				deployment := &appsv1.Deployment{}
-				err = k8sClient.Get(ctx, client.ObjectKey{Name: deploymentName, Namespace: deploymentNamespace}, deployment)
+			It("should record the max replicas of the target again when someone else changes them", func() {
+				scaledObject := &kedav1alpha1.ScaledObject{}
+				recordOriginalMaxReplicas(scaledObject, pointer.Int32(20), pointer.Int32(10), true)
+
+				// the user raises maxReplicaCount after the operator set it to 10
+				original, err := originalMaxReplicas(scaledObject.Annotations, pointer.Int32(40))
 				Expect(err).NotTo(HaveOccurred())
-				Expect(k8sClient.Delete(ctx, deployment)).Should(Succeed())
+				Expect(original).To(Equal(int32(40)))
+
+				recordOriginalMaxReplicas(scaledObject, pointer.Int32(40), pointer.Int32(20), true)
+				Expect(scaledObject.Annotations).To(HaveKeyWithValue(originalMaxReplicasAnnotation, "40"))
+				Expect(scaledObject.Annotations).To(HaveKeyWithValue(appliedMaxReplicasAnnotation, "20"))
+			})
+
+			It("should only annotate the target while its max replicas are used as a baseline", func() {
+				scaledObject := &kedav1alpha1.ScaledObject{}
+				recordOriginalMaxReplicas(scaledObject, pointer.Int32(20), pointer.Int32(10), false)
+				Expect(scaledObject.Annotations).To(BeEmpty())
+
+				recordOriginalMaxReplicas(scaledObject, pointer.Int32(20), pointer.Int32(10), true)
+				recordOriginalMaxReplicas(scaledObject, pointer.Int32(10), pointer.Int32(5), false)
+				Expect(scaledObject.Annotations).NotTo(HaveKey(originalMaxReplicasAnnotation))
+				Expect(scaledObject.Annotations).NotTo(HaveKey(appliedMaxReplicasAnnotation))
+
+				spec := carbonawarev1alpha1.CarbonAwareKedaScalerSpec{MaxReplicasByCarbonIntensity: configs}
+				Expect(usesTargetMaxReplicasBaseline(spec)).To(BeFalse())
+				spec.PercentOfBaseline = &carbonawarev1alpha1.PercentOfBaseline{Baseline: carbonawarev1alpha1.BaselineTargetMaxReplicas}
+				Expect(usesTargetMaxReplicasBaseline(spec)).To(BeTrue())
+				spec.MaxReplicasByCarbonIntensity = configs[3:]
+				Expect(usesTargetMaxReplicasBaseline(spec)).To(BeFalse())
+			})
+
+			It("should use the current max replicas of the target when it is not annotated", func() {
+				original, err := originalMaxReplicas(nil, pointer.Int32(5))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(original).To(Equal(int32(5)))
+
+				original, err = originalMaxReplicas(nil, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(original).To(Equal(int32(kedaDefaultMaxReplicaCount)))
 			})
 		})
-	})
 
-	Context("the carbonawarekedascaler should be configurable to be disabled based on certain conditions", func() {
-		When("the custom schedule is configured", func() {
-			It("should turn eco mode off", func() {
-				status := &EcoModeStatus{}
-				configs := carbonawarev1alpha1.EcoModeOff{
-					CustomSchedule: []carbonawarev1alpha1.Schedule{
-						{
-							StartTime: time.Now().UTC().Add(time.Duration(1) * time.Hour).Format("2006-01-02T15:00:00Z"),
-							EndTime:   time.Now().UTC().Add(time.Duration(2) * time.Hour).Format("2006-01-02T15:00:00Z"),
-						},
-						{
-							StartTime: time.Now().UTC().Format("2006-01-02T15:00:00Z"),
-							EndTime:   time.Now().UTC().Add(time.Hour).Format("2006-01-02T15:00:00Z"),
-						},
-					},
-				}
-				err := setEcoMode(status, configs, carbonforecast)
+		When("hysteresis or a minimum dwell time is configured", func() {
+			now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+			configs := []carbonawarev1alpha1.CarbonIntensityConfig{
+				{CarbonIntensityThreshold: 600, MaxReplicas: pointer.Int32(10)},
+				{CarbonIntensityThreshold: 200, MaxReplicas: pointer.Int32(100)},
+				{CarbonIntensityThreshold: 400, MaxReplicas: pointer.Int32(50)},
+			}
+			band := func(index int32, enteredAt time.Time) *carbonawarev1alpha1.CarbonIntensityBand {
+				return &carbonawarev1alpha1.CarbonIntensityBand{Index: index, EnteredAt: metav1.Time{Time: enteredAt}}
+			}
+
+			It("should enter the band of the carbon intensity when there is no current band", func() {
+				maxReplicas, current, err := getBandedMaxReplicas(&CarbonForecast{Value: 300}, configs, nil, 20, 0, now)
 				Expect(err).NotTo(HaveOccurred())
-				Expect(status.IsDisabled).To(BeTrue())
+				Expect(*maxReplicas).To(Equal(int32(50)))
+				Expect(current.Index).To(Equal(int32(1)))
+				Expect(current.CarbonIntensityThreshold).To(Equal(int32(400)))
+				Expect(current.EnteredAt.Time).To(Equal(now))
+				// the spec is not reordered
+				Expect(configs[0].CarbonIntensityThreshold).To(Equal(int32(600)))
+			})
+
+			It("should stay in the current band until the carbon intensity crosses the hysteresis", func() {
+				enteredAt := now.Add(-time.Hour)
+				maxReplicas, current, err := getBandedMaxReplicas(&CarbonForecast{Value: 410}, configs, band(1, enteredAt), 20, 0, now)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(50)))
+				Expect(current.EnteredAt.Time).To(Equal(enteredAt))
+
+				maxReplicas, _, err = getBandedMaxReplicas(&CarbonForecast{Value: 185}, configs, band(1, enteredAt), 20, 0, now)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(50)))
+
+				maxReplicas, current, err = getBandedMaxReplicas(&CarbonForecast{Value: 421}, configs, band(1, enteredAt), 20, 0, now)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(10)))
+				Expect(current.Index).To(Equal(int32(2)))
+				Expect(current.EnteredAt.Time).To(Equal(now))
+			})
+
+			It("should stay in the current band until the minimum dwell time has passed", func() {
+				maxReplicas, _, err := getBandedMaxReplicas(&CarbonForecast{Value: 900}, configs, band(0, now.Add(-20*time.Minute)), 0, 30*time.Minute, now)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(100)))
+
+				maxReplicas, _, err = getBandedMaxReplicas(&CarbonForecast{Value: 900}, configs, band(0, now.Add(-30*time.Minute)), 0, 30*time.Minute, now)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(10)))
+			})
+
+			It("should ignore a current band that no longer exists", func() {
+				maxReplicas, current, err := getBandedMaxReplicas(&CarbonForecast{Value: 100}, configs, band(5, now), 20, 30*time.Minute, now)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(100)))
+				Expect(current.Index).To(Equal(int32(0)))
 			})
 		})
 
-		When("the custom schedule is not configured but does not meet time criteria", func() {
-			It("should leave eco mode on", func() {
-				status := &EcoModeStatus{}
-				configs := carbonawarev1alpha1.EcoModeOff{
-					CustomSchedule: []carbonawarev1alpha1.Schedule{
-						{
-							StartTime: time.Now().UTC().Add(time.Duration(-3) * time.Hour).Format("2006-01-02T15:00:00Z"),
-							EndTime:   time.Now().UTC().Add(time.Duration(-2) * time.Hour).Format("2006-01-02T15:00:00Z"),
-						},
-						{
-							StartTime: time.Now().UTC().Add(time.Duration(2) * time.Hour).Format("2006-01-02T15:00:00Z"),
-							EndTime:   time.Now().UTC().Add(time.Duration(3) * time.Hour).Format("2006-01-02T15:00:00Z"),
-						},
+		When("a ramp policy is set", func() {
+			now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+			var scaler *carbonawarev1alpha1.CarbonAwareKedaScaler
+
+			BeforeEach(func() {
+				maxStepUp, maxStepDown := intstr.FromInt(20), intstr.FromString("25%")
+				scaler = &carbonawarev1alpha1.CarbonAwareKedaScaler{
+					Spec: carbonawarev1alpha1.CarbonAwareKedaScalerSpec{
+						RampPolicy: &carbonawarev1alpha1.RampPolicy{MaxStepUp: &maxStepUp, MaxStepDown: &maxStepDown, IntervalInMins: 10},
 					},
 				}
-				err := setEcoMode(status, configs, carbonforecast)
+			})
+
+			It("should move toward the target by at most one step", func() {
+				maxReplicas, err := rampMaxReplicaCount(scaler, pointer.Int32(110), pointer.Int32(10), now)
 				Expect(err).NotTo(HaveOccurred())
-				Expect(status.IsDisabled).To(BeFalse())
+				// 25% of 110 replicas rounds up to 28
+				Expect(*maxReplicas).To(Equal(int32(82)))
+				Expect(*scaler.Status.TargetMaxReplicas).To(Equal(int32(10)))
+				Expect(*scaler.Status.AppliedMaxReplicas).To(Equal(int32(82)))
+				Expect(scaler.Status.LastRampStepTime.Time).To(Equal(now))
+
+				requeueAfter, ramping := rampRequeueAfter(scaler, now)
+				Expect(ramping).To(BeTrue())
+				Expect(requeueAfter).To(Equal(10 * time.Minute))
+			})
+
+			It("should not move before the interval has passed", func() {
+				scaler.Status.LastRampStepTime = &metav1.Time{Time: now.Add(-4 * time.Minute)}
+				maxReplicas, err := rampMaxReplicaCount(scaler, pointer.Int32(82), pointer.Int32(10), now)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(82)))
+
+				requeueAfter, ramping := rampRequeueAfter(scaler, now)
+				Expect(ramping).To(BeTrue())
+				Expect(requeueAfter).To(Equal(6 * time.Minute))
+
+				maxReplicas, err = rampMaxReplicaCount(scaler, pointer.Int32(82), pointer.Int32(10), now.Add(6*time.Minute))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(61)))
+			})
+
+			It("should not step past the target", func() {
+				maxReplicas, err := rampMaxReplicaCount(scaler, pointer.Int32(95), pointer.Int32(110), now)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(110)))
+
+				_, ramping := rampRequeueAfter(scaler, now)
+				Expect(ramping).To(BeFalse())
+			})
+
+			It("should move by at least one replica", func() {
+				maxStepUp := intstr.FromString("10%")
+				scaler.Spec.RampPolicy.MaxStepUp = &maxStepUp
+				maxReplicas, err := rampMaxReplicaCount(scaler, pointer.Int32(0), pointer.Int32(10), now)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(1)))
+			})
+
+			It("should ramp from the keda default when the target has no max replicas", func() {
+				maxReplicas, err := rampMaxReplicaCount(scaler, nil, pointer.Int32(10), now)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(75)))
+			})
+
+			It("should set the target without a limit for the direction", func() {
+				scaler.Spec.RampPolicy.MaxStepUp = nil
+				maxReplicas, err := rampMaxReplicaCount(scaler, pointer.Int32(10), pointer.Int32(110), now)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(110)))
+			})
+
+			It("should set the target and return an error for an invalid step", func() {
+				maxStepDown := intstr.FromString("a lot")
+				scaler.Spec.RampPolicy.MaxStepDown = &maxStepDown
+				maxReplicas, err := rampMaxReplicaCount(scaler, pointer.Int32(110), pointer.Int32(10), now)
+				Expect(err).To(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(10)))
+			})
+
+			It("should ramp the max replica count of the keda target over several reconciles", func() {
+				s := runtime.NewScheme()
+				Expect(carbonawarev1alpha1.AddToScheme(s)).Should(Succeed())
+				Expect(kedav1alpha1.AddToScheme(s)).Should(Succeed())
+
+				scaledObject := &kedav1alpha1.ScaledObject{
+					ObjectMeta: metav1.ObjectMeta{Name: "ramp", Namespace: "default"},
+					Spec: kedav1alpha1.ScaledObjectSpec{
+						ScaleTargetRef:  &kedav1alpha1.ScaleTarget{Name: "ramp"},
+						MaxReplicaCount: pointer.Int32(50),
+					},
+				}
+				scaler.ObjectMeta = metav1.ObjectMeta{Name: "ramp", Namespace: "default"}
+				scaler.Spec.KedaTarget = carbonawarev1alpha1.ScaledObject
+				scaler.Spec.KedaTargetRef = carbonawarev1alpha1.KedaTargetRef{Name: "ramp", Namespace: "default"}
+				scaler.Spec.MaxReplicasByCarbonIntensity = []carbonawarev1alpha1.CarbonIntensityConfig{{CarbonIntensityThreshold: 100, MaxReplicas: pointer.Int32(8)}}
+				scaler.Spec.EcoModeOff = carbonawarev1alpha1.EcoModeOff{MaxReplicas: 100}
+
+				r := &CarbonAwareKedaScalerReconciler{
+					Client:   fake.NewClientBuilder().WithScheme(s).WithObjects(scaledObject, scaler).Build(),
+					Scheme:   s,
+					Recorder: record.NewFakeRecorder(100),
+					// the forecast is unavailable so the target is the eco mode off max replicas
+					CarbonForecastFetcher: &CarbonForecastStaticProfileFetcher{},
+				}
+				result, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(scaler)})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(result.RequeueAfter).Should(BeNumerically("<=", 10*time.Minute))
+
+				Expect(r.Get(context.TODO(), client.ObjectKeyFromObject(scaledObject), scaledObject)).Should(Succeed())
+				Expect(*scaledObject.Spec.MaxReplicaCount).Should(Equal(int32(70)))
+				Expect(r.Get(context.TODO(), client.ObjectKeyFromObject(scaler), scaler)).Should(Succeed())
+				Expect(*scaler.Status.TargetMaxReplicas).Should(Equal(int32(100)))
+				Expect(*scaler.Status.AppliedMaxReplicas).Should(Equal(int32(70)))
+
+				// the next step waits for the interval
+				_, err = r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(scaler)})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(r.Get(context.TODO(), client.ObjectKeyFromObject(scaledObject), scaledObject)).Should(Succeed())
+				Expect(*scaledObject.Spec.MaxReplicaCount).Should(Equal(int32(70)))
+			})
+		})
+
+		When("a reconcile only updates the status", func() {
+			It("will not trigger another reconcile", func() {
+				s := runtime.NewScheme()
+				Expect(carbonawarev1alpha1.AddToScheme(s)).Should(Succeed())
+				Expect(kedav1alpha1.AddToScheme(s)).Should(Succeed())
+
+				scaledObject := &kedav1alpha1.ScaledObject{
+					ObjectMeta: metav1.ObjectMeta{Name: "steady", Namespace: "default"},
+					Spec:       kedav1alpha1.ScaledObjectSpec{ScaleTargetRef: &kedav1alpha1.ScaleTarget{Name: "steady"}, MaxReplicaCount: pointer.Int32(10)},
+				}
+				scaler := &carbonawarev1alpha1.CarbonAwareKedaScaler{
+					ObjectMeta: metav1.ObjectMeta{Name: "steady", Namespace: "default", Generation: 1},
+					Spec: carbonawarev1alpha1.CarbonAwareKedaScalerSpec{
+						KedaTarget:    carbonawarev1alpha1.ScaledObject,
+						KedaTargetRef: carbonawarev1alpha1.KedaTargetRef{Name: "steady", Namespace: "default"},
+						EcoModeOff:    carbonawarev1alpha1.EcoModeOff{MaxReplicas: 10},
+						CarbonBudget:  &carbonawarev1alpha1.CarbonBudget{Budget: resource.MustParse("1000"), WattsPerReplica: resource.MustParse("100")},
+					},
+				}
+				r := &CarbonAwareKedaScalerReconciler{
+					Client:                fake.NewClientBuilder().WithScheme(s).WithObjects(scaledObject, scaler).Build(),
+					Scheme:                s,
+					Recorder:              record.NewFakeRecorder(100),
+					CarbonForecastFetcher: &CarbonForecastStaticProfileFetcher{},
+				}
+
+				_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(scaler)})
+				Expect(err).ShouldNot(HaveOccurred())
+				before := &carbonawarev1alpha1.CarbonAwareKedaScaler{}
+				Expect(r.Get(context.TODO(), client.ObjectKeyFromObject(scaler), before)).Should(Succeed())
+
+				_, err = r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(scaler)})
+				Expect(err).ShouldNot(HaveOccurred())
+				after := &carbonawarev1alpha1.CarbonAwareKedaScaler{}
+				Expect(r.Get(context.TODO(), client.ObjectKeyFromObject(scaler), after)).Should(Succeed())
+
+				// the status with the accrued carbon budget is written on every reconcile but the spec and its generation do not change
+				Expect(after.Status.CarbonBudget).ShouldNot(BeNil())
+				Expect(after.ResourceVersion).ShouldNot(Equal(before.ResourceVersion))
+				Expect(after.Spec).Should(Equal(before.Spec))
+				Expect(carbonAwareKedaScalerPredicate.Update(event.UpdateEvent{ObjectOld: before, ObjectNew: after})).Should(BeFalse())
+
+				By("confirming changes to the spec, labels or annotations are reconciled")
+				changed := after.DeepCopy()
+				changed.Generation++
+				Expect(carbonAwareKedaScalerPredicate.Update(event.UpdateEvent{ObjectOld: before, ObjectNew: changed})).Should(BeTrue())
+
+				changed = after.DeepCopy()
+				changed.Labels = map[string]string{"team": "batch"}
+				Expect(carbonAwareKedaScalerPredicate.Update(event.UpdateEvent{ObjectOld: before, ObjectNew: changed})).Should(BeTrue())
+
+				changed = after.DeepCopy()
+				changed.Annotations = map[string]string{"example.com/owner": "batch"}
+				Expect(carbonAwareKedaScalerPredicate.Update(event.UpdateEvent{ObjectOld: before, ObjectNew: changed})).Should(BeTrue())
 			})
 		})
 
-		When("the recurring schedule is configured", func() {
-			It("should turn eco mode off", func() {
-				status := &EcoModeStatus{}
-				configs := carbonawarev1alpha1.EcoModeOff{
-					RecurringSchedule: []string{
-						fmt.Sprintf("* * %d * *", time.Now().UTC().Day()), // current day
-					},
-				}
-				err := setEcoMode(status, configs, carbonforecast)
+		When("look ahead is set", func() {
+			start := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+			configs := []carbonawarev1alpha1.CarbonIntensityConfig{
+				{CarbonIntensityThreshold: 200, MaxReplicas: pointer.Int32(100)},
+				{CarbonIntensityThreshold: 400, MaxReplicas: pointer.Int32(50)},
+				{CarbonIntensityThreshold: 600, MaxReplicas: pointer.Int32(10)},
+			}
+			forecast := []CarbonForecast{
+				{Timestamp: start, Duration: 30, Value: 300},
+				{Timestamp: start.Add(30 * time.Minute), Duration: 30, Value: 500},
+				{Timestamp: start.Add(60 * time.Minute), Duration: 30, Value: 100},
+				{Timestamp: start.Add(90 * time.Minute), Duration: 30, Value: 300},
+			}
+			maxReplicasFor := func(cf *CarbonForecast) (*int32, error) {
+				return getMaxReplicas(cf, configs)
+			}
+
+			It("should keep the current max replicas when no slot is within a lead time", func() {
+				lookAhead := carbonawarev1alpha1.LookAhead{ScaleUpLeadTimeInMins: 20, ScaleDownLeadTimeInMins: 20}
+				maxReplicas, slot, err := getLookAheadMaxReplicas(forecast, start, pointer.Int32(50), lookAhead, maxReplicasFor)
 				Expect(err).NotTo(HaveOccurred())
-				Expect(status.IsDisabled).To(BeTrue())
+				Expect(*maxReplicas).To(Equal(int32(50)))
+				Expect(slot).To(BeNil())
 			})
-		})
 
-		When("the recurring schedule is not configured but does not meet time criteria", func() {
-			It("should leave eco mode on", func() {
-				status := &EcoModeStatus{}
-				configs := carbonawarev1alpha1.EcoModeOff{
-					RecurringSchedule: []string{
-						fmt.Sprintf("%d * * * *", time.Now().UTC().Add(time.Duration(-1)*time.Hour).Minute()), // one minute in the past
-					},
-				}
-				err := setEcoMode(status, configs, carbonforecast)
+			It("should lower max replicas ahead of a dirtier slot", func() {
+				lookAhead := carbonawarev1alpha1.LookAhead{ScaleDownLeadTimeInMins: 30}
+				maxReplicas, slot, err := getLookAheadMaxReplicas(forecast, start, pointer.Int32(50), lookAhead, maxReplicasFor)
 				Expect(err).NotTo(HaveOccurred())
-				Expect(status.IsDisabled).To(BeFalse())
+				Expect(*maxReplicas).To(Equal(int32(10)))
+				Expect(slot.Timestamp).To(Equal(start.Add(30 * time.Minute)))
+			})
+
+			It("should raise max replicas ahead of a greener slot even when a dirtier slot comes first", func() {
+				lookAhead := carbonawarev1alpha1.LookAhead{ScaleUpLeadTimeInMins: 60, ScaleDownLeadTimeInMins: 60}
+				maxReplicas, slot, err := getLookAheadMaxReplicas(forecast, start, pointer.Int32(50), lookAhead, maxReplicasFor)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*maxReplicas).To(Equal(int32(100)))
+				Expect(slot.Timestamp).To(Equal(start.Add(60 * time.Minute)))
+			})
+
+			It("should requeue when the next slot comes within a lead time", func() {
+				lookAhead := carbonawarev1alpha1.LookAhead{ScaleUpLeadTimeInMins: 20, ScaleDownLeadTimeInMins: 5}
+				requeueAfter, ok := lookAheadRequeueAfter(forecast, start, lookAhead)
+				Expect(ok).To(BeTrue())
+				Expect(requeueAfter).To(Equal(10 * time.Minute))
+
+				_, ok = lookAheadRequeueAfter(forecast, start.Add(90*time.Minute), lookAhead)
+				Expect(ok).To(BeFalse())
 			})
 		})
 
-		When("the carbon intensity over a duration is configured", func() {
-			It("should turn eco mode off", func() {
-				forecast := []CarbonForecast{
-					{
-						Value:     90,
-						Timestamp: time.Now().UTC().Add(time.Duration(-20) * time.Minute),
-						Duration:  5,
-					},
-					{
-						Value:     60,
-						Timestamp: time.Now().UTC().Add(time.Duration(-15) * time.Minute),
-						Duration:  5,
-					},
-					{
-						Value:     70,
-						Timestamp: time.Now().UTC().Add(time.Duration(-10) * time.Minute),
-						Duration:  5,
-					},
-					{
-						Value:     80,
-						Timestamp: time.Now().UTC().Add(time.Duration(-5) * time.Minute),
-						Duration:  5,
-					},
-					{
-						Value:     90,
-						Timestamp: time.Now().UTC(),
-						Duration:  5,
-					},
+		When("a carbon budget is set", func() {
+			// monday evening
+			now := time.Date(2023, 5, 1, 22, 0, 0, 0, time.UTC)
+			budget := carbonawarev1alpha1.CarbonBudget{
+				Budget:          resource.MustParse("1k"),
+				Period:          carbonawarev1alpha1.CarbonBudgetPeriodDay,
+				WattsPerReplica: resource.MustParse("100"),
+			}
+
+			It("should start periods at midnight utc and weeks on monday", func() {
+				start, end := carbonBudgetPeriod(carbonawarev1alpha1.CarbonBudgetPeriodDay, now)
+				Expect(start).To(Equal(time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)))
+				Expect(end).To(Equal(time.Date(2023, 5, 2, 0, 0, 0, 0, time.UTC)))
+
+				start, end = carbonBudgetPeriod(carbonawarev1alpha1.CarbonBudgetPeriodWeek, time.Date(2023, 5, 7, 23, 0, 0, 0, time.UTC))
+				Expect(start).To(Equal(time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)))
+				Expect(end).To(Equal(time.Date(2023, 5, 8, 0, 0, 0, 0, time.UTC)))
+			})
+
+			It("should add the emissions of the last observation until now", func() {
+				previous := &carbonawarev1alpha1.CarbonBudgetStatus{
+					PeriodStart:             metav1.Time{Time: time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)},
+					Used:                    resource.MustParse("100"),
+					ObservedTime:            metav1.Time{Time: now.Add(-30 * time.Minute)},
+					ObservedReplicas:        4,
+					ObservedCarbonIntensity: 300,
 				}
-				status := &EcoModeStatus{}
-				configs := carbonawarev1alpha1.EcoModeOff{
-					CarbonIntensityDuration: v1alpha1.CarbonIntensityDuration{
-						CarbonIntensityThreshold:       50,
-						OverrideEcoAfterDurationInMins: 20,
-					},
+				status := accrueCarbonBudget(previous, budget, now, 6, 400)
+				// 4 replicas of 0.1 kW for half an hour at 300 gCO2eq/kWh
+				Expect(status.Used.Value()).To(Equal(int64(160)))
+				// 6 replicas of 0.1 kW for the 2 hours left at 400 gCO2eq/kWh
+				Expect(status.Projected.Value()).To(Equal(int64(640)))
+				Expect(status.ObservedReplicas).To(Equal(int32(6)))
+				Expect(status.ObservedCarbonIntensity).To(Equal(int32(400)))
+			})
+
+			It("should start over when a new period starts", func() {
+				previous := &carbonawarev1alpha1.CarbonBudgetStatus{
+					PeriodStart:             metav1.Time{Time: time.Date(2023, 4, 30, 0, 0, 0, 0, time.UTC)},
+					Used:                    resource.MustParse("900"),
+					ObservedTime:            metav1.Time{Time: time.Date(2023, 4, 30, 23, 30, 0, 0, time.UTC)},
+					ObservedReplicas:        4,
+					ObservedCarbonIntensity: 300,
 				}
-				err := setEcoMode(status, configs, forecast)
-				Expect(err).NotTo(HaveOccurred())
-				Expect(status.IsDisabled).To(BeTrue())
+				status := accrueCarbonBudget(previous, budget, time.Date(2023, 5, 1, 0, 30, 0, 0, time.UTC), 4, 300)
+				Expect(status.PeriodStart.Time).To(Equal(time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)))
+				Expect(status.Used.Value()).To(Equal(int64(60)))
 			})
-		})
 
-		When("the carbon intensity over a duration is configured but doesn't meet time criteria", func() {
-			It("should leave eco mode on", func() {
+			It("should spend the rest of the budget in the greenest slots first", func() {
 				forecast := []CarbonForecast{
-					{
-						Value:     90,
-						Timestamp: time.Now().UTC().Add(time.Duration(-20) * time.Minute),
-						Duration:  5,
-					},
-					{
-						Value:     80,
-						Timestamp: time.Now().UTC().Add(time.Duration(-15) * time.Minute),
-						Duration:  5,
-					},
-					{
-						Value:     80,
-						Timestamp: time.Now().UTC().Add(time.Duration(-10) * time.Minute),
-						Duration:  5,
-					},
-					{
-						Value:     80,
-						Timestamp: time.Now().UTC().Add(time.Duration(-5) * time.Minute),
-						Duration:  5,
-					},
-					{
-						Value:     60,
-						Timestamp: time.Now().UTC(),
-						Duration:  5,
-					},
+					{Timestamp: now, Duration: 60, Value: 400},
+					{Timestamp: now.Add(time.Hour), Duration: 60, Value: 100},
+					{Timestamp: now.Add(2 * time.Hour), Duration: 60, Value: 50},
 				}
-				status := &EcoModeStatus{}
-				configs := carbonawarev1alpha1.EcoModeOff{
-					CarbonIntensityDuration: v1alpha1.CarbonIntensityDuration{
-						CarbonIntensityThreshold:       80,
-						OverrideEcoAfterDurationInMins: 15,
-					},
+				status := &carbonawarev1alpha1.CarbonBudgetStatus{Used: resource.MustParse("700"), ObservedReplicas: 8}
+				maxReplicasFor := func(cf *CarbonForecast) (*int32, error) {
+					return pointer.Int32(10), nil
 				}
-				err := setEcoMode(status, configs, forecast)
+
+				maxReplicas, projected, err := planCarbonBudget(forecast, now, status, budget, maxReplicasFor)
 				Expect(err).NotTo(HaveOccurred())
-				Expect(status.IsDisabled).To(BeFalse())
+				// 100 of the 300 left go to 10 replicas in the greener slot, the slot after midnight is in the next period
+				Expect(maxReplicas).To(Equal(int32(5)))
+				Expect(projected).To(BeNumerically("~", 1100))
+
+				status.Used = resource.MustParse("1k")
+				maxReplicas, _, err = planCarbonBudget(forecast, now, status, budget, maxReplicasFor)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(maxReplicas).To(Equal(int32(0)))
 			})
-		})
 
-		When("the carbon intensity over a duration is configured but doesn't meet threshold criteria", func() {
-			It("should leave eco mode on", func() {
-				data := []CarbonForecast{
-					{
-						Value:     90,
-						Timestamp: time.Now().UTC().Add(time.Duration(-20) * time.Minute),
-						Duration:  5,
-					},
-					{
-						Value:     60,
-						Timestamp: time.Now().UTC().Add(time.Duration(-15) * time.Minute),
-						Duration:  5,
-					},
-					{
-						Value:     70,
-						Timestamp: time.Now().UTC().Add(time.Duration(-10) * time.Minute),
-						Duration:  5,
-					},
-					{
-						Value:     80,
-						Timestamp: time.Now().UTC().Add(time.Duration(-5) * time.Minute),
-						Duration:  5,
-					},
-					{
-						Value:     90,
-						Timestamp: time.Now().UTC(),
-						Duration:  5,
-					},
+			It("should count the active jobs of a scaledjob as its replicas", func() {
+				s := runtime.NewScheme()
+				Expect(carbonawarev1alpha1.AddToScheme(s)).Should(Succeed())
+				Expect(batchv1.AddToScheme(s)).Should(Succeed())
+
+				job := func(name string, scaledJob string, active int32) *batchv1.Job {
+					return &batchv1.Job{
+						ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{scaledJobNameLabel: scaledJob}},
+						Status:     batchv1.JobStatus{Active: active},
+					}
 				}
-				status := &EcoModeStatus{}
-				configs := carbonawarev1alpha1.EcoModeOff{
-					CarbonIntensityDuration: v1alpha1.CarbonIntensityDuration{
-						CarbonIntensityThreshold:       80,
-						OverrideEcoAfterDurationInMins: 10,
+				r := &CarbonAwareKedaScalerReconciler{
+					Client: fake.NewClientBuilder().WithScheme(s).WithObjects(job("a", "budget", 1), job("b", "budget", 2), job("c", "other", 4)).Build(),
+					Scheme: s,
+				}
+				scaler := &carbonawarev1alpha1.CarbonAwareKedaScaler{
+					Spec: carbonawarev1alpha1.CarbonAwareKedaScalerSpec{
+						KedaTarget:    carbonawarev1alpha1.ScaledJob,
+						KedaTargetRef: carbonawarev1alpha1.KedaTargetRef{Name: "budget", Namespace: "default"},
 					},
 				}
-				err := setEcoMode(status, configs, data)
+				replicas, err := r.observedReplicas(context.TODO(), scaler)
 				Expect(err).NotTo(HaveOccurred())
-				Expect(status.IsDisabled).To(BeFalse())
+				Expect(replicas).To(Equal(int32(3)))
 			})
 		})
-	})
 
-	Context("max replicas calculation is based on carbon intensity threshold configured", func() {
-		When("the forecast is nil", func() {
-			It("should return an error", func() {
-				var maxReplicaConfig *int32 = new(int32)
-				*maxReplicaConfig = 10
-				maxReplicas, err := getMaxReplicas(nil, []carbonawarev1alpha1.CarbonIntensityConfig{
-					{
-						MaxReplicas:              maxReplicaConfig,
-						CarbonIntensityThreshold: 100,
-					},
-				})
+		When("jobs are time shifted", func() {
+			now := time.Date(2023, 5, 1, 20, 0, 0, 0, time.UTC)
+			forecast := []CarbonForecast{
+				{Timestamp: now, Duration: 60, Value: 400},
+				{Timestamp: now.Add(time.Hour), Duration: 60, Value: 300},
+				{Timestamp: now.Add(2 * time.Hour), Duration: 60, Value: 100},
+				{Timestamp: now.Add(3 * time.Hour), Duration: 60, Value: 200},
+				{Timestamp: now.Add(4 * time.Hour), Duration: 60, Value: 50},
+			}
+			timeShift := carbonawarev1alpha1.TimeShift{JobDurationInMins: 120, Deadline: "00:30"}
+
+			It("should parse rfc 3339 and time of day deadlines", func() {
+				deadline, err := parseTimeShiftDeadline("2023-05-02T06:00:00+02:00", now)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(deadline).To(Equal(time.Date(2023, 5, 2, 4, 0, 0, 0, time.UTC)))
+
+				deadline, err = parseTimeShiftDeadline("21:00", now)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(deadline).To(Equal(time.Date(2023, 5, 1, 21, 0, 0, 0, time.UTC)))
+
+				// the next occurrence of a time of day that has passed is tomorrow
+				deadline, err = parseTimeShiftDeadline("06:00", now)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(deadline).To(Equal(time.Date(2023, 5, 2, 6, 0, 0, 0, time.UTC)))
+
+				_, err = parseTimeShiftDeadline("tomorrow", now)
 				Expect(err).To(HaveOccurred())
-				Expect(maxReplicas).To(BeNil())
 			})
-		})
 
-		When("the forecasted carbon intensity is 100 and max replicas is set to 10", func() {
-			var configs []carbonawarev1alpha1.CarbonIntensityConfig
+			It("should pick the greenest window that completes before the deadline", func() {
+				window := getTimeShiftWindow(forecast, now, time.Date(2023, 5, 2, 0, 30, 0, 0, time.UTC), 2*time.Hour)
+				Expect(window).NotTo(BeNil())
+				Expect(window.Start.Time).To(Equal(now.Add(2 * time.Hour)))
+				Expect(window.End.Time).To(Equal(now.Add(4 * time.Hour)))
+				Expect(window.CarbonIntensity).To(Equal(int32(150)))
+			})
 
-			BeforeEach(func() {
-				configs = []carbonawarev1alpha1.CarbonIntensityConfig{
-					{
-						CarbonIntensityThreshold: 100,
-						MaxReplicas:              new(int32), // 10
-					},
-					{
-						CarbonIntensityThreshold: 90,
-						MaxReplicas:              new(int32), // 20
-					},
-					{
-						CarbonIntensityThreshold: 40,
-						MaxReplicas:              new(int32), // 80
-					},
-				}
+			It("should leave out windows the forecast does not cover", func() {
+				// the greenest slot is the last one so a window starting in it would end after the forecast
+				window := getTimeShiftWindow(forecast, now, now.Add(24*time.Hour), 2*time.Hour)
+				Expect(window.Start.Time).To(Equal(now.Add(3 * time.Hour)))
+				Expect(window.CarbonIntensity).To(Equal(int32(125)))
 
-				*configs[0].MaxReplicas = 10
-				*configs[1].MaxReplicas = 20
-				*configs[2].MaxReplicas = 80
+				Expect(getTimeShiftWindow(forecast, now, now.Add(time.Hour), 2*time.Hour)).To(BeNil())
 			})
 
-			It("should return 10", func() {
-				forecast := make([]CarbonForecast, 1)
-				forecast[0] = CarbonForecast{
-					Timestamp: time.Now().UTC(),
-					Value:     100,
-					Duration:  5,
-				}
-				maxReplicas, err := getMaxReplicas(&forecast[0], configs)
+			It("should hold the jobs until the window opens", func() {
+				maxReplicas, window, err := getTimeShiftMaxReplicas(forecast, now, nil, timeShift, 20)
 				Expect(err).NotTo(HaveOccurred())
-				Expect(*maxReplicas).To(Equal(int32(10)))
-			})
+				Expect(*maxReplicas).To(Equal(int32(0)))
+				Expect(window.Start.Time).To(Equal(now.Add(2 * time.Hour)))
 
-			It("should return 80", func() {
-				forecast := make([]CarbonForecast, 1)
-				forecast[0] = CarbonForecast{
-					Timestamp: time.Now().UTC(),
-					Value:     30,
-					Duration:  5,
-				}
-				maxReplicas, err := getMaxReplicas(&forecast[0], configs)
+				maxReplicas, _, err = getTimeShiftMaxReplicas(forecast, now.Add(2*time.Hour), window, timeShift, 20)
 				Expect(err).NotTo(HaveOccurred())
-				Expect(*maxReplicas).To(Equal(int32(80)))
+				Expect(*maxReplicas).To(Equal(int32(20)))
 			})
 
-			It("should return 10", func() {
-				forecast := make([]CarbonForecast, 1)
-				forecast[0] = CarbonForecast{
-					Timestamp: time.Now().UTC(),
-					Value:     101,
-					Duration:  5,
+			It("should keep an open window", func() {
+				window := &carbonawarev1alpha1.TimeShiftWindow{
+					Start:    metav1.Time{Time: now.Add(-30 * time.Minute)},
+					End:      metav1.Time{Time: now.Add(90 * time.Minute)},
+					Deadline: metav1.Time{Time: time.Date(2023, 5, 2, 0, 30, 0, 0, time.UTC)},
 				}
-				maxReplicas, err := getMaxReplicas(&forecast[0], configs)
+				maxReplicas, kept, err := getTimeShiftMaxReplicas(forecast, now, window, timeShift, 20)
 				Expect(err).NotTo(HaveOccurred())
-				Expect(*maxReplicas).To(Equal(int32(10)))
+				Expect(*maxReplicas).To(Equal(int32(20)))
+				Expect(kept).To(Equal(window))
 			})
 
-			It("should return 10", func() {
-				forecast := make([]CarbonForecast, 1)
-				forecast[0] = CarbonForecast{
-					Timestamp: time.Now().UTC(),
-					Value:     101010,
-					Duration:  5,
+			It("should keep a completed window and run the jobs until the deadline", func() {
+				window := &carbonawarev1alpha1.TimeShiftWindow{
+					Start:    metav1.Time{Time: now},
+					End:      metav1.Time{Time: now.Add(time.Hour)},
+					Deadline: metav1.Time{Time: time.Date(2023, 5, 2, 0, 30, 0, 0, time.UTC)},
 				}
-				maxReplicas, err := getMaxReplicas(&forecast[0], configs)
+				// a new window from 22:00 to 23:00 would still fit before the deadline
+				maxReplicas, kept, err := getTimeShiftMaxReplicas(forecast, now.Add(time.Hour), window, carbonawarev1alpha1.TimeShift{JobDurationInMins: 60, Deadline: "00:30"}, 20)
 				Expect(err).NotTo(HaveOccurred())
-				Expect(*maxReplicas).To(Equal(int32(10)))
+				Expect(*maxReplicas).To(Equal(int32(20)))
+				Expect(kept).To(Equal(window))
+
+				By("confirming the window is dropped once the deadline passes")
+				// the forecast does not cover a window before the next deadline so the jobs run right away
+				maxReplicas, next, err := getTimeShiftMaxReplicas(forecast, now.Add(4*time.Hour+45*time.Minute), window, carbonawarev1alpha1.TimeShift{JobDurationInMins: 60, Deadline: "00:30"}, 20)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(next).To(BeNil())
+				Expect(*maxReplicas).To(Equal(int32(20)))
 			})
 
-			It("should return 20", func() {
-				forecast := make([]CarbonForecast, 1)
-				forecast[0] = CarbonForecast{
-					Timestamp: time.Now().UTC(),
-					Value:     67,
-					Duration:  5,
-				}
-				maxReplicas, err := getMaxReplicas(&forecast[0], configs)
+			It("should run the jobs now when no window completes before the deadline", func() {
+				maxReplicas, window, err := getTimeShiftMaxReplicas(forecast, now, nil, carbonawarev1alpha1.TimeShift{JobDurationInMins: 120, Deadline: "21:00"}, 20)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(*maxReplicas).To(Equal(int32(20)))
+				Expect(window).To(BeNil())
 			})
 		})
 	})
 })
+
+// fakeConfigMapCache serves reads from a client once it is started
+type fakeConfigMapCache struct {
+	cache.Cache
+	reader client.Reader
+}
+
+func (c *fakeConfigMapCache) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	return c.reader.Get(ctx, key, obj, opts...)
+}
+
+func (c *fakeConfigMapCache) GetInformer(ctx context.Context, obj client.Object) (cache.Informer, error) {
+	return nil, nil
+}
+
+func (c *fakeConfigMapCache) WaitForCacheSync(ctx context.Context) bool {
+	return true
+}
+
+func (c *fakeConfigMapCache) Start(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
@@ -0,0 +1,165 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/duration"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	carbonawarev1alpha1 "github.com/azure/carbon-aware-keda-operator/api/v1alpha1"
+)
+
+// maximum time between status updates so the horizon stays current during long slots
+const carbonIntensityForecastStatusInterval = 15 * time.Minute
+
+// CarbonIntensityForecastReconciler reconciles the status of a CarbonIntensityForecast object
+type CarbonIntensityForecastReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=carbonaware.kubernetes.azure.com,resources=carbonintensityforecasts,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=carbonaware.kubernetes.azure.com,resources=carbonintensityforecasts/status,verbs=get;update;patch
+
+// Reconcile updates the current intensity and horizon of the carbonintensityforecast and requeues at the next slot boundary
+func (r *CarbonIntensityForecastReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	forecast := &carbonawarev1alpha1.CarbonIntensityForecast{}
+	if err := r.Get(ctx, req.NamespacedName, forecast); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	now := time.Now().UTC()
+	status, requeueAfter := carbonIntensityForecastStatus(forecast, now)
+	if !equality.Semantic.DeepEqual(status, forecast.Status) {
+		forecast.Status = status
+		if err := r.Status().Update(ctx, forecast); err != nil {
+			if errors.IsConflict(err) {
+				return ctrl.Result{Requeue: true}, nil
+			}
+			logger.Error(err, "unable to update carbonintensityforecast status")
+			return ctrl.Result{}, err
+		}
+	}
+
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// carbonIntensityForecastStatus returns the status of the carbonintensityforecast at the time and how long until it changes
+func carbonIntensityForecastStatus(forecast *carbonawarev1alpha1.CarbonIntensityForecast, now time.Time) (carbonawarev1alpha1.CarbonIntensityForecastStatus, time.Duration) {
+	status := carbonawarev1alpha1.CarbonIntensityForecastStatus{ObservedGeneration: forecast.Generation}
+	requeueAfter := carbonIntensityForecastStatusInterval
+
+	var end time.Time
+	for _, slot := range forecast.Spec.Slots {
+		start := slot.Timestamp.UTC()
+		slotEnd := start.Add(time.Duration(slot.DurationInMins) * time.Minute)
+		if slotEnd.After(end) {
+			end = slotEnd
+		}
+		if !now.Before(start) && now.Before(slotEnd) && status.CurrentIntensity == nil {
+			value := slot.Value.DeepCopy()
+			status.CurrentIntensity = &value
+		}
+
+		// requeue at the next slot boundary so the current intensity changes with the slot
+		for _, boundary := range []time.Time{start, slotEnd} {
+			if boundary.After(now) && boundary.Sub(now) < requeueAfter {
+				requeueAfter = boundary.Sub(now)
+			}
+		}
+	}
+
+	if end.IsZero() {
+		return status, 0
+	}
+	status.ForecastEnd = &metav1.Time{Time: end}
+	if end.After(now) {
+		status.Horizon = duration.HumanDuration(end.Sub(now))
+	} else {
+		// nothing changes once the forecast has expired
+		status.Horizon = "0s"
+		requeueAfter = 0
+	}
+	return status, requeueAfter
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CarbonIntensityForecastReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&carbonawarev1alpha1.CarbonIntensityForecast{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
+
+// CarbonForecastResourceFetcher is an implementation of CarbonForecastFetcher that fetches the carbon forecast from a carbonintensityforecast
+type CarbonForecastResourceFetcher struct {
+	Client    client.Reader
+	Name      string
+	Namespace string
+	// MaxDataAge rejects forecasts generated longer ago than this when set
+	MaxDataAge time.Duration
+
+	metadata *carbonawarev1alpha1.ForecastMetadata
+}
+
+func (c *CarbonForecastResourceFetcher) Fetch(ctx context.Context) ([]CarbonForecast, error) {
+	c.metadata = nil
+
+	forecast := &carbonawarev1alpha1.CarbonIntensityForecast{}
+	err := c.Client.Get(ctx, types.NamespacedName{Name: c.Name, Namespace: c.Namespace}, forecast)
+	if err != nil {
+		return nil, err
+	}
+
+	numOfRecords := int32(len(forecast.Spec.Slots))
+	c.metadata = &carbonawarev1alpha1.ForecastMetadata{
+		ForecastDateTime: forecast.Spec.GeneratedAt,
+		NumOfRecords:     &numOfRecords,
+	}
+
+	if c.MaxDataAge > 0 {
+		source := fmt.Sprintf("carbonintensityforecast %s/%s", c.Namespace, c.Name)
+		if forecast.Spec.GeneratedAt == nil {
+			return nil, &StaleForecastError{Source: source, Reason: "generatedAt is missing"}
+		}
+		if age := time.Now().UTC().Sub(forecast.Spec.GeneratedAt.Time); age > c.MaxDataAge {
+			return nil, &StaleForecastError{Source: source, Reason: fmt.Sprintf("data is %s old which is older than %s", age.Round(time.Second), c.MaxDataAge)}
+		}
+	}
+
+	return carbonForecastFromResource(forecast), nil
+}
+
+// carbonForecastFromResource returns the slots of a carbonintensityforecast as carbon forecasts for its location
+func carbonForecastFromResource(forecast *carbonawarev1alpha1.CarbonIntensityForecast) []CarbonForecast {
+	cf := make([]CarbonForecast, 0, len(forecast.Spec.Slots))
+	for _, slot := range forecast.Spec.Slots {
+		cf = append(cf, CarbonForecast{
+			Location:  forecast.Spec.Location,
+			Timestamp: slot.Timestamp.UTC(),
+			Duration:  slot.DurationInMins,
+			Value:     slot.Value.AsApproximateFloat64(),
+		})
+	}
+	return cf
+}
+
+// Metadata returns the generation time and number of slots of the last fetched carbonintensityforecast
+func (c *CarbonForecastResourceFetcher) Metadata() *carbonawarev1alpha1.ForecastMetadata {
+	return c.metadata
+}
@@ -0,0 +1,101 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	carbonawarev1alpha1 "github.com/azure/carbon-aware-keda-operator/api/v1alpha1"
+)
+
+// electricityMapsIntensity is a single carbon intensity value returned by the electricity maps api
+type electricityMapsIntensity struct {
+	CarbonIntensity float64   `json:"carbonIntensity"`
+	Datetime        time.Time `json:"datetime"`
+}
+
+// CarbonForecastElectricityMapsFetcher is an implementation of CarbonForecastFetcher that fetches the carbon forecast from the electricity maps api
+type CarbonForecastElectricityMapsFetcher struct {
+	Client client.Reader
+	// Namespace is the namespace of the carbonawarekedascaler that secrets are read from
+	Namespace          string
+	HTTPClient         *http.Client
+	URL                string
+	Zone               string
+	AuthTokenSecretRef carbonawarev1alpha1.SecretKeyRef
+}
+
+func (c *CarbonForecastElectricityMapsFetcher) Fetch(ctx context.Context) ([]CarbonForecast, error) {
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{Timeout: httpClientTimeout}
+	}
+
+	token, err := getSecretValue(ctx, c.Client, c.Namespace, &c.AuthTokenSecretRef)
+	if err != nil {
+		return nil, err
+	}
+
+	// the forecast starts at the next hour so the latest value is needed to cover the current hour
+	latest := &electricityMapsIntensity{}
+	if err = c.get(ctx, token, "/v3/carbon-intensity/latest", latest); err != nil {
+		return nil, err
+	}
+
+	var forecast struct {
+		Forecast []electricityMapsIntensity `json:"forecast"`
+	}
+	if err = c.get(ctx, token, "/v3/carbon-intensity/forecast", &forecast); err != nil {
+		return nil, err
+	}
+
+	cf := make([]CarbonForecast, 0, len(forecast.Forecast)+1)
+	seen := map[time.Time]bool{}
+	for _, d := range append([]electricityMapsIntensity{*latest}, forecast.Forecast...) {
+		ts := d.Datetime.UTC()
+		if ts.IsZero() || seen[ts] {
+			continue
+		}
+		seen[ts] = true
+		cf = append(cf, CarbonForecast{
+			Location:  c.Zone,
+			Timestamp: ts,
+			Value:     d.CarbonIntensity,
+		})
+	}
+
+	if len(cf) == 0 {
+		return nil, fmt.Errorf("electricity maps returned no data for zone %s", c.Zone)
+	}
+
+	// electricity maps only returns timestamps so the slot length is derived from them, defaulting to hourly
+	setDurationsFromTimestamps(cf, 60)
+
+	return cf, nil
+}
+
+func (c *CarbonForecastElectricityMapsFetcher) get(ctx context.Context, token string, endpoint string, v interface{}) error {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("invalid electricity maps url: %w", err)
+	}
+	u.Path = path.Join(u.Path, endpoint)
+	q := u.Query()
+	q.Set("zone", c.Zone)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("auth-token", token)
+
+	return doJSONRequest(c.HTTPClient, req, v)
+}
@@ -0,0 +1,225 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"time"
+
+	kedav1alpha1 "github.com/kedacore/keda/v2/apis/keda/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	carbonawarev1alpha1 "github.com/azure/carbon-aware-keda-operator/api/v1alpha1"
+)
+
+// filterCarbonForecastByLocation returns the slots for the location, slots without a location apply to every location
+func filterCarbonForecastByLocation(cfs []CarbonForecast, location string) []CarbonForecast {
+	filtered := make([]CarbonForecast, 0, len(cfs))
+	for _, cf := range cfs {
+		if cf.Location == "" || strings.EqualFold(cf.Location, location) {
+			filtered = append(filtered, cf)
+		}
+	}
+	return filtered
+}
+
+// regionDetectionInterval is how long a detected region is reused before the nodes running the keda target are checked again
+const regionDetectionInterval = time.Hour
+
+// resolveForecastLocation returns the location the forecast should be filtered by or an empty string if every location should be used
+func (r *CarbonAwareKedaScalerReconciler) resolveForecastLocation(ctx context.Context, carbonAwareKedaScaler *carbonawarev1alpha1.CarbonAwareKedaScaler, now time.Time) (string, error) {
+	ds := carbonAwareKedaScaler.Spec.CarbonIntensityForecastDataSource
+	if !strings.EqualFold(ds.Location, carbonawarev1alpha1.LocationAuto) {
+		carbonAwareKedaScaler.Status.DetectedRegion = nil
+		return ds.Location, nil
+	}
+
+	region, err := r.targetRegion(ctx, carbonAwareKedaScaler, now)
+	if err != nil {
+		return "", err
+	}
+	if location, ok := ds.RegionLocations[region]; ok {
+		return location, nil
+	}
+	return region, nil
+}
+
+// targetRegion returns the region detected in the status while the pod template of the keda target workload is unchanged
+// and the region is younger than regionDetectionInterval, otherwise it detects the region again and stores it in the status
+func (r *CarbonAwareKedaScalerReconciler) targetRegion(ctx context.Context, carbonAwareKedaScaler *carbonawarev1alpha1.CarbonAwareKedaScaler, now time.Time) (string, error) {
+	selector, templateHash, err := r.targetPodSelector(ctx, carbonAwareKedaScaler)
+	if err != nil {
+		return "", err
+	}
+
+	detected := carbonAwareKedaScaler.Status.DetectedRegion
+	if detected != nil && detected.Region != "" && detected.PodTemplateHash == templateHash && now.Sub(detected.DetectedTime.Time) < regionDetectionInterval {
+		return detected.Region, nil
+	}
+
+	region, err := r.nodesRegion(ctx, carbonAwareKedaScaler, selector)
+	if errors.Is(err, errNoTargetPods) && detected != nil && detected.Region != "" {
+		// keep the region the workload last ran in while it is scaled to zero or between jobs
+		return detected.Region, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	carbonAwareKedaScaler.Status.DetectedRegion = &carbonawarev1alpha1.DetectedRegion{
+		Region:          region,
+		PodTemplateHash: templateHash,
+		DetectedTime:    metav1.Time{Time: now},
+	}
+	return region, nil
+}
+
+// errNoTargetPods is returned when none of the pods of the keda target are running, e.g. when the workload is scaled to zero
+var errNoTargetPods = errors.New("no pods of the keda target are running")
+
+// nodesRegion returns the most common region of the nodes running the pods matching the selector
+func (r *CarbonAwareKedaScalerReconciler) nodesRegion(ctx context.Context, carbonAwareKedaScaler *carbonawarev1alpha1.CarbonAwareKedaScaler, selector labels.Selector) (string, error) {
+	if selector == nil {
+		return "", fmt.Errorf("unable to find the pods of %s to detect its region", carbonAwareKedaScaler.Spec.KedaTargetRef.Name)
+	}
+
+	pods := &corev1.PodList{}
+	err := r.apiReader().List(ctx, pods, client.InNamespace(carbonAwareKedaScaler.Spec.KedaTargetRef.Namespace), client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return "", err
+	}
+
+	var nodes []corev1.Node
+	nodeNames := map[string]bool{}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed || nodeNames[pod.Spec.NodeName] {
+			continue
+		}
+		nodeNames[pod.Spec.NodeName] = true
+
+		node := &corev1.Node{}
+		if err := r.apiReader().Get(ctx, types.NamespacedName{Name: pod.Spec.NodeName}, node); err != nil {
+			return "", err
+		}
+		nodes = append(nodes, *node)
+	}
+	if len(nodes) == 0 {
+		return "", fmt.Errorf("unable to detect the region of %s: %w", carbonAwareKedaScaler.Spec.KedaTargetRef.Name, errNoTargetPods)
+	}
+
+	// count the nodes in each region and pick the region with the most nodes, breaking ties by name
+	counts := map[string]int{}
+	regions := []string{}
+	for _, node := range nodes {
+		region := node.Labels[corev1.LabelTopologyRegion]
+		if region == "" {
+			continue
+		}
+		if counts[region] == 0 {
+			regions = append(regions, region)
+		}
+		counts[region]++
+	}
+	if len(regions) == 0 {
+		return "", fmt.Errorf("no node running %s has the %s label", carbonAwareKedaScaler.Spec.KedaTargetRef.Name, corev1.LabelTopologyRegion)
+	}
+	sort.Slice(regions, func(i, j int) bool {
+		if counts[regions[i]] != counts[regions[j]] {
+			return counts[regions[i]] > counts[regions[j]]
+		}
+		return regions[i] < regions[j]
+	})
+	return regions[0], nil
+}
+
+// targetPodSelector returns the selector and a hash of the pod template of the pods of the keda target
+// which are the pods of the deployment or statefulset scaled by a scaledobject, or the pods of the jobs of a scaledjob
+// the selector is nil and the hash is empty if they cannot be determined
+func (r *CarbonAwareKedaScalerReconciler) targetPodSelector(ctx context.Context, carbonAwareKedaScaler *carbonawarev1alpha1.CarbonAwareKedaScaler) (labels.Selector, string, error) {
+	targetKey := types.NamespacedName{Name: carbonAwareKedaScaler.Spec.KedaTargetRef.Name, Namespace: carbonAwareKedaScaler.Spec.KedaTargetRef.Namespace}
+	if strings.Contains(string(carbonAwareKedaScaler.Spec.KedaTarget), "scaledjob") {
+		scaledJob := &kedav1alpha1.ScaledJob{}
+		if err := r.Get(ctx, targetKey, scaledJob); err != nil {
+			return nil, "", err
+		}
+		// keda adds the name of the scaledjob to the pod template of its jobs
+		var template corev1.PodTemplateSpec
+		if scaledJob.Spec.JobTargetRef != nil {
+			template = scaledJob.Spec.JobTargetRef.Template
+		}
+		hash, err := podTemplateHash(template)
+		if err != nil {
+			return nil, "", err
+		}
+		return labels.SelectorFromSet(labels.Set{scaledJobNameLabel: scaledJob.Name}), hash, nil
+	}
+	if !strings.Contains(string(carbonAwareKedaScaler.Spec.KedaTarget), "scaledobject") {
+		return nil, "", nil
+	}
+
+	scaledObject := &kedav1alpha1.ScaledObject{}
+	err := r.Get(ctx, targetKey, scaledObject)
+	if err != nil {
+		return nil, "", err
+	}
+	ref := scaledObject.Spec.ScaleTargetRef
+	if ref == nil || (ref.APIVersion != "" && ref.APIVersion != appsv1.SchemeGroupVersion.String()) {
+		return nil, "", nil
+	}
+
+	// keda defaults the kind of the scale target to deployment
+	key := types.NamespacedName{Name: ref.Name, Namespace: scaledObject.Namespace}
+	var selector *metav1.LabelSelector
+	var template corev1.PodTemplateSpec
+	switch ref.Kind {
+	case "", "Deployment":
+		deployment := &appsv1.Deployment{}
+		if err = r.apiReader().Get(ctx, key, deployment); err != nil {
+			return nil, "", err
+		}
+		selector, template = deployment.Spec.Selector, deployment.Spec.Template
+	case "StatefulSet":
+		statefulSet := &appsv1.StatefulSet{}
+		if err = r.apiReader().Get(ctx, key, statefulSet); err != nil {
+			return nil, "", err
+		}
+		selector, template = statefulSet.Spec.Selector, statefulSet.Spec.Template
+	default:
+		return nil, "", nil
+	}
+	if selector == nil {
+		return nil, "", nil
+	}
+
+	podSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, "", err
+	}
+	hash, err := podTemplateHash(template)
+	if err != nil {
+		return nil, "", err
+	}
+	return podSelector, hash, nil
+}
+
+// podTemplateHash returns a hash of the pod template to notice when the workload is rolled out again
+func podTemplateHash(template corev1.PodTemplateSpec) (string, error) {
+	templateJSON, err := json.Marshal(template)
+	if err != nil {
+		return "", err
+	}
+	hash := fnv.New32a()
+	_, _ = hash.Write(templateJSON)
+	return fmt.Sprintf("%x", hash.Sum32()), nil
+}
@@ -0,0 +1,124 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	carbonawarev1alpha1 "github.com/azure/carbon-aware-keda-operator/api/v1alpha1"
+)
+
+// default timeout for requests made to carbon intensity data providers
+const httpClientTimeout = 30 * time.Second
+
+// largest response body read from carbon intensity data providers
+const maxResponseBodyBytes = 10 << 20
+
+// getSecretValue returns the value stored under the key of the referenced secret in the namespace
+// secrets are only read from the namespace of the carbonawarekedascaler so its spec can't send secrets of other namespaces to a provider
+func getSecretValue(ctx context.Context, c client.Reader, namespace string, ref *carbonawarev1alpha1.SecretKeyRef) (string, error) {
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, secret); err != nil {
+		return "", err
+	}
+
+	value, ok := secret.Data[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found in secret %s/%s", ref.Key, namespace, ref.Name)
+	}
+
+	// trim whitespace since values are often created from files with a trailing newline
+	return strings.TrimSpace(string(value)), nil
+}
+
+// newHTTPClient returns an http client that uses the tls settings of a carbon intensity data provider, reading the ca bundle from the namespace
+func newHTTPClient(ctx context.Context, c client.Reader, namespace string, tlsConfig *carbonawarev1alpha1.TLSConfig) (*http.Client, error) {
+	httpClient := &http.Client{Timeout: httpClientTimeout}
+	if tlsConfig == nil {
+		return httpClient, nil
+	}
+
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: tlsConfig.InsecureSkipVerify, //nolint:gosec // opt-in for dev/test environments
+	}
+
+	// load the ca bundle into the pool used to verify the server certificate
+	if tlsConfig.CASecretRef != nil {
+		ca, err := getSecretValue(ctx, c, namespace, tlsConfig.CASecretRef)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(ca)) {
+			return nil, fmt.Errorf("no valid certificates found in secret %s/%s", namespace, tlsConfig.CASecretRef.Name)
+		}
+		config.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	httpClient.Transport = transport
+
+	return httpClient, nil
+}
+
+// httpStatusError is returned when a carbon intensity data provider responds with an unexpected status code
+type httpStatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("request to %s returned %s: %s", e.URL, e.Status, e.Body)
+}
+
+// doJSONRequest sends the request and unmarshals the json response body into v
+func doJSONRequest(httpClient *http.Client, req *http.Request, v interface{}) error {
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// read one byte more than the limit to tell a body of exactly the limit from a larger one
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBodyBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > maxResponseBodyBytes {
+		return fmt.Errorf("response from %s is larger than %d bytes", req.URL.Redacted(), maxResponseBodyBytes)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		// include the start of the body as providers usually explain the failure there
+		if len(body) > 256 {
+			body = body[:256]
+		}
+		return &httpStatusError{
+			URL:        req.URL.Redacted(),
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Body:       strings.TrimSpace(string(body)),
+		}
+	}
+
+	return json.Unmarshal(body, v)
+}
@@ -5,7 +5,12 @@ package controllers
 
 import (
 	"fmt"
+	"math"
 	"sort"
+	"strconv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	carbonawarev1alpha1 "github.com/azure/carbon-aware-keda-operator/api/v1alpha1"
 )
@@ -14,11 +19,14 @@ func getMaxReplicas(forecast *CarbonForecast, configs []carbonawarev1alpha1.Carb
 	// if there is no forecast for the current hour, revert back to the original maxReplicaCount from the operand
 	if forecast == nil {
 		return nil, fmt.Errorf("no forecast data")
+	} else if len(configs) == 0 {
+		return nil, fmt.Errorf("no carbon intensity thresholds configured")
 	} else {
 		ci := forecast.Value
 
 		// sort to ensure that configured carbon intensity thresholds are sorted is in ascending order to better evaluate lower and upper bounds
-		sort.Slice(configs, func(i, j int) bool {
+		// the sort is stable so the first of several equal thresholds always wins
+		sort.SliceStable(configs, func(i, j int) bool {
 			return configs[i].CarbonIntensityThreshold < configs[j].CarbonIntensityThreshold
 		})
 
@@ -44,3 +52,326 @@ func getMaxReplicas(forecast *CarbonForecast, configs []carbonawarev1alpha1.Carb
 		return configs[len(configs)-1].MaxReplicas, nil
 	}
 }
+
+/*
+getBandedMaxReplicas returns the max replicas of the band the carbon intensity of the forecast falls in, like getMaxReplicas,
+but stays in the current band until:
+1. the carbon intensity moves past the thresholds of the current band by more than the hysteresis, and
+2. the current band was entered at least minDwell ago
+it returns the band max replicas was taken from, which keeps the time it was entered while the band does not change
+*/
+func getBandedMaxReplicas(forecast *CarbonForecast, configs []carbonawarev1alpha1.CarbonIntensityConfig, current *carbonawarev1alpha1.CarbonIntensityBand, hysteresis int32, minDwell time.Duration, now time.Time) (*int32, *carbonawarev1alpha1.CarbonIntensityBand, error) {
+	if forecast == nil {
+		return nil, nil, fmt.Errorf("no forecast data")
+	} else if len(configs) == 0 {
+		return nil, nil, fmt.Errorf("no carbon intensity thresholds configured")
+	}
+
+	// copy the thresholds so sorting them does not reorder the spec
+	sorted := append([]carbonawarev1alpha1.CarbonIntensityConfig{}, configs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CarbonIntensityThreshold < sorted[j].CarbonIntensityThreshold
+	})
+
+	index := carbonIntensityBandIndex(forecast.Value, sorted)
+	if current != nil && int(current.Index) < len(sorted) && int(current.Index) != index {
+		dwelling := now.Sub(current.EnteredAt.Time) < minDwell
+		if dwelling || inCarbonIntensityBand(forecast.Value, sorted, int(current.Index), float64(hysteresis)) {
+			index = int(current.Index)
+		}
+	}
+
+	band := &carbonawarev1alpha1.CarbonIntensityBand{
+		Index:                    int32(index),
+		CarbonIntensityThreshold: sorted[index].CarbonIntensityThreshold,
+		MaxReplicas:              sorted[index].MaxReplicas,
+		EnteredAt:                metav1.Time{Time: now},
+	}
+	if current != nil && current.Index == band.Index {
+		band.EnteredAt = current.EnteredAt
+	}
+	return sorted[index].MaxReplicas, band, nil
+}
+
+// carbonIntensityBandIndex returns the index of the sorted threshold getMaxReplicas takes max replicas from
+func carbonIntensityBandIndex(ci float64, sorted []carbonawarev1alpha1.CarbonIntensityConfig) int {
+	for index := range sorted {
+		if ci > carbonIntensityBandLowerBound(sorted, index) && ci <= float64(sorted[index].CarbonIntensityThreshold) {
+			return index
+		}
+	}
+	return len(sorted) - 1
+}
+
+// inCarbonIntensityBand returns true if the carbon intensity is within the margin of the thresholds of the band, the last band has no upper bound
+func inCarbonIntensityBand(ci float64, sorted []carbonawarev1alpha1.CarbonIntensityConfig, index int, margin float64) bool {
+	if ci <= carbonIntensityBandLowerBound(sorted, index)-margin {
+		return false
+	}
+	return index == len(sorted)-1 || ci <= float64(sorted[index].CarbonIntensityThreshold)+margin
+}
+
+// carbonIntensityBandLowerBound returns the threshold of the band below or zero for the first band
+func carbonIntensityBandLowerBound(sorted []carbonawarev1alpha1.CarbonIntensityConfig, index int) float64 {
+	if index == 0 {
+		return 0
+	}
+	return float64(sorted[index-1].CarbonIntensityThreshold)
+}
+
+// getLinearMaxReplicas interpolates max replicas between the thresholds below and above the carbon intensity of the forecast
+// each threshold is a point of a piecewise linear function, carbon intensities outside of the thresholds use the max replicas of the nearest threshold
+func getLinearMaxReplicas(forecast *CarbonForecast, configs []carbonawarev1alpha1.CarbonIntensityConfig, rounding carbonawarev1alpha1.InterpolationRounding) (*int32, error) {
+	if forecast == nil {
+		return nil, fmt.Errorf("no forecast data")
+	}
+
+	// copy the thresholds with a max replicas so sorting them does not reorder the spec
+	points := make([]carbonawarev1alpha1.CarbonIntensityConfig, 0, len(configs))
+	for _, element := range configs {
+		if element.MaxReplicas != nil {
+			points = append(points, element)
+		}
+	}
+	if len(points) == 0 {
+		return nil, fmt.Errorf("no max replicas configured")
+	}
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].CarbonIntensityThreshold < points[j].CarbonIntensityThreshold
+	})
+
+	ci := forecast.Value
+	if ci <= float64(points[0].CarbonIntensityThreshold) {
+		return points[0].MaxReplicas, nil
+	}
+	for index := 1; index < len(points); index++ {
+		lower, upper := points[index-1], points[index]
+		if ci > float64(upper.CarbonIntensityThreshold) {
+			continue
+		}
+
+		// thresholds that are equal have no range to interpolate over
+		if upper.CarbonIntensityThreshold == lower.CarbonIntensityThreshold {
+			return upper.MaxReplicas, nil
+		}
+		fraction := (ci - float64(lower.CarbonIntensityThreshold)) / float64(upper.CarbonIntensityThreshold-lower.CarbonIntensityThreshold)
+		replicas := float64(*lower.MaxReplicas) + fraction*float64(*upper.MaxReplicas-*lower.MaxReplicas)
+
+		rounded := roundReplicas(replicas, rounding)
+		return &rounded, nil
+	}
+	return points[len(points)-1].MaxReplicas, nil
+}
+
+// getRelativeThresholds returns the carbon intensity thresholds at the percentiles of the forecast between now and the end of the window
+// each slot counts for the minutes it overlaps the window, so a percentile of 25 is the carbon intensity of the cleanest 25% of the window
+// thresholds are rounded up so every carbon intensity at or below the percentile stays at or below its threshold
+// and are returned in ascending order of percentile
+func getRelativeThresholds(forecast []CarbonForecast, relative carbonawarev1alpha1.RelativeThresholds, now time.Time) ([]carbonawarev1alpha1.CarbonIntensityConfig, error) {
+	window := time.Duration(relative.WindowInMins) * time.Minute
+	if window <= 0 {
+		window = 24 * time.Hour
+	}
+	end := now.Add(window)
+
+	// minutes of each carbon intensity in the window
+	type weightedValue struct {
+		value   float64
+		minutes float64
+	}
+	var values []weightedValue
+	var total float64
+	for _, cf := range forecast {
+		start, slotEnd := cf.Timestamp, cf.Timestamp.Add(time.Duration(cf.Duration)*time.Minute)
+		if start.Before(now) {
+			start = now
+		}
+		if slotEnd.After(end) {
+			slotEnd = end
+		}
+		if !slotEnd.After(start) {
+			continue
+		}
+		minutes := slotEnd.Sub(start).Minutes()
+		values = append(values, weightedValue{value: cf.Value, minutes: minutes})
+		total += minutes
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no forecast data in the next %s", window)
+	}
+	sort.SliceStable(values, func(i, j int) bool {
+		return values[i].value < values[j].value
+	})
+
+	// order a copy of the thresholds by percentile so percentiles that end up with the same carbon intensity keep their order
+	thresholds := append([]carbonawarev1alpha1.RelativeThreshold{}, relative.Thresholds...)
+	sort.SliceStable(thresholds, func(i, j int) bool {
+		return thresholds[i].Percentile < thresholds[j].Percentile
+	})
+
+	configs := relativeThresholdConfigs(thresholds)
+	for i, threshold := range thresholds {
+		// the lowest carbon intensity that covers the percentile of the window
+		target := total * float64(threshold.Percentile) / 100
+		cutoff := values[len(values)-1].value
+		var covered float64
+		for _, v := range values {
+			covered += v.minutes
+			if covered >= target {
+				cutoff = v.value
+				break
+			}
+		}
+		configs[i].CarbonIntensityThreshold = int32(math.Ceil(cutoff))
+	}
+	return configs, nil
+}
+
+// relativeThresholdConfigs returns the max replicas of the relative thresholds without their carbon intensity thresholds
+func relativeThresholdConfigs(thresholds []carbonawarev1alpha1.RelativeThreshold) []carbonawarev1alpha1.CarbonIntensityConfig {
+	configs := make([]carbonawarev1alpha1.CarbonIntensityConfig, 0, len(thresholds))
+	for _, threshold := range thresholds {
+		configs = append(configs, carbonawarev1alpha1.CarbonIntensityConfig{
+			MaxReplicas:        threshold.MaxReplicas,
+			MaxReplicasPercent: threshold.MaxReplicasPercent,
+		})
+	}
+	return configs
+}
+
+// getLowestMaxReplicas returns the lowest max replicas configured for any carbon intensity threshold or nil if none is configured
+func getLowestMaxReplicas(configs []carbonawarev1alpha1.CarbonIntensityConfig) *int32 {
+	var lowest *int32
+	for _, element := range configs {
+		if element.MaxReplicas != nil && (lowest == nil || *element.MaxReplicas < *lowest) {
+			lowest = element.MaxReplicas
+		}
+	}
+	return lowest
+}
+
+// annotation on the keda target holding its maxReplicaCount before the operator first changed it
+const originalMaxReplicasAnnotation = "carbonaware.kubernetes.azure.com/original-max-replicas"
+
+// annotation on the keda target holding the maxReplicaCount the operator last set, to notice when someone else changes it
+const appliedMaxReplicasAnnotation = "carbonaware.kubernetes.azure.com/applied-max-replicas"
+
+// keda scales up to 100 replicas when maxReplicaCount is not set
+const kedaDefaultMaxReplicaCount = 100
+
+// usesMaxReplicasPercent returns true if any threshold of the spec sets maxReplicasPercent
+func usesMaxReplicasPercent(spec carbonawarev1alpha1.CarbonAwareKedaScalerSpec) bool {
+	configs := spec.MaxReplicasByCarbonIntensity
+	if spec.RelativeThresholds != nil {
+		configs = append(relativeThresholdConfigs(spec.RelativeThresholds.Thresholds), configs...)
+	}
+	for _, element := range configs {
+		if element.MaxReplicasPercent != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// usesTargetMaxReplicasBaseline returns true if any threshold of the spec sets maxReplicasPercent relative to the max replicas of the keda target
+func usesTargetMaxReplicasBaseline(spec carbonawarev1alpha1.CarbonAwareKedaScalerSpec) bool {
+	return spec.PercentOfBaseline != nil && spec.PercentOfBaseline.Baseline == carbonawarev1alpha1.BaselineTargetMaxReplicas && usesMaxReplicasPercent(spec)
+}
+
+// resolveMaxReplicasPercent returns a copy of the configs where maxReplicasPercent is replaced by its percentage of the baseline
+// the result is rounded and clamped as configured in percentOfBaseline
+func resolveMaxReplicasPercent(configs []carbonawarev1alpha1.CarbonIntensityConfig, baseline *int32, percentOfBaseline *carbonawarev1alpha1.PercentOfBaseline) ([]carbonawarev1alpha1.CarbonIntensityConfig, error) {
+	if percentOfBaseline == nil {
+		percentOfBaseline = &carbonawarev1alpha1.PercentOfBaseline{}
+	}
+
+	resolved := make([]carbonawarev1alpha1.CarbonIntensityConfig, 0, len(configs))
+	for _, element := range configs {
+		if element.MaxReplicasPercent != nil {
+			if baseline == nil {
+				return nil, fmt.Errorf("no baseline for maxReplicasPercent")
+			}
+			maxReplicas := roundReplicas(float64(*baseline)*float64(*element.MaxReplicasPercent)/100, percentOfBaseline.Rounding)
+			if percentOfBaseline.MinReplicas != nil && maxReplicas < *percentOfBaseline.MinReplicas {
+				maxReplicas = *percentOfBaseline.MinReplicas
+			}
+			if percentOfBaseline.MaxReplicas != nil && maxReplicas > *percentOfBaseline.MaxReplicas {
+				maxReplicas = *percentOfBaseline.MaxReplicas
+			}
+			element.MaxReplicas = &maxReplicas
+			element.MaxReplicasPercent = nil
+		}
+		if element.MaxReplicas == nil {
+			return nil, fmt.Errorf("carbon intensity threshold %d has neither maxReplicas nor maxReplicasPercent", element.CarbonIntensityThreshold)
+		}
+		resolved = append(resolved, element)
+	}
+	return resolved, nil
+}
+
+// originalMaxReplicas returns the max replica count of the keda target before the operator first changed it
+// it falls back to the current max replica count when the target has not been annotated yet
+// or its max replica count was changed by someone else since the operator last set it
+func originalMaxReplicas(annotations map[string]string, current *int32) (int32, error) {
+	if value, ok := annotations[originalMaxReplicasAnnotation]; ok && !maxReplicasChangedExternally(annotations, current) {
+		original, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s annotation: %w", originalMaxReplicasAnnotation, err)
+		}
+		return int32(original), nil
+	}
+	if current == nil {
+		return kedaDefaultMaxReplicaCount, nil
+	}
+	return *current, nil
+}
+
+// maxReplicasChangedExternally returns true if the max replica count of the keda target is not the one the operator last set
+func maxReplicasChangedExternally(annotations map[string]string, current *int32) bool {
+	applied, ok := annotations[appliedMaxReplicasAnnotation]
+	if !ok {
+		return false
+	}
+	return current == nil || applied != strconv.Itoa(int(*current))
+}
+
+// recordOriginalMaxReplicas annotates the keda target with its max replica count before the operator changes it to applied
+// the annotation is only kept while the max replicas of the target are used as a baseline, and it is refreshed when
+// the max replica count of the target was changed by someone else since the operator last set it
+func recordOriginalMaxReplicas(obj metav1.Object, current *int32, applied *int32, usesBaseline bool) {
+	annotations := obj.GetAnnotations()
+	if !usesBaseline {
+		if _, ok := annotations[originalMaxReplicasAnnotation]; ok {
+			delete(annotations, originalMaxReplicasAnnotation)
+			delete(annotations, appliedMaxReplicasAnnotation)
+			obj.SetAnnotations(annotations)
+		}
+		return
+	}
+
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	if _, ok := annotations[originalMaxReplicasAnnotation]; !ok || maxReplicasChangedExternally(annotations, current) {
+		original := int32(kedaDefaultMaxReplicaCount)
+		if current != nil {
+			original = *current
+		}
+		annotations[originalMaxReplicasAnnotation] = strconv.Itoa(int(original))
+	}
+	if applied != nil {
+		annotations[appliedMaxReplicasAnnotation] = strconv.Itoa(int(*applied))
+	}
+	obj.SetAnnotations(annotations)
+}
+
+// roundReplicas rounds a number of replicas with the rounding
+func roundReplicas(replicas float64, rounding carbonawarev1alpha1.InterpolationRounding) int32 {
+	switch rounding {
+	case carbonawarev1alpha1.InterpolationRoundingDown:
+		return int32(math.Floor(replicas))
+	case carbonawarev1alpha1.InterpolationRoundingUp:
+		return int32(math.Ceil(replicas))
+	}
+	return int32(math.Floor(replicas + 0.5))
+}
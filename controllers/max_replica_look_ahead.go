@@ -0,0 +1,75 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package controllers
+
+import (
+	"time"
+
+	carbonawarev1alpha1 "github.com/azure/carbon-aware-keda-operator/api/v1alpha1"
+)
+
+/*
+getLookAheadMaxReplicas returns the max replicas to use ahead of the upcoming slots of the forecast:
+1. the highest max replicas of the slots starting within the scale up lead time, when it is higher than the current max replicas
+2. otherwise the lowest max replicas of the slots starting within the scale down lead time, when it is lower than the current max replicas
+3. otherwise the current max replicas
+raising max replicas wins so a workload is never scaled down right before a greener slot
+the forecast must be sorted, maxReplicasFor returns the max replicas of a slot and the slot max replicas was taken from is returned or nil for the current max replicas
+*/
+func getLookAheadMaxReplicas(forecast []CarbonForecast, now time.Time, current *int32, lookAhead carbonawarev1alpha1.LookAhead, maxReplicasFor func(*CarbonForecast) (*int32, error)) (*int32, *CarbonForecast, error) {
+	scaleUpUntil := now.Add(time.Duration(lookAhead.ScaleUpLeadTimeInMins) * time.Minute)
+	scaleDownUntil := now.Add(time.Duration(lookAhead.ScaleDownLeadTimeInMins) * time.Minute)
+
+	var up, down *int32
+	var upSlot, downSlot *CarbonForecast
+	for i := range forecast {
+		slot := &forecast[i]
+		if !slot.Timestamp.After(now) {
+			continue
+		}
+		if slot.Timestamp.After(scaleUpUntil) && slot.Timestamp.After(scaleDownUntil) {
+			break
+		}
+
+		maxReplicas, err := maxReplicasFor(slot)
+		if err != nil {
+			return nil, nil, err
+		}
+		if maxReplicas == nil {
+			continue
+		}
+		if !slot.Timestamp.After(scaleUpUntil) && *maxReplicas > *current && (up == nil || *maxReplicas > *up) {
+			up, upSlot = maxReplicas, slot
+		}
+		if !slot.Timestamp.After(scaleDownUntil) && *maxReplicas < *current && (down == nil || *maxReplicas < *down) {
+			down, downSlot = maxReplicas, slot
+		}
+	}
+
+	switch {
+	case up != nil:
+		return up, upSlot, nil
+	case down != nil:
+		return down, downSlot, nil
+	}
+	return current, nil, nil
+}
+
+// lookAheadRequeueAfter returns how long until the next upcoming slot of the sorted forecast comes within a lead time, or false if none will
+func lookAheadRequeueAfter(forecast []CarbonForecast, now time.Time, lookAhead carbonawarev1alpha1.LookAhead) (time.Duration, bool) {
+	var next time.Duration
+	found := false
+	for _, slot := range forecast {
+		for _, lead := range []int32{lookAhead.ScaleUpLeadTimeInMins, lookAhead.ScaleDownLeadTimeInMins} {
+			if lead <= 0 {
+				continue
+			}
+			wait := slot.Timestamp.Add(-time.Duration(lead) * time.Minute).Sub(now)
+			if wait > 0 && (!found || wait < next) {
+				next, found = wait, true
+			}
+		}
+	}
+	return next, found
+}
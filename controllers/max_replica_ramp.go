@@ -0,0 +1,99 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package controllers
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	carbonawarev1alpha1 "github.com/azure/carbon-aware-keda-operator/api/v1alpha1"
+)
+
+// default length of time between two steps of a ramp policy
+const defaultRampInterval = 5 * time.Minute
+
+/*
+rampMaxReplicaCount returns the max replica count to set on the keda target and records it in the status of the scaler along with the target:
+1. without a ramp policy, or when the current max replica count is the target, it returns the target
+2. while the last step was less than the interval of the ramp policy ago, it keeps the current max replica count
+3. otherwise it moves the current max replica count toward the target by at most the step of the ramp policy
+an unset current max replica count is the keda default, an invalid step returns the target along with the error
+*/
+func rampMaxReplicaCount(carbonAwareKedaScaler *carbonawarev1alpha1.CarbonAwareKedaScaler, current *int32, target *int32, now time.Time) (*int32, error) {
+	status := &carbonAwareKedaScaler.Status
+	status.TargetMaxReplicas = target
+	status.AppliedMaxReplicas = target
+
+	policy := carbonAwareKedaScaler.Spec.RampPolicy
+	if policy == nil || target == nil {
+		status.LastRampStepTime = nil
+		return target, nil
+	}
+
+	from := int32(kedaDefaultMaxReplicaCount)
+	if current != nil {
+		from = *current
+	}
+	if from == *target {
+		return target, nil
+	}
+
+	if status.LastRampStepTime != nil && now.Sub(status.LastRampStepTime.Time) < rampInterval(policy) {
+		status.AppliedMaxReplicas = &from
+		return &from, nil
+	}
+
+	limit := policy.MaxStepDown
+	if *target > from {
+		limit = policy.MaxStepUp
+	}
+	if limit == nil {
+		return target, nil
+	}
+	step, err := intstr.GetScaledValueFromIntOrPercent(limit, int(from), true)
+	if err != nil {
+		return target, err
+	}
+	// always move by at least one replica so a percentage of zero replicas still ramps up
+	if step < 1 {
+		step = 1
+	}
+
+	applied := *target
+	if *target > from && *target-from > int32(step) {
+		applied = from + int32(step)
+	} else if *target < from && from-*target > int32(step) {
+		applied = from - int32(step)
+	}
+	status.AppliedMaxReplicas = &applied
+	status.LastRampStepTime = &metav1.Time{Time: now}
+	return &applied, nil
+}
+
+// rampRequeueAfter returns how long until the next step of the ramp policy, or false if the keda target has reached its target max replica count
+func rampRequeueAfter(carbonAwareKedaScaler *carbonawarev1alpha1.CarbonAwareKedaScaler, now time.Time) (time.Duration, bool) {
+	status := carbonAwareKedaScaler.Status
+	policy := carbonAwareKedaScaler.Spec.RampPolicy
+	if policy == nil || status.TargetMaxReplicas == nil || status.AppliedMaxReplicas == nil || *status.TargetMaxReplicas == *status.AppliedMaxReplicas {
+		return 0, false
+	}
+	if status.LastRampStepTime == nil {
+		return rampInterval(policy), true
+	}
+	wait := rampInterval(policy) - now.Sub(status.LastRampStepTime.Time)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return wait, true
+}
+
+// rampInterval returns the length of time between two steps of the ramp policy
+func rampInterval(policy *carbonawarev1alpha1.RampPolicy) time.Duration {
+	if policy.IntervalInMins <= 0 {
+		return defaultRampInterval
+	}
+	return time.Duration(policy.IntervalInMins) * time.Minute
+}
@@ -4,8 +4,12 @@
 package controllers
 
 import (
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	carbonawarev1alpha1 "github.com/azure/carbon-aware-keda-operator/api/v1alpha1"
 )
 
 var (
@@ -33,6 +37,14 @@ var (
 		[]string{"app"},
 	)
 
+	ProviderCarbonIntensityMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "carbon_aware_keda_scaler_provider_carbon_intensity",
+			Help: "Carbon intensity forecast by each provider of an ensemble",
+		},
+		[]string{"app", "provider"},
+	)
+
 	DefaultMaxReplicasMetric = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "carbon_aware_keda_scaler_default_max_replicas",
@@ -49,6 +61,30 @@ var (
 		[]string{"app"},
 	)
 
+	TargetMaxReplicasMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "carbon_aware_keda_scaler_target_max_replicas",
+			Help: "Max replicas that the max replicas is ramping toward",
+		},
+		[]string{"app"},
+	)
+
+	ForecastAgeMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "carbon_aware_keda_scaler_forecast_age_seconds",
+			Help: "Age of the carbon intensity forecast reported by the exporter",
+		},
+		[]string{"app"},
+	)
+
+	ForecastRecordsMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "carbon_aware_keda_scaler_forecast_records",
+			Help: "Number of records in the carbon intensity forecast reported by the exporter",
+		},
+		[]string{"app"},
+	)
+
 	EcoModeOffMetric = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "carbon_aware_keda_scaler_eco_mode_off",
@@ -63,7 +99,32 @@ func init() {
 	metrics.Registry.MustRegister(ReconcilesTotal)
 	metrics.Registry.MustRegister(ReconcileErrorsTotal)
 	metrics.Registry.MustRegister(CarbonIntensityMetric)
+	metrics.Registry.MustRegister(ProviderCarbonIntensityMetric)
 	metrics.Registry.MustRegister(DefaultMaxReplicasMetric)
 	metrics.Registry.MustRegister(MaxReplicasMetric)
+	metrics.Registry.MustRegister(TargetMaxReplicasMetric)
+	metrics.Registry.MustRegister(ForecastAgeMetric)
+	metrics.Registry.MustRegister(ForecastRecordsMetric)
 	metrics.Registry.MustRegister(EcoModeOffMetric)
 }
+
+// setProviderCarbonIntensity replaces the provider carbon intensities of the app so providers removed from an ensemble are no longer reported
+func setProviderCarbonIntensity(app string, values map[string]float64) {
+	ProviderCarbonIntensityMetric.DeletePartialMatch(prometheus.Labels{"app": app})
+	for provider, value := range values {
+		ProviderCarbonIntensityMetric.WithLabelValues(app, provider).Set(value)
+	}
+}
+
+// setForecastMetadataMetrics replaces the age and number of records of the forecast of the app
+// so they are no longer reported once the app is deleted or its data source does not report them
+func setForecastMetadataMetrics(app string, md *carbonawarev1alpha1.ForecastMetadata, now time.Time) {
+	ForecastAgeMetric.DeletePartialMatch(prometheus.Labels{"app": app})
+	ForecastRecordsMetric.DeletePartialMatch(prometheus.Labels{"app": app})
+	if generated := forecastGeneratedAt(md); generated != nil {
+		ForecastAgeMetric.WithLabelValues(app).Set(now.Sub(generated.Time).Seconds())
+	}
+	if md != nil && md.NumOfRecords != nil {
+		ForecastRecordsMetric.WithLabelValues(app).Set(float64(*md.NumOfRecords))
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package controllers
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	carbonawarev1alpha1 "github.com/azure/carbon-aware-keda-operator/api/v1alpha1"
+)
+
+// representative daily traces of a few well-known grid regions, stored as csv in the same format as csv configmaps
+//
+//go:embed traces/*.csv
+var embeddedTraces embed.FS
+
+// embeddedTraceNames returns the names of the traces embedded in the operator
+func embeddedTraceNames() []string {
+	entries, err := embeddedTraces.ReadDir("traces")
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".csv"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadTrace returns the trace to replay from the trace configmap or the embedded trace
+func (c *CarbonForecastMockConfigMapFetcher) loadTrace(ctx context.Context, config carbonawarev1alpha1.MockCarbonForecast) ([]CarbonForecast, error) {
+	var trace []CarbonForecast
+	var err error
+	switch {
+	case config.TraceConfigMap != nil:
+		trace, err = (&CarbonForecastConfigMapFetcher{
+			Client:             c.reader(),
+			ConfigMapName:      config.TraceConfigMap.Name,
+			ConfigMapNamespace: config.TraceConfigMap.Namespace,
+			ConfigMapKey:       config.TraceConfigMap.Key,
+			Format:             config.TraceConfigMap.Format,
+		}).Fetch(ctx)
+	case config.Trace != "":
+		var payload []byte
+		payload, err = embeddedTraces.ReadFile(path.Join("traces", config.Trace+".csv"))
+		if err != nil {
+			return nil, fmt.Errorf("unknown trace %s, must be one of %s", config.Trace, strings.Join(embeddedTraceNames(), ", "))
+		}
+		trace, err = decodeCSVCarbonForecast(payload)
+	default:
+		return nil, fmt.Errorf("the replay profile requires trace or traceConfigMap")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	trace, _ = normalizeCarbonForecast(trace)
+	if len(trace) == 0 {
+		return nil, fmt.Errorf("trace has no slots")
+	}
+	return trace, nil
+}
+
+// replayCarbonForecast shifts the trace so that it starts at the anchor and, when looping, repeats it to cover the time between from and until
+func replayCarbonForecast(trace []CarbonForecast, anchor time.Time, loop bool, from time.Time, until time.Time) []CarbonForecast {
+	traceStart := trace[0].Timestamp
+	last := trace[len(trace)-1]
+	traceLength := last.Timestamp.Add(time.Duration(last.Duration) * time.Minute).Sub(traceStart)
+
+	// play the trace once from the anchor
+	first, count := int64(0), int64(1)
+	if loop {
+		// start with the repetition that covers from and continue until the repetition that covers until
+		first = int64(from.Sub(anchor) / traceLength)
+		if from.Before(anchor) {
+			first--
+		}
+		count = int64(until.Sub(anchor)/traceLength) - first + 1
+	}
+
+	cf := make([]CarbonForecast, 0, int(count)*len(trace))
+	for i := first; i < first+count; i++ {
+		offset := anchor.Add(time.Duration(i) * traceLength).Sub(traceStart)
+		for _, slot := range trace {
+			slot.Timestamp = slot.Timestamp.Add(offset)
+			end := slot.Timestamp.Add(time.Duration(slot.Duration) * time.Minute)
+			if loop && (!end.After(from) || !slot.Timestamp.Before(until)) {
+				continue
+			}
+			cf = append(cf, slot)
+		}
+	}
+	return cf
+}
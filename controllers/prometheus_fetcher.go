@@ -0,0 +1,118 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	promapi "github.com/prometheus/client_golang/api"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	carbonawarev1alpha1 "github.com/azure/carbon-aware-keda-operator/api/v1alpha1"
+)
+
+// CarbonForecastPrometheusFetcher is an implementation of CarbonForecastFetcher that builds the carbon forecast from a prometheus range query
+type CarbonForecastPrometheusFetcher struct {
+	Client client.Reader
+	// Namespace is the namespace of the carbonawarekedascaler that secrets are read from
+	Namespace     string
+	HTTPClient    *http.Client
+	URL           string
+	Query         string
+	Range         time.Duration
+	Step          time.Duration
+	AuthSecretRef *carbonawarev1alpha1.SecretKeyRef
+	TLS           *carbonawarev1alpha1.TLSConfig
+}
+
+func (c *CarbonForecastPrometheusFetcher) Fetch(ctx context.Context) ([]CarbonForecast, error) {
+	if c.Step <= 0 || c.Range <= 0 {
+		return nil, fmt.Errorf("prometheus range and step must be greater than zero")
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		var err error
+		httpClient, err = newHTTPClient(ctx, c.Client, c.Namespace, c.TLS)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// pass the bearer token if prometheus sits behind an authenticating proxy
+	if c.AuthSecretRef != nil {
+		token, err := getSecretValue(ctx, c.Client, c.Namespace, c.AuthSecretRef)
+		if err != nil {
+			return nil, err
+		}
+		authClient := *httpClient
+		authClient.Transport = &bearerTokenRoundTripper{token: token, next: httpClient.Transport}
+		httpClient = &authClient
+	}
+
+	promClient, err := promapi.NewClient(promapi.Config{Address: c.URL, Client: httpClient})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	value, _, err := promv1.NewAPI(promClient).QueryRange(ctx, c.Query, promv1.Range{
+		Start: now.Add(-c.Range),
+		End:   now,
+		Step:  c.Step,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	matrix, ok := value.(model.Matrix)
+	if !ok {
+		return nil, fmt.Errorf("prometheus query returned %s instead of a matrix", value.Type())
+	}
+	if len(matrix) != 1 {
+		return nil, fmt.Errorf("prometheus query must return a single series but returned %d", len(matrix))
+	}
+
+	// each sample covers the step that starts at its timestamp so the latest sample covers the current time
+	cf := make([]CarbonForecast, 0, len(matrix[0].Values))
+	for _, sample := range matrix[0].Values {
+		if math.IsNaN(float64(sample.Value)) {
+			continue
+		}
+		cf = append(cf, CarbonForecast{
+			Location:  string(matrix[0].Metric["location"]),
+			Timestamp: sample.Timestamp.Time().UTC(),
+			Duration:  int32(c.Step.Minutes()),
+			Value:     float64(sample.Value),
+		})
+	}
+
+	if len(cf) == 0 {
+		return nil, fmt.Errorf("prometheus query returned no samples")
+	}
+
+	return cf, nil
+}
+
+// bearerTokenRoundTripper adds a bearer token to every request
+type bearerTokenRoundTripper struct {
+	token string
+	next  http.RoundTripper
+}
+
+func (rt *bearerTokenRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := rt.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+rt.token)
+	return next.RoundTrip(req)
+}
@@ -7,6 +7,10 @@ import "time"
 
 // controller should requeue at the next 5 minute interval
 func getRequeueDuration(now time.Time, interval int32) time.Duration {
+	// an interval of zero would divide by zero so fall back to the default interval
+	if interval <= 0 {
+		interval = 5
+	}
 	// get the difference betwen the current minute and the next minute interval
 	// e.g., if the interval is 5 minutes and the current minute is 37, the difference is 3 minutes
 	diff := interval - (int32(now.Minute()) % interval)
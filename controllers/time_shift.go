@@ -0,0 +1,122 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package controllers
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	carbonawarev1alpha1 "github.com/azure/carbon-aware-keda-operator/api/v1alpha1"
+)
+
+// layout of a deadline given as a time of day
+const timeOfDayLayout = "15:04"
+
+// parseTimeShiftDeadline returns the time of an RFC 3339 deadline or the next occurrence of a time of day deadline in UTC
+func parseTimeShiftDeadline(deadline string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, deadline); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse(timeOfDayLayout, deadline)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid deadline %q, must be an RFC 3339 time or a time of day such as 06:00", deadline)
+	}
+
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next, nil
+}
+
+/*
+getTimeShiftWindow returns the window with the lowest mean carbon intensity the jobs can run in and still complete before the deadline:
+1. windows open now or at the start of an upcoming slot of the sorted forecast and last the job duration
+2. windows that end after the deadline or are not fully covered by the forecast are left out
+3. the earliest window wins a tie
+it returns nil when no window fits
+*/
+func getTimeShiftWindow(forecast []CarbonForecast, now time.Time, deadline time.Time, duration time.Duration) *carbonawarev1alpha1.TimeShiftWindow {
+	starts := []time.Time{now}
+	for _, cf := range forecast {
+		if cf.Timestamp.After(now) {
+			starts = append(starts, cf.Timestamp)
+		}
+	}
+
+	var best *carbonawarev1alpha1.TimeShiftWindow
+	bestIntensity := math.Inf(1)
+	for _, start := range starts {
+		end := start.Add(duration)
+		if end.After(deadline) {
+			break
+		}
+		intensity, ok := meanCarbonIntensity(forecast, start, end)
+		if !ok || intensity >= bestIntensity {
+			continue
+		}
+		bestIntensity = intensity
+		best = &carbonawarev1alpha1.TimeShiftWindow{
+			Start:           metav1.Time{Time: start},
+			End:             metav1.Time{Time: end},
+			Deadline:        metav1.Time{Time: deadline},
+			CarbonIntensity: int32(math.Round(intensity)),
+		}
+	}
+	return best
+}
+
+// meanCarbonIntensity returns the carbon intensity of the sorted forecast between start and end weighed by time, or false if the forecast does not cover all of it
+func meanCarbonIntensity(forecast []CarbonForecast, start time.Time, end time.Time) (float64, bool) {
+	var covered time.Duration
+	var sum float64
+	for _, cf := range forecast {
+		from, to := cf.Timestamp, cf.Timestamp.Add(time.Duration(cf.Duration)*time.Minute)
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		if !to.After(from) {
+			continue
+		}
+		covered += to.Sub(from)
+		sum += cf.Value * to.Sub(from).Minutes()
+	}
+	if covered < end.Sub(start) || covered == 0 {
+		return 0, false
+	}
+	return sum / covered.Minutes(), true
+}
+
+/*
+getTimeShiftMaxReplicas returns the max replicas of a scaledjob shifted to the greenest window before the deadline, along with the window:
+1. the window of the last reconcile is kept once it has opened, until its deadline passes, so jobs are shifted once per deadline
+2. otherwise the greenest window of the forecast is chosen
+3. the jobs wait with the wait max replicas until the window opens and run with the eco mode off max replicas from then on,
+including after the window ends so jobs that are left over still complete before the deadline
+the jobs run without waiting when no window fits before the deadline, in which case the returned window is nil
+*/
+func getTimeShiftMaxReplicas(forecast []CarbonForecast, now time.Time, previous *carbonawarev1alpha1.TimeShiftWindow, timeShift carbonawarev1alpha1.TimeShift, maxReplicas int32) (*int32, *carbonawarev1alpha1.TimeShiftWindow, error) {
+	deadline, err := parseTimeShiftDeadline(timeShift.Deadline, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	window := previous
+	if window == nil || !window.Deadline.Time.Equal(deadline) || now.Before(window.Start.Time) {
+		window = getTimeShiftWindow(forecast, now, deadline, time.Duration(timeShift.JobDurationInMins)*time.Minute)
+	}
+
+	if window != nil && now.Before(window.Start.Time) {
+		wait := timeShift.WaitMaxReplicas
+		return &wait, window, nil
+	}
+	return &maxReplicas, window, nil
+}
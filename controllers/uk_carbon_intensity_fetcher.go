@@ -0,0 +1,125 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+)
+
+// timestamp format used by the uk carbon intensity api, e.g. 2018-01-20T12:00Z
+const ukCarbonIntensityTimeFormat = "2006-01-02T15:04Z"
+
+// ukCarbonIntensityPeriod is a half hour period returned by the uk carbon intensity api
+type ukCarbonIntensityPeriod struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Intensity struct {
+		Forecast float64 `json:"forecast"`
+	} `json:"intensity"`
+}
+
+// ukCarbonIntensityRegion is the regional wrapper around the periods returned for a region or postcode
+type ukCarbonIntensityRegion struct {
+	ShortName string                    `json:"shortname"`
+	Data      []ukCarbonIntensityPeriod `json:"data"`
+}
+
+// CarbonForecastUkCarbonIntensityFetcher is an implementation of CarbonForecastFetcher that fetches the carbon forecast from the uk national grid eso carbon intensity api
+type CarbonForecastUkCarbonIntensityFetcher struct {
+	HTTPClient *http.Client
+	URL        string
+	RegionID   int32
+	Postcode   string
+}
+
+func (c *CarbonForecastUkCarbonIntensityFetcher) Fetch(ctx context.Context) ([]CarbonForecast, error) {
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{Timeout: httpClientTimeout}
+	}
+	if c.RegionID > 0 && c.Postcode != "" {
+		return nil, fmt.Errorf("only one of regionId or postcode can be set")
+	}
+
+	// start at the current half hour so the current period is included
+	from := time.Now().UTC().Truncate(30 * time.Minute).Format(ukCarbonIntensityTimeFormat)
+
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uk carbon intensity url: %w", err)
+	}
+	switch {
+	case c.RegionID > 0:
+		u.Path = path.Join(u.Path, "/regional/intensity", from, "fw24h/regionid", strconv.Itoa(int(c.RegionID)))
+	case c.Postcode != "":
+		u.Path = path.Join(u.Path, "/regional/intensity", from, "fw24h/postcode", c.Postcode)
+	default:
+		u.Path = path.Join(u.Path, "/intensity", from, "fw24h")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err = doJSONRequest(c.HTTPClient, req, &resp); err != nil {
+		return nil, err
+	}
+
+	location := "GB"
+	var periods []ukCarbonIntensityPeriod
+	if c.RegionID > 0 || c.Postcode != "" {
+		// regional responses wrap the periods in a region object which some endpoints return inside an array
+		region := ukCarbonIntensityRegion{}
+		if bytes.HasPrefix(bytes.TrimSpace(resp.Data), []byte("[")) {
+			var regions []ukCarbonIntensityRegion
+			if err = json.Unmarshal(resp.Data, &regions); err != nil {
+				return nil, err
+			}
+			if len(regions) > 0 {
+				region = regions[0]
+			}
+		} else if err = json.Unmarshal(resp.Data, &region); err != nil {
+			return nil, err
+		}
+		location = region.ShortName
+		periods = region.Data
+	} else if err = json.Unmarshal(resp.Data, &periods); err != nil {
+		return nil, err
+	}
+
+	cf := make([]CarbonForecast, 0, len(periods))
+	for _, p := range periods {
+		start, err := time.Parse(ukCarbonIntensityTimeFormat, p.From)
+		if err != nil {
+			return nil, err
+		}
+		end, err := time.Parse(ukCarbonIntensityTimeFormat, p.To)
+		if err != nil {
+			return nil, err
+		}
+		cf = append(cf, CarbonForecast{
+			Location:  location,
+			Timestamp: start.UTC(),
+			Duration:  int32(end.Sub(start).Minutes()),
+			Value:     p.Intensity.Forecast,
+		})
+	}
+
+	if len(cf) == 0 {
+		return nil, fmt.Errorf("uk carbon intensity api returned no forecast data")
+	}
+
+	return cf, nil
+}
@@ -0,0 +1,233 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	carbonawarev1alpha1 "github.com/azure/carbon-aware-keda-operator/api/v1alpha1"
+)
+
+const (
+	// watttime tokens expire after 30 minutes so renew them a little earlier
+	wattTimeTokenLifetime = 25 * time.Minute
+
+	// signal type requested from the watttime api
+	wattTimeSignalType = "co2_moer"
+)
+
+// wattTimeResponse is the shape of the forecast, historical and signal index responses of the watttime v3 api
+type wattTimeResponse struct {
+	Data []struct {
+		PointTime time.Time `json:"point_time"`
+		Value     float64   `json:"value"`
+	} `json:"data"`
+	Meta struct {
+		DataPointPeriodSeconds int32 `json:"data_point_period_seconds"`
+	} `json:"meta"`
+}
+
+// slotDuration returns the length of each data point in minutes, defaulting to 5 minutes which is what watttime uses for moer data
+func (w *wattTimeResponse) slotDuration() int32 {
+	if w.Meta.DataPointPeriodSeconds < 60 {
+		return 5
+	}
+	return w.Meta.DataPointPeriodSeconds / 60
+}
+
+// CarbonForecastWattTimeFetcher is an implementation of CarbonForecastFetcher that fetches marginal emissions from the watttime api
+// values are in lbs/MWh rather than the gCO2/kWh of the other data sources, or the watttime signal index from 0 to 100 with the percent signal
+type CarbonForecastWattTimeFetcher struct {
+	Client client.Reader
+	// Namespace is the namespace of the carbonawarekedascaler that secrets are read from
+	Namespace            string
+	HTTPClient           *http.Client
+	URL                  string
+	Region               string
+	CredentialsSecretRef carbonawarev1alpha1.SecretRef
+	Signal               carbonawarev1alpha1.WattTimeSignal
+
+	token       string
+	tokenExpiry time.Time
+}
+
+func (c *CarbonForecastWattTimeFetcher) Fetch(ctx context.Context) ([]CarbonForecast, error) {
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{Timeout: httpClientTimeout}
+	}
+
+	if c.Signal == carbonawarev1alpha1.WattTimeSignalPercent {
+		return c.fetchSignalIndex(ctx)
+	}
+
+	// get the forecast which is always in lbs/MWh
+	forecast := &wattTimeResponse{}
+	if err := c.get(ctx, "/v3/forecast", nil, forecast); err != nil {
+		return nil, err
+	}
+
+	// get the current value which the forecast may not cover yet
+	current := &wattTimeResponse{}
+	now := time.Now().UTC()
+	params := url.Values{}
+	params.Set("start", now.Add(-15*time.Minute).Format(time.RFC3339))
+	params.Set("end", now.Format(time.RFC3339))
+	if err := c.get(ctx, "/v3/historical", params, current); err != nil {
+		return nil, err
+	}
+
+	duration := forecast.slotDuration()
+	cf := make([]CarbonForecast, 0, len(forecast.Data)+1)
+
+	// use the most recent current value as the first slot
+	var currentEnd time.Time
+	if len(current.Data) > 0 {
+		latest := current.Data[0]
+		for _, d := range current.Data {
+			if d.PointTime.After(latest.PointTime) {
+				latest = d
+			}
+		}
+		currentEnd = latest.PointTime.UTC().Add(time.Duration(duration) * time.Minute)
+		cf = append(cf, CarbonForecast{
+			Location:  c.Region,
+			Timestamp: latest.PointTime.UTC(),
+			Duration:  duration,
+			Value:     latest.Value,
+		})
+	}
+
+	for _, d := range forecast.Data {
+		// skip forecasted slots that overlap with the current value
+		if d.PointTime.UTC().Before(currentEnd) {
+			continue
+		}
+		cf = append(cf, CarbonForecast{
+			Location:  c.Region,
+			Timestamp: d.PointTime.UTC(),
+			Duration:  duration,
+			Value:     d.Value,
+		})
+	}
+
+	if len(cf) == 0 {
+		return nil, fmt.Errorf("watttime returned no data for region %s", c.Region)
+	}
+
+	return cf, nil
+}
+
+// fetchSignalIndex returns the current moer percentile of the region from the signal index endpoint
+// watttime only publishes the index for the current time so the forecast is a single slot
+func (c *CarbonForecastWattTimeFetcher) fetchSignalIndex(ctx context.Context) ([]CarbonForecast, error) {
+	index := &wattTimeResponse{}
+	if err := c.get(ctx, "/v3/signal-index", nil, index); err != nil {
+		return nil, err
+	}
+	if len(index.Data) == 0 {
+		return nil, fmt.Errorf("watttime returned no signal index for region %s", c.Region)
+	}
+
+	latest := index.Data[0]
+	for _, d := range index.Data {
+		if d.PointTime.After(latest.PointTime) {
+			latest = d
+		}
+	}
+	return []CarbonForecast{{
+		Location:  c.Region,
+		Timestamp: latest.PointTime.UTC(),
+		Duration:  index.slotDuration(),
+		Value:     latest.Value,
+	}}, nil
+}
+
+// get calls a watttime api endpoint for the configured region and renews the token once if it was rejected
+func (c *CarbonForecastWattTimeFetcher) get(ctx context.Context, endpoint string, params url.Values, v interface{}) error {
+	err := c.doGet(ctx, endpoint, params, v)
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnauthorized {
+		c.token = ""
+		err = c.doGet(ctx, endpoint, params, v)
+	}
+	return err
+}
+
+func (c *CarbonForecastWattTimeFetcher) doGet(ctx context.Context, endpoint string, params url.Values, v interface{}) error {
+	token, err := c.login(ctx)
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("invalid watttime url: %w", err)
+	}
+	u.Path = path.Join(u.Path, endpoint)
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("region", c.Region)
+	params.Set("signal_type", wattTimeSignalType)
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return doJSONRequest(c.HTTPClient, req, v)
+}
+
+// login returns a cached token or requests a new one using the credentials from the secret in the namespace of the scaler
+func (c *CarbonForecastWattTimeFetcher) login(ctx context.Context) (string, error) {
+	if c.token != "" && time.Now().Before(c.tokenExpiry) {
+		return c.token, nil
+	}
+
+	secret := &corev1.Secret{}
+	err := c.Client.Get(ctx, types.NamespacedName{Name: c.CredentialsSecretRef.Name, Namespace: c.Namespace}, secret)
+	if err != nil {
+		return "", err
+	}
+	username, password := strings.TrimSpace(string(secret.Data["username"])), strings.TrimSpace(string(secret.Data["password"]))
+	if username == "" || password == "" {
+		return "", fmt.Errorf("secret %s/%s must contain username and password keys", c.Namespace, c.CredentialsSecretRef.Name)
+	}
+
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid watttime url: %w", err)
+	}
+	u.Path = path.Join(u.Path, "/login")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(username, password)
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	if err = doJSONRequest(c.HTTPClient, req, &login); err != nil {
+		return "", fmt.Errorf("watttime login failed: %w", err)
+	}
+
+	c.token = login.Token
+	c.tokenExpiry = time.Now().Add(wattTimeTokenLifetime)
+	return c.token, nil
+}
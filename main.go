@@ -18,13 +18,17 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"strings"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	kedav1alpha1 "github.com/kedacore/keda/v2/apis/keda/v1alpha1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -45,6 +49,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(carbonawarev1alpha1.AddToScheme(scheme))
+	utilruntime.Must(kedav1alpha1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -52,8 +57,22 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var maxConcurrentReconciles int
+	var pushAddr string
+	var pushTokenSecret string
+	var pushTokenSecretKey string
+	var pushMaxBodySize int64
+	var pushCertFile string
+	var pushKeyFile string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1, "The maximum number of CarbonAwareKedaScalers reconciled in parallel.")
+	flag.StringVar(&pushAddr, "forecast-push-bind-address", "0", "The address the forecast push endpoint binds to. Set to 0 to disable the endpoint.")
+	flag.StringVar(&pushTokenSecret, "forecast-push-token-secret", "", "The namespace/name of the secret holding the bearer token of the forecast push endpoint.")
+	flag.StringVar(&pushTokenSecretKey, "forecast-push-token-secret-key", "token", "The key of the bearer token in the forecast push token secret.")
+	flag.Int64Var(&pushMaxBodySize, "forecast-push-max-body-bytes", 4<<20, "The maximum size in bytes of a forecast pushed to the forecast push endpoint.")
+	flag.StringVar(&pushCertFile, "forecast-push-tls-cert-file", "", "The certificate file used to serve the forecast push endpoint over https.")
+	flag.StringVar(&pushKeyFile, "forecast-push-tls-key-file", "", "The key file used to serve the forecast push endpoint over https.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -89,14 +108,58 @@ func main() {
 		os.Exit(1)
 	}
 
+	// the forecast push endpoint stores pushed forecasts in the namespace of its token secret where the pushed data source reads them
+	var pushNamespace string
+	if pushAddr != "" && pushAddr != "0" {
+		namespace, name, found := strings.Cut(pushTokenSecret, "/")
+		if !found || namespace == "" || name == "" {
+			setupLog.Error(fmt.Errorf("--forecast-push-token-secret must be set to namespace/name"), "unable to set up forecast push endpoint")
+			os.Exit(1)
+		}
+		pushNamespace = namespace
+		if err = mgr.Add(&controllers.CarbonForecastPushServer{
+			Addr:           pushAddr,
+			CertFile:       pushCertFile,
+			KeyFile:        pushKeyFile,
+			Client:         mgr.GetAPIReader(),
+			TokenSecretRef: types.NamespacedName{Namespace: namespace, Name: name},
+			TokenSecretKey: pushTokenSecretKey,
+			MaxBodySize:    pushMaxBodySize,
+			Forecasts:      mgr.GetClient(),
+			Namespace:      namespace,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up forecast push endpoint")
+			os.Exit(1)
+		}
+	}
+
+	// the configmaps used as data sources are served from an informer per configmap shared by every carbonawarekedascaler
+	configMaps := controllers.NewCarbonForecastConfigMapCache(mgr.GetConfig(), mgr.GetScheme(), mgr.GetRESTMapper())
+	if err = mgr.Add(configMaps); err != nil {
+		setupLog.Error(err, "unable to set up configmap cache")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.CarbonAwareKedaScalerReconciler{
-		Client:   mgr.GetClient(),
-		Scheme:   mgr.GetScheme(),
-		Recorder: mgr.GetEventRecorderFor("carbon-aware-keda-operator"),
+		Client:        mgr.GetClient(),
+		Scheme:        mgr.GetScheme(),
+		Recorder:      mgr.GetEventRecorderFor("carbon-aware-keda-operator"),
+		APIReader:     mgr.GetAPIReader(),
+		ConfigMaps:    configMaps,
+		PushNamespace: pushNamespace,
+
+		MaxConcurrentReconciles: maxConcurrentReconciles,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CarbonAwareKedaScaler")
 		os.Exit(1)
 	}
+	if err = (&controllers.CarbonIntensityForecastReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CarbonIntensityForecast")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {